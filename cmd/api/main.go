@@ -1,11 +1,35 @@
 package main
 
 import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"github.com/Kmicac/Webhook-Relay/internal/api"
+	"github.com/Kmicac/Webhook-Relay/internal/storage"
 )
 
 func main() {
-	e := api.NewServer()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := storage.ConfigFromEnv("webhook-relay-api")
+	if err != nil {
+		log.Fatalf("[API] invalid database config: %v", err)
+	}
+
+	store, err := storage.NewPostgresStore(ctx, cfg)
+	if err != nil {
+		log.Fatalf("[API] %v", err)
+	}
+	defer store.Close()
+
+	e, err := api.NewServer(store)
+	if err != nil {
+		log.Fatalf("[API] %v", err)
+	}
 
 	e.Logger.Fatal(e.Start(":8080"))
 }
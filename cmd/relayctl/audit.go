@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Kmicac/Webhook-Relay/internal/audit"
+)
+
+func runAudit(api *apiClient, out *printer, cmd string, args []string) error {
+	switch cmd {
+	case "list", "ls":
+		fs := flag.NewFlagSet("audit list", flag.ContinueOnError)
+		actor := fs.Int64("actor", 0, "filter by actor API key id")
+		action := fs.String("action", "", "filter by action, e.g. client.disable")
+		targetType := fs.String("target-type", "", "filter by target type")
+		targetID := fs.String("target", "", "filter by target id")
+		since := fs.Duration("since", 0, "only entries newer than this, e.g. 24h")
+		limit := fs.Int("limit", 100, "max number of entries")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		q := url.Values{}
+		if *actor > 0 {
+			q.Set("actor_key_id", strconv.FormatInt(*actor, 10))
+		}
+		setIf(q, "action", *action)
+		setIf(q, "target_type", *targetType)
+		setIf(q, "target_id", *targetID)
+		if *since > 0 {
+			q.Set("since", time.Now().Add(-*since).UTC().Format(time.RFC3339))
+		}
+		q.Set("limit", strconv.Itoa(*limit))
+
+		var entries []audit.Entry
+		if err := api.get("/admin/audit", q, &entries); err != nil {
+			return err
+		}
+
+		rows := make([][]string, 0, len(entries))
+		for _, e := range entries {
+			changes, _ := json.Marshal(e.Diff)
+			rows = append(rows, []string{
+				strconv.FormatInt(e.ID, 10),
+				fmtTime(&e.CreatedAt),
+				e.ActorName,
+				e.Action,
+				fmtStr(e.TargetID),
+				strconv.Itoa(e.StatusCode),
+				e.SourceIP,
+				truncate(string(changes), 60),
+			})
+		}
+		return out.print(entries,
+			[]string{"ID", "AT", "ACTOR", "ACTION", "TARGET", "STATUS", "SOURCE_IP", "DIFF"},
+			rows,
+		)
+
+	default:
+		return fmt.Errorf("unknown audit command %q", cmd)
+	}
+}
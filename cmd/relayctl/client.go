@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// apiClient habla con la API de admin. El token puede ser el master token
+// o una API key, ambos van como Bearer.
+type apiClient struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+func newAPIClient(baseURL, token string) *apiClient {
+	return &apiClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		http:    &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// apiError es una respuesta no-2xx de la API (problem+json).
+type apiError struct {
+	Status    int
+	Code      string
+	Message   string
+	RequestID string
+}
+
+func (e *apiError) Error() string {
+	msg := fmt.Sprintf("api error (%d): %s", e.Status, e.Message)
+	if e.Code != "" {
+		msg += " [" + e.Code + "]"
+	}
+	if e.RequestID != "" {
+		msg += " (request_id " + e.RequestID + ")"
+	}
+	return msg
+}
+
+func (a *apiClient) get(path string, query url.Values, out interface{}) error {
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return a.do(http.MethodGet, path, nil, out)
+}
+
+func (a *apiClient) post(path string, body, out interface{}) error {
+	return a.do(http.MethodPost, path, body, out)
+}
+
+func (a *apiClient) patch(path string, body, out interface{}) error {
+	return a.do(http.MethodPatch, path, body, out)
+}
+
+func (a *apiClient) delete(path string, out interface{}) error {
+	return a.do(http.MethodDelete, path, nil, out)
+}
+
+func (a *apiClient) do(method, path string, body, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, a.baseURL+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		var problem struct {
+			Detail    string `json:"detail"`
+			Code      string `json:"code"`
+			RequestID string `json:"request_id"`
+		}
+		apiErr := &apiError{Status: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+		if json.Unmarshal(data, &problem) == nil && problem.Detail != "" {
+			apiErr.Message = problem.Detail
+			apiErr.Code = problem.Code
+			apiErr.RequestID = problem.RequestID
+		}
+		return apiErr
+	}
+
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Kmicac/Webhook-Relay/internal/clients"
+)
+
+type clientSecret struct {
+	ClientUID string `json:"client_uid"`
+	Secret    string `json:"secret"`
+	Provider  string `json:"provider"`
+}
+
+func runClients(api *apiClient, out *printer, cmd string, args []string) error {
+	switch cmd {
+	case "create":
+		fs := flag.NewFlagSet("clients create", flag.ContinueOnError)
+		provider := fs.String("provider", "", "payment provider (required)")
+		uid := fs.String("uid", "", "client uid (generated if empty)")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if *provider == "" {
+			return fmt.Errorf("-provider is required")
+		}
+
+		var res clientSecret
+		body := map[string]string{"client_uid": *uid, "provider": *provider}
+		if err := api.post("/admin/clients", body, &res); err != nil {
+			return err
+		}
+		return printSecret(out, res)
+
+	case "list", "ls":
+		fs := flag.NewFlagSet("clients list", flag.ContinueOnError)
+		all := fs.Bool("all", false, "include deleted clients")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		var q url.Values
+		if *all {
+			q = url.Values{"include_deleted": {"true"}}
+		}
+
+		var list []clients.Client
+		if err := api.get("/admin/clients", q, &list); err != nil {
+			return err
+		}
+
+		rows := make([][]string, 0, len(list))
+		for _, c := range list {
+			rows = append(rows, clientRow(c))
+		}
+		return out.print(list, clientHeaders, rows)
+
+	case "get", "show":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: clients get UID")
+		}
+
+		var c clients.Client
+		if err := api.get(clientPath(args[0]), nil, &c); err != nil {
+			return err
+		}
+		return printClient(out, c)
+
+	case "update":
+		fs := flag.NewFlagSet("clients update", flag.ContinueOnError)
+		metadata := fs.String("metadata", "", `metadata JSON to merge, e.g. '{"plan":"pro"}'`)
+		rps := fs.Float64("rps", -1, "ingestion rate limit override (0 resets to default)")
+		burst := fs.Int("burst", -1, "ingestion burst override (0 resets to default)")
+		cidrs := fs.String("allowed-cidrs", "", `comma separated source IPs/CIDRs ("none" clears the list)`)
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: clients update [-metadata JSON] [-rps R] [-burst B] [-allowed-cidrs LIST] UID")
+		}
+
+		body := map[string]interface{}{}
+		if *metadata != "" {
+			m, err := parseJSONObject("-metadata", *metadata)
+			if err != nil {
+				return err
+			}
+			body["metadata"] = m
+		}
+		if *rps >= 0 {
+			body["rate_limit_rps"] = *rps
+		}
+		if *burst >= 0 {
+			body["rate_limit_burst"] = *burst
+		}
+		switch *cidrs {
+		case "":
+		case "none":
+			body["allowed_cidrs"] = []string{}
+		default:
+			body["allowed_cidrs"] = strings.Split(*cidrs, ",")
+		}
+
+		var c clients.Client
+		if err := api.patch(clientPath(fs.Arg(0)), body, &c); err != nil {
+			return err
+		}
+		return printClient(out, c)
+
+	case "disable", "enable":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: clients %s UID", cmd)
+		}
+
+		var c clients.Client
+		if err := api.post(clientPath(args[0])+"/"+cmd, nil, &c); err != nil {
+			return err
+		}
+		return out.print(c, clientHeaders, [][]string{clientRow(c)})
+
+	case "delete", "rm":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: clients delete UID")
+		}
+
+		var c clients.Client
+		if err := api.delete(clientPath(args[0]), &c); err != nil {
+			return err
+		}
+		return out.print(c, clientHeaders, [][]string{clientRow(c)})
+
+	case "rotate-secret":
+		fs := flag.NewFlagSet("clients rotate-secret", flag.ContinueOnError)
+		provider := fs.String("provider", "", "provider whose secret is rotated (required)")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 || *provider == "" {
+			return fmt.Errorf("usage: clients rotate-secret -provider P UID")
+		}
+
+		var res clientSecret
+		if err := api.post(providerPath(fs.Arg(0), *provider)+"/rotate-secret", nil, &res); err != nil {
+			return err
+		}
+		return printSecret(out, res)
+
+	default:
+		return fmt.Errorf("unknown clients command %q", cmd)
+	}
+}
+
+// runProviders maneja las configuraciones de provider de un cliente.
+func runProviders(api *apiClient, out *printer, cmd string, args []string) error {
+	fs := flag.NewFlagSet("providers "+cmd, flag.ContinueOnError)
+	provider := fs.String("provider", "", "provider name")
+	settings := fs.String("settings", "", `settings JSON to merge, e.g. '{"access_token":"..."}'`)
+	enabled := fs.String("enabled", "", "true or false")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: providers %s [flags] UID", cmd)
+	}
+	uid := fs.Arg(0)
+
+	if cmd != "list" && cmd != "ls" && *provider == "" {
+		return fmt.Errorf("-provider is required")
+	}
+
+	switch cmd {
+	case "list", "ls":
+		var list []clients.ProviderConfig
+		if err := api.get(clientPath(uid)+"/providers", nil, &list); err != nil {
+			return err
+		}
+
+		rows := make([][]string, 0, len(list))
+		for _, p := range list {
+			rows = append(rows, providerRow(p))
+		}
+		return out.print(list, providerHeaders, rows)
+
+	case "add":
+		body := map[string]interface{}{"provider": *provider}
+		if *settings != "" {
+			m, err := parseJSONObject("-settings", *settings)
+			if err != nil {
+				return err
+			}
+			body["settings"] = m
+		}
+
+		var res clientSecret
+		if err := api.post(clientPath(uid)+"/providers", body, &res); err != nil {
+			return err
+		}
+		return printSecret(out, res)
+
+	case "update":
+		body := map[string]interface{}{}
+		if *settings != "" {
+			m, err := parseJSONObject("-settings", *settings)
+			if err != nil {
+				return err
+			}
+			body["settings"] = m
+		}
+		if *enabled != "" {
+			b, err := strconv.ParseBool(*enabled)
+			if err != nil {
+				return fmt.Errorf("invalid -enabled: %w", err)
+			}
+			body["enabled"] = b
+		}
+
+		var p clients.ProviderConfig
+		if err := api.patch(providerPath(uid, *provider), body, &p); err != nil {
+			return err
+		}
+		return out.print(p, providerHeaders, [][]string{providerRow(p)})
+
+	case "remove", "rm":
+		return api.delete(providerPath(uid, *provider), nil)
+
+	default:
+		return fmt.Errorf("unknown providers command %q", cmd)
+	}
+}
+
+var clientHeaders = []string{"ID", "CLIENT_UID", "PROVIDERS", "DISABLED_AT", "DELETED_AT"}
+
+func clientRow(c clients.Client) []string {
+	return []string{fmt.Sprint(c.ID), c.UID, providerNames(c), fmtTime(c.DisabledAt), fmtTime(c.DeletedAt)}
+}
+
+var providerHeaders = []string{"PROVIDER", "ENABLED", "SETTINGS", "CREATED_AT", "UPDATED_AT"}
+
+func providerRow(p clients.ProviderConfig) []string {
+	settings, _ := json.Marshal(p.Settings)
+	return []string{
+		p.Provider,
+		strconv.FormatBool(p.Enabled),
+		truncate(string(settings), 60),
+		fmtTime(&p.CreatedAt),
+		fmtTime(p.UpdatedAt),
+	}
+}
+
+// providerNames lista los providers del cliente; los deshabilitados van con "!".
+func providerNames(c clients.Client) string {
+	if len(c.Providers) == 0 {
+		return "-"
+	}
+	names := make([]string, 0, len(c.Providers))
+	for _, p := range c.Providers {
+		if p.Enabled {
+			names = append(names, p.Provider)
+		} else {
+			names = append(names, "!"+p.Provider)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+func fmtRateLimit(c clients.Client) string {
+	if c.RateLimitRPS == nil && c.RateLimitBurst == nil {
+		return "default"
+	}
+	rps, burst := "default", "default"
+	if c.RateLimitRPS != nil {
+		rps = strconv.FormatFloat(*c.RateLimitRPS, 'f', -1, 64)
+	}
+	if c.RateLimitBurst != nil {
+		burst = strconv.Itoa(*c.RateLimitBurst)
+	}
+	return rps + " rps, burst " + burst
+}
+
+func clientPath(uid string) string {
+	return "/admin/clients/" + url.PathEscape(uid)
+}
+
+func providerPath(uid, provider string) string {
+	return clientPath(uid) + "/providers/" + url.PathEscape(provider)
+}
+
+func parseJSONObject(flagName, raw string) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &m); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", flagName, err)
+	}
+	return m, nil
+}
+
+func printClient(out *printer, c clients.Client) error {
+	if out.json {
+		return out.printJSON(c)
+	}
+
+	meta, _ := json.Marshal(c.Metadata)
+	return out.printTable(nil, [][]string{
+		{"id", fmt.Sprint(c.ID)},
+		{"client_uid", c.UID},
+		{"providers", providerNames(c)},
+		{"metadata", string(meta)},
+		{"rate_limit", fmtRateLimit(c)},
+		{"allowed_cidrs", fmtList(c.AllowedCIDRs)},
+		{"disabled_at", fmtTime(c.DisabledAt)},
+		{"updated_at", fmtTime(c.UpdatedAt)},
+		{"deleted_at", fmtTime(c.DeletedAt)},
+	})
+}
+
+func printSecret(out *printer, res clientSecret) error {
+	return out.print(res,
+		[]string{"CLIENT_UID", "PROVIDER", "SECRET"},
+		[][]string{{res.ClientUID, res.Provider, res.Secret}},
+	)
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kmicac/Webhook-Relay/internal/webhooks"
+)
+
+func runEvents(api *apiClient, out *printer, cmd string, args []string) error {
+	switch cmd {
+	case "list", "ls":
+		fs := flag.NewFlagSet("events list", flag.ContinueOnError)
+		client := fs.String("client", "", "filter by client uid")
+		provider := fs.String("provider", "", "filter by provider")
+		status := fs.String("status", "", "filter by status: "+strings.Join(webhooks.Statuses, ", "))
+		before := fs.Int64("before", 0, "only events with id lower than this")
+		limit := fs.Int("limit", 50, "max number of events")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		q := url.Values{}
+		setIf(q, "client", *client)
+		setIf(q, "provider", *provider)
+		setIf(q, "status", *status)
+		if *before > 0 {
+			q.Set("before_id", strconv.FormatInt(*before, 10))
+		}
+		q.Set("limit", strconv.Itoa(*limit))
+
+		var events []webhooks.WebhookEvent
+		if err := api.get("/admin/events", q, &events); err != nil {
+			return err
+		}
+		return printEvents(out, events, true)
+
+	case "show", "get":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: events show ID")
+		}
+
+		var detail webhooks.EventDetail
+		if err := api.get("/admin/events/"+url.PathEscape(args[0]), nil, &detail); err != nil {
+			return err
+		}
+		return printEventDetail(out, detail)
+
+	case "replay":
+		if len(args) == 0 {
+			return fmt.Errorf("usage: events replay ID [ID...]")
+		}
+
+		var results []map[string]interface{}
+		for _, id := range args {
+			var res map[string]interface{}
+			if err := api.post("/admin/events/"+url.PathEscape(id)+"/replay", nil, &res); err != nil {
+				return fmt.Errorf("event %s: %w", id, err)
+			}
+			results = append(results, res)
+		}
+
+		rows := make([][]string, 0, len(results))
+		for _, r := range results {
+			rows = append(rows, []string{fmt.Sprint(r["event_id"]), fmt.Sprint(r["status"])})
+		}
+		return out.print(results, []string{"EVENT_ID", "STATUS"}, rows)
+
+	case "tail":
+		fs := flag.NewFlagSet("events tail", flag.ContinueOnError)
+		provider := fs.String("provider", "", "filter by provider")
+		status := fs.String("status", "", "filter by status")
+		interval := fs.Duration("interval", 2*time.Second, "poll interval")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		return tailEvents(api, out, *provider, *status, *interval)
+
+	default:
+		return fmt.Errorf("unknown events command %q", cmd)
+	}
+}
+
+// tailEvents hace polling de /admin/events?after_id=N e imprime los nuevos.
+// En modo JSON emite un objeto por línea (NDJSON) para poder encadenar con jq.
+func tailEvents(api *apiClient, out *printer, provider, status string, interval time.Duration) error {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	// arrancamos desde el último evento existente
+	var latest []webhooks.WebhookEvent
+	if err := api.get("/admin/events", url.Values{"limit": {"1"}}, &latest); err != nil {
+		return err
+	}
+	var lastID int64
+	if len(latest) > 0 {
+		lastID = latest[0].ID
+	}
+
+	header := true
+	for {
+		q := url.Values{}
+		setIf(q, "provider", provider)
+		setIf(q, "status", status)
+		q.Set("after_id", strconv.FormatInt(lastID, 10))
+		q.Set("limit", "100")
+
+		var events []webhooks.WebhookEvent
+		if err := api.get("/admin/events", q, &events); err != nil {
+			fmt.Fprintln(os.Stderr, "relayctl:", err)
+		}
+
+		if len(events) > 0 {
+			lastID = events[len(events)-1].ID
+
+			if out.json {
+				for _, ev := range events {
+					if err := out.printJSONLine(ev); err != nil {
+						return err
+					}
+				}
+			} else {
+				if err := printEvents(out, events, header); err != nil {
+					return err
+				}
+				header = false
+			}
+		}
+
+		// si vino una página llena seguimos sin esperar
+		if len(events) == 100 {
+			continue
+		}
+
+		select {
+		case <-interrupt:
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+var eventHeaders = []string{"ID", "PROVIDER", "STATUS", "ATTEMPTS", "RECEIVED_AT", "PROCESSED_AT", "ERROR"}
+
+func eventRow(ev webhooks.WebhookEvent) []string {
+	return []string{
+		strconv.FormatInt(ev.ID, 10),
+		ev.Provider,
+		ev.Status,
+		strconv.Itoa(ev.Attempts),
+		fmtTime(&ev.ReceivedAt),
+		fmtTime(ev.ProcessedAt),
+		truncate(fmtStr(ev.ErrorMessage), 60),
+	}
+}
+
+func printEvents(out *printer, events []webhooks.WebhookEvent, header bool) error {
+	rows := make([][]string, 0, len(events))
+	for _, ev := range events {
+		rows = append(rows, eventRow(ev))
+	}
+
+	headers := eventHeaders
+	if !header {
+		headers = nil
+	}
+	return out.print(events, headers, rows)
+}
+
+func printEventDetail(out *printer, d webhooks.EventDetail) error {
+	if out.json {
+		return out.printJSON(d)
+	}
+
+	ev := d.Event
+	rows := [][]string{
+		{"id", strconv.FormatInt(ev.ID, 10)},
+		{"provider", ev.Provider},
+		{"status", ev.Status},
+		{"attempts", strconv.Itoa(ev.Attempts)},
+		{"received_at", fmtTime(&ev.ReceivedAt)},
+		{"processed_at", fmtTime(ev.ProcessedAt)},
+		{"error", fmtStr(ev.ErrorMessage)},
+		{"next_attempt_at", fmtTime(ev.NextAttemptAt)},
+		{"dead_at", fmtTime(ev.DeadAt)},
+		{"raw_body", truncate(string(ev.RawBody), 200)},
+	}
+
+	if dl := d.Delivery; dl != nil {
+		rows = append(rows,
+			[]string{"source_ip", fmtStr(dl.SourceIP)},
+			[]string{"query_string", fmtStr(&dl.QueryString)},
+		)
+		names := make([]string, 0, len(dl.Headers))
+		for name := range dl.Headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			rows = append(rows, []string{"header." + name, truncate(strings.Join(dl.Headers[name], ", "), 120)})
+		}
+	}
+
+	if p := d.Payment; p != nil {
+		rows = append(rows,
+			[]string{"", ""},
+			[]string{"payment.id", strconv.FormatInt(p.ID, 10)},
+			[]string{"payment.external_id", p.ExternalID},
+			[]string{"payment.kind", p.Kind},
+			[]string{"payment.event_type", fmtStr(&p.EventType)},
+			[]string{"payment.status", p.Status},
+			[]string{"payment.raw_status", p.RawStatus},
+			[]string{"payment.status_detail", p.StatusDetail},
+			[]string{"payment.amount", strconv.FormatFloat(p.Amount, 'f', 2, 64) + " " + p.Currency},
+			[]string{"payment.payer_email", p.PayerEmail},
+			[]string{"payment.approved_at", fmtTime(p.ApprovedAt)},
+		)
+	} else {
+		rows = append(rows, []string{"payment", "-"})
+	}
+
+	return out.printTable(nil, rows)
+}
+
+func setIf(q url.Values, key, value string) {
+	if value != "" {
+		q.Set(key, value)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kmicac/Webhook-Relay/internal/auth"
+)
+
+type createdKey struct {
+	auth.APIKey
+	Key string `json:"key"`
+}
+
+func runKeys(api *apiClient, out *printer, cmd string, args []string) error {
+	switch cmd {
+	case "create":
+		fs := flag.NewFlagSet("api-keys create", flag.ContinueOnError)
+		name := fs.String("name", "", "key name (required)")
+		scopes := fs.String("scopes", "", "comma separated scopes: "+strings.Join(auth.AllScopes, ","))
+		client := fs.String("client", "", "restrict the key to a client uid")
+		expires := fs.Duration("expires", 0, "expire the key after this duration, e.g. 720h")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if *name == "" || *scopes == "" {
+			return fmt.Errorf("usage: api-keys create -name N -scopes S1,S2 [-client UID] [-expires D]")
+		}
+
+		body := map[string]interface{}{
+			"name":   *name,
+			"scopes": strings.Split(*scopes, ","),
+		}
+		if *client != "" {
+			body["client_uid"] = *client
+		}
+		if *expires > 0 {
+			body["expires_at"] = time.Now().Add(*expires).UTC()
+		}
+
+		var res createdKey
+		if err := api.post("/admin/api-keys", body, &res); err != nil {
+			return err
+		}
+		return out.print(res,
+			[]string{"ID", "NAME", "SCOPES", "KEY"},
+			[][]string{{strconv.FormatInt(res.ID, 10), res.Name, strings.Join(res.Scopes, ","), res.Key}},
+		)
+
+	case "list", "ls":
+		var keys []auth.APIKey
+		if err := api.get("/admin/api-keys", nil, &keys); err != nil {
+			return err
+		}
+
+		rows := make([][]string, 0, len(keys))
+		for _, k := range keys {
+			rows = append(rows, []string{
+				strconv.FormatInt(k.ID, 10),
+				k.Name,
+				"wr_" + k.Prefix + "_…",
+				strings.Join(k.Scopes, ","),
+				fmtStr(k.ClientUID),
+				fmtTime(k.ExpiresAt),
+				fmtTime(k.LastUsedAt),
+				fmtTime(k.RevokedAt),
+			})
+		}
+		return out.print(keys,
+			[]string{"ID", "NAME", "KEY", "SCOPES", "CLIENT", "EXPIRES_AT", "LAST_USED_AT", "REVOKED_AT"},
+			rows,
+		)
+
+	case "revoke":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: api-keys revoke ID")
+		}
+		return api.delete("/admin/api-keys/"+url.PathEscape(args[0]), nil)
+
+	default:
+		return fmt.Errorf("unknown api-keys command %q", cmd)
+	}
+}
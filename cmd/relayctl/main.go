@@ -0,0 +1,119 @@
+// relayctl es un CLI para operar Webhook-Relay a través de la API de admin.
+//
+//	relayctl [-url URL] [-token TOKEN] [-o table|json] <recurso> <comando> [flags] [args]
+//
+// La URL y el token también se leen de RELAY_URL y RELAY_API_KEY
+// (o RELAY_ADMIN_TOKEN). El token puede ser una API key o el master token.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+const usage = `usage: relayctl [global flags] <resource> <command> [flags] [args]
+
+resources and commands:
+  clients create -provider P [-uid UID]   create a client (prints the secret once)
+  clients list [-all]                     list clients (-all includes deleted)
+  clients get UID                         show a client
+  clients update [-metadata JSON] [-rps R] [-burst B] [-allowed-cidrs LIST] UID
+  clients disable UID | enable UID        toggle webhook ingestion for a client
+  clients delete UID                      soft-delete a client (events are kept)
+  clients rotate-secret -provider P UID   generate a new secret for a client provider
+
+  providers list UID                      list provider configurations of a client
+  providers add -provider P [-settings JSON] UID
+  providers update -provider P [-enabled BOOL] [-settings JSON] UID
+  providers remove -provider P UID
+
+  events list [-client UID] [-provider P] [-status S] [-before ID] [-limit N]
+  events show ID                          show an event with its payment
+  events replay ID [ID...]                requeue events for processing
+  events tail [-provider P] [-interval D] follow new events as they arrive
+
+  payments show [-client UID] PROVIDER EXTERNAL_ID  net amount of a payment with its refunds and disputes
+
+  api-keys create -name N -scopes S1,S2 [-client UID] [-expires D]
+  api-keys list
+  api-keys revoke ID
+
+  allowlist reload                        reload the provider IP allowlist file
+
+  audit list [-actor ID] [-action A] [-target-type T] [-target ID] [-since D] [-limit N]
+
+global flags:
+`
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	global := flag.NewFlagSet("relayctl", flag.ContinueOnError)
+	global.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		global.PrintDefaults()
+	}
+
+	baseURL := global.String("url", envOr("RELAY_URL", "http://localhost:8080"), "relay API base URL")
+	token := global.String("token", envOr("RELAY_API_KEY", envOr("RELAY_ADMIN_TOKEN", os.Getenv("ADMIN_TOKEN"))), "API key or admin token")
+	output := global.String("o", "table", "output format: table or json")
+
+	if err := global.Parse(args); err != nil {
+		return 2
+	}
+
+	rest := global.Args()
+	if len(rest) < 2 {
+		global.Usage()
+		return 2
+	}
+
+	out, err := newPrinter(*output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "relayctl:", err)
+		return 2
+	}
+
+	api := newAPIClient(*baseURL, *token)
+
+	var cmdErr error
+	switch rest[0] {
+	case "clients", "client":
+		cmdErr = runClients(api, out, rest[1], rest[2:])
+	case "providers", "provider":
+		cmdErr = runProviders(api, out, rest[1], rest[2:])
+	case "events", "event":
+		cmdErr = runEvents(api, out, rest[1], rest[2:])
+	case "payments", "payment":
+		cmdErr = runPayments(api, out, rest[1], rest[2:])
+	case "api-keys", "keys":
+		cmdErr = runKeys(api, out, rest[1], rest[2:])
+	case "allowlist":
+		if rest[1] != "reload" {
+			global.Usage()
+			return 2
+		}
+		cmdErr = api.post("/admin/allowlist/reload", nil, nil)
+	case "audit":
+		cmdErr = runAudit(api, out, rest[1], rest[2:])
+	default:
+		global.Usage()
+		return 2
+	}
+
+	if cmdErr != nil {
+		fmt.Fprintln(os.Stderr, "relayctl:", cmdErr)
+		return 1
+	}
+	return 0
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// printer imprime resultados como tabla o como JSON.
+type printer struct {
+	json bool
+	w    io.Writer
+}
+
+func newPrinter(format string) (*printer, error) {
+	switch format {
+	case "table", "":
+		return &printer{w: os.Stdout}, nil
+	case "json":
+		return &printer{json: true, w: os.Stdout}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// print muestra v como JSON, o como tabla con headers y rows.
+func (p *printer) print(v interface{}, headers []string, rows [][]string) error {
+	if p.json {
+		return p.printJSON(v)
+	}
+	return p.printTable(headers, rows)
+}
+
+func (p *printer) printJSON(v interface{}) error {
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (p *printer) printTable(headers []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	if headers != nil {
+		fmt.Fprintln(tw, strings.Join(headers, "\t"))
+	}
+	for _, r := range rows {
+		fmt.Fprintln(tw, strings.Join(r, "\t"))
+	}
+	return tw.Flush()
+}
+
+func fmtTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+func fmtStr(s *string) string {
+	if s == nil || *s == "" {
+		return "-"
+	}
+	return *s
+}
+
+func fmtList(l []string) string {
+	if len(l) == 0 {
+		return "-"
+	}
+	return strings.Join(l, ",")
+}
+
+// truncate acorta s a n runas para que la tabla no se rompa.
+func truncate(s string, n int) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
+
+// printJSONLine imprime v en una sola línea (para streams NDJSON).
+func (p *printer) printJSONLine(v interface{}) error {
+	return json.NewEncoder(p.w).Encode(v)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/Kmicac/Webhook-Relay/internal/payments"
+)
+
+func runPayments(api *apiClient, out *printer, cmd string, args []string) error {
+	switch cmd {
+	case "show", "get":
+		fs := flag.NewFlagSet("payments show", flag.ContinueOnError)
+		client := fs.String("client", "", "client uid (if the payment exists for several clients)")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		args = fs.Args()
+		if len(args) != 2 {
+			return fmt.Errorf("usage: payments show [-client UID] PROVIDER EXTERNAL_ID")
+		}
+
+		q := url.Values{}
+		setIf(q, "client", *client)
+
+		var b payments.Balance
+		if err := api.get("/admin/payments/"+url.PathEscape(args[0])+"/"+url.PathEscape(args[1]), q, &b); err != nil {
+			return err
+		}
+		return printBalance(out, b)
+
+	default:
+		return fmt.Errorf("unknown payments command %q", cmd)
+	}
+}
+
+func printBalance(out *printer, b payments.Balance) error {
+	if out.json {
+		return out.printJSON(b)
+	}
+
+	money := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', 2, 64) + " " + b.Currency
+	}
+
+	rows := [][]string{
+		{"provider", b.Provider},
+		{"external_id", b.ExternalID},
+		{"gross", money(b.Gross)},
+		{"refunded", money(b.Refunded)},
+		{"disputed_lost", money(b.DisputedLost)},
+		{"disputed_open", money(b.DisputedOpen)},
+		{"net", money(b.Net)},
+	}
+
+	for _, r := range b.Refunds {
+		id := r.ExternalID
+		if r.Cumulative {
+			id += " (total)"
+		}
+		rows = append(rows,
+			[]string{"", ""},
+			[]string{"refund", id},
+			[]string{"refund.amount", money(r.Amount)},
+			[]string{"refund.status", r.Status},
+			[]string{"refund.refunded_at", fmtTime(r.RefundedAt)},
+		)
+	}
+
+	for _, d := range b.Disputes {
+		rows = append(rows,
+			[]string{"", ""},
+			[]string{"dispute", d.ExternalID},
+			[]string{"dispute.amount", money(d.Amount)},
+			[]string{"dispute.status", d.Status},
+			[]string{"dispute.reason", d.Reason},
+			[]string{"dispute.opened_at", fmtTime(d.OpenedAt)},
+			[]string{"dispute.closed_at", fmtTime(d.ClosedAt)},
+		)
+	}
+
+	return out.printTable(nil, rows)
+}
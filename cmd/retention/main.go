@@ -0,0 +1,135 @@
+// retention opera los archivos de webhook_events. A diferencia de relayctl
+// se conecta directo a la base (DATABASE_URL, etc.) y usa el mismo
+// ARCHIVE_DIR y RETENTION_FILE que el worker.
+//
+//	retention run               hace una pasada de archivado y purga ahora
+//	retention list [PREFIX]     lista los archivos (p.ej. webhook_events/2025/01)
+//	retention restore NAME...   vuelve a importar archivos a webhook_events
+//	retention partitions        crea y desancla particiones mensuales ahora
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Kmicac/Webhook-Relay/internal/partitions"
+	"github.com/Kmicac/Webhook-Relay/internal/retention"
+	"github.com/Kmicac/Webhook-Relay/internal/storage"
+)
+
+const usage = `usage: retention <command> [args]
+
+commands:
+  run                 archive and delete expired events now (needs RETENTION_FILE)
+  list [PREFIX]       list archive files, optionally under PREFIX
+  restore NAME...     import archive files back into webhook_events
+  partitions          create upcoming monthly partitions and detach expired ones
+`
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := storage.ConfigFromEnv("webhook-relay-retention")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "retention: invalid database config:", err)
+		return 1
+	}
+	store, err := storage.NewPostgresStore(ctx, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "retention:", err)
+		return 1
+	}
+	defer store.Close()
+
+	job, err := retention.JobFromEnv(store)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "retention:", err)
+		return 1
+	}
+
+	var cmdErr error
+	switch args[0] {
+	case "run":
+		cmdErr = runOnce(ctx, job)
+	case "list":
+		prefix := ""
+		if len(args) > 1 {
+			prefix = args[1]
+		}
+		cmdErr = list(ctx, job, prefix)
+	case "restore":
+		if len(args) < 2 {
+			fmt.Fprint(os.Stderr, usage)
+			return 2
+		}
+		cmdErr = restore(ctx, job, args[1:])
+	case "partitions":
+		cmdErr = maintainPartitions(ctx, store)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	if cmdErr != nil {
+		fmt.Fprintln(os.Stderr, "retention:", cmdErr)
+		return 1
+	}
+	return 0
+}
+
+func runOnce(ctx context.Context, job *retention.Job) error {
+	if job.Config == nil {
+		return errors.New("RETENTION_FILE is not set")
+	}
+	res, err := job.RunOnce(ctx)
+	for _, name := range res.Files {
+		fmt.Println(name)
+	}
+	fmt.Printf("archived %d, deleted %d\n", res.Archived, res.Deleted)
+	return err
+}
+
+func list(ctx context.Context, job *retention.Job, prefix string) error {
+	names, err := job.Store.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		fmt.Println(name)
+	}
+	return nil
+}
+
+func maintainPartitions(ctx context.Context, store *storage.PostgresStore) error {
+	m, err := partitions.ManagerFromEnv(store)
+	if err != nil {
+		return err
+	}
+	return m.Maintain(ctx)
+}
+
+func restore(ctx context.Context, job *retention.Job, names []string) error {
+	for _, name := range names {
+		n, err := job.Restore(ctx, name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: restored %d events\n", name, n)
+	}
+	fmt.Printf("restored events are kept for %s (RETENTION_RESTORE_GRACE) before retention can purge them again\n", job.RestoreGrace)
+	return nil
+}
@@ -0,0 +1,235 @@
+package allowlist
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// rejected cuenta requests rechazadas por scope ("provider", "client").
+var rejected = expvar.NewMap("allowlist_rejected")
+
+// Config es el formato del archivo de allowlists (IP_ALLOWLIST_FILE).
+// Un provider sin entradas acepta cualquier IP. TrustedProxyHops es
+// puntero para distinguir "no está" (se usa el default) de un 0 explícito.
+// Las claves desconocidas (p.ej. "_comment") se ignoran.
+type Config struct {
+	Providers        map[string][]string `json:"providers"`
+	TrustedProxyHops *int                `json:"trusted_proxy_hops"`
+}
+
+type compiled struct {
+	providers map[string][]netip.Prefix
+	hops      int
+}
+
+// Store mantiene las allowlists por provider y la cantidad de proxies
+// confiables. Se puede recargar en caliente con Reload.
+type Store struct {
+	path        string
+	defaultHops int
+	cur         atomic.Pointer[compiled]
+}
+
+// StoreFromEnv arma el store desde variables de entorno:
+//
+//	IP_ALLOWLIST_FILE   archivo de allowlists (opcional)
+//	TRUSTED_PROXY_HOPS  proxies confiables si el archivo no lo define
+//	                    (default 0)
+//
+// Un valor inválido de TRUSTED_PROXY_HOPS es un error: si se ignorara, un
+// typo dejaría de leer la IP real detrás del proxy sin avisar.
+func StoreFromEnv() (*Store, error) {
+	hops := 0
+	if v := os.Getenv("TRUSTED_PROXY_HOPS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXY_HOPS %q", v)
+		}
+		hops = n
+	}
+	return NewStore(os.Getenv("IP_ALLOWLIST_FILE"), hops)
+}
+
+// NewStore carga el archivo path (si no está vacío). defaultHops se usa
+// cuando el archivo no define trusted_proxy_hops.
+func NewStore(path string, defaultHops int) (*Store, error) {
+	if defaultHops < 0 {
+		return nil, fmt.Errorf("invalid trusted proxy hops %d", defaultHops)
+	}
+	s := &Store{path: path, defaultHops: defaultHops}
+	s.cur.Store(&compiled{providers: map[string][]netip.Prefix{}, hops: defaultHops})
+
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload vuelve a leer el archivo. Si tiene errores se conserva la
+// configuración anterior.
+func (s *Store) Reload() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("read allowlist file: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("parse allowlist file: %w", err)
+	}
+
+	next := &compiled{providers: map[string][]netip.Prefix{}, hops: s.defaultHops}
+	if cfg.TrustedProxyHops != nil {
+		if *cfg.TrustedProxyHops < 0 {
+			return fmt.Errorf("invalid trusted_proxy_hops %d", *cfg.TrustedProxyHops)
+		}
+		next.hops = *cfg.TrustedProxyHops
+	}
+	for provider, list := range cfg.Providers {
+		prefixes, err := ParsePrefixes(list)
+		if err != nil {
+			return fmt.Errorf("provider %s: %w", provider, err)
+		}
+		next.providers[provider] = prefixes
+	}
+
+	s.cur.Store(next)
+	log.Printf("[Allowlist] loaded %s (%d providers, trusted proxy hops=%d)\n", s.path, len(next.providers), next.hops)
+	return nil
+}
+
+// ReloadOn recarga el archivo cada vez que llega alguna de las señales
+// (típicamente SIGHUP). Corre durante toda la vida del proceso.
+func (s *Store) ReloadOn(sigs ...os.Signal) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+
+	go func() {
+		for range ch {
+			if err := s.Reload(); err != nil {
+				log.Printf("[Allowlist] reload failed, keeping previous config: %v\n", err)
+			}
+		}
+	}()
+}
+
+// ProviderAllowed indica si ip puede enviar webhooks de provider.
+func (s *Store) ProviderAllowed(provider, ip string) bool {
+	prefixes := s.cur.Load().providers[provider]
+	if len(prefixes) == 0 {
+		return true
+	}
+	if Contains(prefixes, ip) {
+		return true
+	}
+	rejected.Add("provider", 1)
+	return false
+}
+
+// ClientAllowed aplica la allowlist propia del cliente (vacía = sin límite).
+func ClientAllowed(cidrs []string, ip string) bool {
+	if len(cidrs) == 0 {
+		return true
+	}
+	prefixes, err := ParsePrefixes(cidrs)
+	if err != nil {
+		// se validan al guardarlas, esto no debería pasar
+		log.Printf("[Allowlist] invalid client allowlist: %v\n", err)
+		return false
+	}
+	if Contains(prefixes, ip) {
+		return true
+	}
+	rejected.Add("client", 1)
+	return false
+}
+
+// ExtractIP es un echo.IPExtractor: con N proxies confiables delante toma
+// la N-ésima entrada de X-Forwarded-For contando desde la derecha; con 0
+// usa la IP de la conexión.
+func (s *Store) ExtractIP(r *http.Request) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+
+	hops := s.cur.Load().hops
+	if hops <= 0 {
+		return remote
+	}
+
+	var hopsList []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		for _, part := range strings.Split(h, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				hopsList = append(hopsList, part)
+			}
+		}
+	}
+
+	if len(hopsList) == 0 {
+		return remote
+	}
+
+	// cada proxy confiable agrega la IP que lo llamó al final, así que la
+	// IP real del emisor es la N-ésima desde la derecha; lo que esté más a
+	// la izquierda lo pudo haber inventado el emisor
+	idx := len(hopsList) - hops
+	if idx < 0 {
+		idx = 0
+	}
+	if _, err := netip.ParseAddr(hopsList[idx]); err != nil {
+		return remote
+	}
+	return hopsList[idx]
+}
+
+// ParsePrefixes acepta CIDRs o IPs sueltas.
+func ParsePrefixes(list []string) ([]netip.Prefix, error) {
+	out := make([]netip.Prefix, 0, len(list))
+	for _, v := range list {
+		v = strings.TrimSpace(v)
+		if strings.Contains(v, "/") {
+			p, err := netip.ParsePrefix(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q", v)
+			}
+			out = append(out, p.Masked())
+			continue
+		}
+		a, err := netip.ParseAddr(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP %q", v)
+		}
+		out = append(out, netip.PrefixFrom(a, a.BitLen()))
+	}
+	return out, nil
+}
+
+func Contains(prefixes []netip.Prefix, ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Kmicac/Webhook-Relay/internal/apperr"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// Problem es una respuesta de error RFC 7807 (application/problem+json).
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+	Retryable bool   `json:"retryable"`
+}
+
+// requestID respeta el X-Request-ID entrante (si es razonable) o genera
+// uno nuevo, y lo devuelve en la respuesta.
+func requestID(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id := c.Request().Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			b := make([]byte, 12)
+			_, _ = rand.Read(b)
+			id = hex.EncodeToString(b)
+			c.Request().Header.Set(requestIDHeader, id)
+		}
+		c.Response().Header().Set(requestIDHeader, id)
+		return next(c)
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// errorHandler es el HTTPErrorHandler central: todo error que devuelva un
+// handler termina acá como problem+json.
+func errorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	p := toProblem(err)
+	p.Instance = c.Request().URL.Path
+	p.RequestID = c.Response().Header().Get(requestIDHeader)
+
+	if p.Status >= http.StatusInternalServerError {
+		log.Printf("[API] %s %s failed (request_id=%s): %v\n",
+			c.Request().Method, c.Request().URL.Path, p.RequestID, err)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, "application/problem+json")
+	if c.Request().Method == http.MethodHead {
+		_ = c.NoContent(p.Status)
+		return
+	}
+	_ = c.JSON(p.Status, p)
+}
+
+func toProblem(err error) Problem {
+	if e, ok := apperr.As(err); ok {
+		status := apperr.HTTPStatus(e.Kind)
+		return Problem{
+			Type:      "/problems/" + e.Code,
+			Title:     http.StatusText(status),
+			Status:    status,
+			Detail:    e.Message,
+			Code:      e.Code,
+			Retryable: apperr.Retryable(e.Kind),
+		}
+	}
+
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		code := "http_error"
+		switch he.Code {
+		case http.StatusNotFound:
+			code = "route_not_found"
+		case http.StatusMethodNotAllowed:
+			code = "method_not_allowed"
+		case http.StatusBadRequest:
+			code = "invalid_request"
+		case http.StatusRequestEntityTooLarge:
+			code = "body_too_large"
+		case http.StatusUnsupportedMediaType:
+			code = "unsupported_media_type"
+		}
+
+		detail := http.StatusText(he.Code)
+		if msg, ok := he.Message.(string); ok {
+			detail = msg
+		}
+		return Problem{
+			Type:      "/problems/" + code,
+			Title:     http.StatusText(he.Code),
+			Status:    he.Code,
+			Detail:    detail,
+			Code:      code,
+			Retryable: he.Code == http.StatusTooManyRequests || he.Code >= http.StatusInternalServerError,
+		}
+	}
+
+	return Problem{
+		Type:      "/problems/internal_error",
+		Title:     http.StatusText(http.StatusInternalServerError),
+		Status:    http.StatusInternalServerError,
+		Detail:    "internal error",
+		Code:      "internal_error",
+		Retryable: true,
+	}
+}
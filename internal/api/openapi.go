@@ -0,0 +1,545 @@
+package api
+
+import (
+	"github.com/Kmicac/Webhook-Relay/internal/auth"
+	"github.com/Kmicac/Webhook-Relay/internal/clients"
+	"github.com/Kmicac/Webhook-Relay/internal/openapi"
+	"github.com/Kmicac/Webhook-Relay/internal/payments"
+	"github.com/Kmicac/Webhook-Relay/internal/webhooks"
+)
+
+// apiSpec describe todas las rutas del servidor. Los enums (providers,
+// scopes, estados) salen de las mismas variables que usan los handlers,
+// así no se desincronizan. NewServer verifica al arrancar que cada ruta
+// registrada tenga su operación acá y viceversa.
+func apiSpec() *openapi.Document {
+	doc := &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info: openapi.Info{
+			Title:       "Webhook Relay API",
+			Version:     "1.0.0",
+			Description: "Ingestión de webhooks de pago y API de administración. Los errores se devuelven como application/problem+json (RFC 7807).",
+		},
+		Tags: []openapi.Tag{
+			{Name: "webhooks", Description: "Ingestión de webhooks de los providers"},
+			{Name: "clients", Description: "Clientes y sus providers"},
+			{Name: "events", Description: "Eventos recibidos"},
+			{Name: "payments", Description: "Pagos, reembolsos y disputas"},
+			{Name: "api-keys", Description: "API keys del admin"},
+			{Name: "config", Description: "Configuración en caliente"},
+			{Name: "audit", Description: "Audit log"},
+			{Name: "system", Description: "Health checks, métricas y spec"},
+		},
+		Components: openapi.Components{
+			Schemas: specSchemas(),
+			Responses: map[string]*openapi.Response{
+				"Problem": {
+					Description: "Error (RFC 7807)",
+					Content: map[string]*openapi.MediaType{
+						"application/problem+json": {Schema: ref("Problem")},
+					},
+				},
+			},
+			SecuritySchemes: map[string]*openapi.SecurityScheme{
+				"bearer": {Type: "http", Scheme: "bearer"},
+				"apiKey": {Type: "apiKey", In: "header", Name: "X-API-Key"},
+			},
+		},
+	}
+
+	// SYSTEM
+	doc.Add("GET", "/health", &openapi.Operation{
+		OperationID: "health",
+		Summary:     "Liveness",
+		Tags:        []string{"system"},
+		Responses:   ok("200", "OK", ref("Status")),
+	})
+	doc.Add("GET", "/health/db", &openapi.Operation{
+		OperationID: "healthDB",
+		Summary:     "Readiness: ping a la base y stats del pool",
+		Tags:        []string{"system"},
+		Responses:   ok("200", "OK", object(nil)),
+	})
+	admin(doc, "GET", "/debug/vars", auth.ScopeMetricsRead, &openapi.Operation{
+		OperationID: "debugVars",
+		Summary:     "Métricas expvar (pool, memstats, contadores); sólo keys globales",
+		Tags:        []string{"system"},
+		Responses:   ok("200", "OK", object(nil)),
+	})
+	doc.Add("GET", "/openapi.json", &openapi.Operation{
+		OperationID: "openapi",
+		Summary:     "Este documento",
+		Tags:        []string{"system"},
+		Responses:   ok("200", "OK", object(nil)),
+	})
+
+	// WEBHOOKS
+	doc.Add("POST", "/webhooks/:client_id/:provider/payments", &openapi.Operation{
+		OperationID: "receivePaymentWebhook",
+		Summary:     "Recibe un webhook de pago y lo encola",
+		Tags:        []string{"webhooks"},
+		Parameters: []openapi.Parameter{
+			pathParam("client_id", str()),
+			pathParam("provider", providerEnum()),
+		},
+		RequestBody: jsonBody(object(nil)),
+		Responses: func() map[string]*openapi.Response {
+			r := ok("201", "Encolado", ref("EnqueuedEvent"))
+			r["200"] = &openapi.Response{
+				Description: "Encolado, para los providers que exigen 200 (adyen: el cuerpo es exactamente [accepted]; payu: EnqueuedEvent)",
+				Content: map[string]*openapi.MediaType{
+					"text/plain":       {Schema: enum("[accepted]")},
+					"application/json": {Schema: ref("EnqueuedEvent")},
+				},
+			}
+			return r
+		}(),
+	})
+
+	// ADMIN CLIENTS
+	uid := pathParam("uid", str())
+	provider := pathParam("provider", providerEnum())
+
+	admin(doc, "POST", "/admin/clients", auth.ScopeClientsWrite, &openapi.Operation{
+		OperationID: "createClient",
+		Summary:     "Crea un cliente con su primer provider",
+		Tags:        []string{"clients"},
+		RequestBody: jsonBody(closed(map[string]*openapi.Schema{
+			"client_uid": str(),
+			"provider":   providerEnum(),
+		}, "provider")),
+		Responses: ok("201", "Creado; el secret se muestra sólo esta vez", ref("ClientSecret")),
+	})
+	admin(doc, "GET", "/admin/clients", auth.ScopeClientsRead, &openapi.Operation{
+		OperationID: "listClients",
+		Tags:        []string{"clients"},
+		Parameters:  []openapi.Parameter{queryParam("include_deleted", boolean())},
+		Responses:   ok("200", "OK", array(ref("Client"))),
+	})
+	admin(doc, "GET", "/admin/clients/:uid", auth.ScopeClientsRead, &openapi.Operation{
+		OperationID: "getClient",
+		Tags:        []string{"clients"},
+		Parameters:  []openapi.Parameter{uid},
+		Responses:   ok("200", "OK", ref("Client")),
+	})
+	admin(doc, "PATCH", "/admin/clients/:uid", auth.ScopeClientsWrite, &openapi.Operation{
+		OperationID: "updateClient",
+		Summary:     "Rate limits y allowed_cidrs sólo con una key global",
+		Tags:        []string{"clients"},
+		Parameters:  []openapi.Parameter{uid},
+		RequestBody: jsonBody(closed(map[string]*openapi.Schema{
+			"metadata":         nullable(freeObject()),
+			"rate_limit_rps":   nullable(minimum(number(), 0)),
+			"rate_limit_burst": nullable(minimum(integer(), 0)),
+			"allowed_cidrs":    nullable(array(str())),
+		})),
+		Responses: ok("200", "OK", ref("Client")),
+	})
+	admin(doc, "DELETE", "/admin/clients/:uid", auth.ScopeClientsWrite, &openapi.Operation{
+		OperationID: "deleteClient",
+		Summary:     "Soft delete; los eventos se conservan",
+		Tags:        []string{"clients"},
+		Parameters:  []openapi.Parameter{uid},
+		Responses:   ok("200", "OK", ref("Client")),
+	})
+	admin(doc, "POST", "/admin/clients/:uid/disable", auth.ScopeClientsWrite, &openapi.Operation{
+		OperationID: "disableClient",
+		Summary:     "Sólo con una key global",
+		Tags:        []string{"clients"},
+		Parameters:  []openapi.Parameter{uid},
+		Responses:   ok("200", "OK", ref("Client")),
+	})
+	admin(doc, "POST", "/admin/clients/:uid/enable", auth.ScopeClientsWrite, &openapi.Operation{
+		OperationID: "enableClient",
+		Summary:     "Sólo con una key global",
+		Tags:        []string{"clients"},
+		Parameters:  []openapi.Parameter{uid},
+		Responses:   ok("200", "OK", ref("Client")),
+	})
+	admin(doc, "GET", "/admin/clients/:uid/providers", auth.ScopeClientsRead, &openapi.Operation{
+		OperationID: "listClientProviders",
+		Tags:        []string{"clients"},
+		Parameters:  []openapi.Parameter{uid},
+		Responses:   ok("200", "OK", array(ref("ProviderConfig"))),
+	})
+	admin(doc, "POST", "/admin/clients/:uid/providers", auth.ScopeClientsWrite, &openapi.Operation{
+		OperationID: "addClientProvider",
+		Tags:        []string{"clients"},
+		Parameters:  []openapi.Parameter{uid},
+		RequestBody: jsonBody(closed(map[string]*openapi.Schema{
+			"provider": providerEnum(),
+			"settings": freeObject(),
+		}, "provider")),
+		Responses: ok("201", "Creado; el secret se muestra sólo esta vez", ref("ClientSecret")),
+	})
+	admin(doc, "PATCH", "/admin/clients/:uid/providers/:provider", auth.ScopeClientsWrite, &openapi.Operation{
+		OperationID: "updateClientProvider",
+		Tags:        []string{"clients"},
+		Parameters:  []openapi.Parameter{uid, provider},
+		RequestBody: jsonBody(closed(map[string]*openapi.Schema{
+			"enabled":  nullable(boolean()),
+			"settings": nullable(freeObject()),
+		})),
+		Responses: ok("200", "OK", ref("ProviderConfig")),
+	})
+	admin(doc, "DELETE", "/admin/clients/:uid/providers/:provider", auth.ScopeClientsWrite, &openapi.Operation{
+		OperationID: "removeClientProvider",
+		Tags:        []string{"clients"},
+		Parameters:  []openapi.Parameter{uid, provider},
+		Responses:   map[string]*openapi.Response{"204": {Description: "Eliminado"}, "default": problem()},
+	})
+	admin(doc, "POST", "/admin/clients/:uid/providers/:provider/rotate-secret", auth.ScopeClientsWrite, &openapi.Operation{
+		OperationID: "rotateClientProviderSecret",
+		Tags:        []string{"clients"},
+		Parameters:  []openapi.Parameter{uid, provider},
+		Responses:   ok("200", "Nuevo secret; se muestra sólo esta vez", ref("ClientSecret")),
+	})
+
+	// ADMIN EVENTS
+	eventID := pathParam("id", minimum(integer(), 1))
+
+	admin(doc, "GET", "/admin/events", auth.ScopeEventsRead, &openapi.Operation{
+		OperationID: "listEvents",
+		Tags:        []string{"events"},
+		Parameters: []openapi.Parameter{
+			queryParam("client", str()),
+			queryParam("provider", providerEnum()),
+			queryParam("status", enum(webhooks.Statuses...)),
+			queryParam("after_id", minimum(integer(), 0)),
+			queryParam("before_id", minimum(integer(), 0)),
+			queryParam("limit", minimum(integer(), 0)),
+		},
+		Responses: ok("200", "OK", array(ref("WebhookEvent"))),
+	})
+	admin(doc, "GET", "/admin/events/:id", auth.ScopeEventsRead, &openapi.Operation{
+		OperationID: "getEvent",
+		Tags:        []string{"events"},
+		Parameters:  []openapi.Parameter{eventID},
+		Responses:   ok("200", "OK", ref("EventDetail")),
+	})
+	admin(doc, "POST", "/admin/events/:id/replay", auth.ScopeEventsReplay, &openapi.Operation{
+		OperationID: "replayEvent",
+		Tags:        []string{"events"},
+		Parameters:  []openapi.Parameter{eventID},
+		Responses:   ok("202", "Reencolado", ref("ReplayedEvent")),
+	})
+
+	// ADMIN PAYMENTS
+	admin(doc, "GET", "/admin/payments/:provider/:external_id", auth.ScopeEventsRead, &openapi.Operation{
+		OperationID: "getPaymentBalance",
+		Summary:     "Neto de un pago con sus reembolsos y disputas",
+		Tags:        []string{"payments"},
+		Parameters:  []openapi.Parameter{provider, pathParam("external_id", str()), queryParam("client", str())},
+		Responses:   ok("200", "OK", ref("PaymentBalance")),
+	})
+
+	// ADMIN API KEYS
+	admin(doc, "POST", "/admin/api-keys", auth.ScopeKeysWrite, &openapi.Operation{
+		OperationID: "createAPIKey",
+		Tags:        []string{"api-keys"},
+		RequestBody: jsonBody(closed(map[string]*openapi.Schema{
+			"name":       minLength(str(), 1),
+			"scopes":     minItems(array(enum(auth.AllScopes...)), 1),
+			"client_uid": str(),
+			"expires_at": dateTime(),
+		}, "name", "scopes")),
+		Responses: ok("201", "Creada; la key se muestra sólo esta vez", ref("CreatedAPIKey")),
+	})
+	admin(doc, "GET", "/admin/api-keys", auth.ScopeKeysWrite, &openapi.Operation{
+		OperationID: "listAPIKeys",
+		Tags:        []string{"api-keys"},
+		Responses:   ok("200", "OK", array(ref("APIKey"))),
+	})
+	admin(doc, "DELETE", "/admin/api-keys/:id", auth.ScopeKeysWrite, &openapi.Operation{
+		OperationID: "revokeAPIKey",
+		Tags:        []string{"api-keys"},
+		Parameters:  []openapi.Parameter{pathParam("id", minimum(integer(), 1))},
+		Responses:   map[string]*openapi.Response{"204": {Description: "Revocada"}, "default": problem()},
+	})
+
+	// ADMIN CONFIG
+	admin(doc, "POST", "/admin/allowlist/reload", auth.ScopeClientsWrite, &openapi.Operation{
+		OperationID: "reloadAllowlist",
+		Summary:     "Recarga el archivo de allowlists de IP",
+		Tags:        []string{"config"},
+		Responses:   ok("200", "OK", ref("Status")),
+	})
+
+	// ADMIN AUDIT
+	admin(doc, "GET", "/admin/audit", auth.ScopeAuditRead, &openapi.Operation{
+		OperationID: "listAuditEntries",
+		Tags:        []string{"audit"},
+		Parameters: []openapi.Parameter{
+			queryParam("actor_key_id", integer()),
+			queryParam("action", str()),
+			queryParam("target_type", str()),
+			queryParam("target_id", str()),
+			queryParam("since", dateTime()),
+			queryParam("until", dateTime()),
+			queryParam("before_id", integer()),
+			queryParam("limit", minimum(integer(), 1)),
+		},
+		Responses: ok("200", "OK", array(ref("AuditEntry"))),
+	})
+
+	return doc
+}
+
+func specSchemas() map[string]*openapi.Schema {
+	return map[string]*openapi.Schema{
+		"Problem": object(map[string]*openapi.Schema{
+			"type":       str(),
+			"title":      str(),
+			"status":     integer(),
+			"detail":     str(),
+			"instance":   str(),
+			"code":       str(),
+			"request_id": str(),
+			"retryable":  boolean(),
+		}, "type", "title", "status", "code", "retryable"),
+		"Status": object(map[string]*openapi.Schema{
+			"status": str(),
+		}, "status"),
+		"Client": object(map[string]*openapi.Schema{
+			"id":               integer(),
+			"client_uid":       str(),
+			"metadata":         freeObject(),
+			"providers":        array(ref("ProviderConfig")),
+			"rate_limit_rps":   number(),
+			"rate_limit_burst": integer(),
+			"allowed_cidrs":    array(str()),
+			"disabled_at":      dateTime(),
+			"updated_at":       dateTime(),
+			"deleted_at":       dateTime(),
+		}, "id", "client_uid", "metadata", "providers", "allowed_cidrs"),
+		"ProviderConfig": object(map[string]*openapi.Schema{
+			"id":         integer(),
+			"client_id":  integer(),
+			"provider":   providerEnum(),
+			"settings":   described(freeObject(), "Las credenciales del provider vuelven como \"[redacted:<huella>]\"; mandarlas así en un PATCH las deja como están."),
+			"enabled":    boolean(),
+			"created_at": dateTime(),
+			"updated_at": dateTime(),
+		}, "id", "client_id", "provider", "settings", "enabled", "created_at"),
+		"ClientSecret": object(map[string]*openapi.Schema{
+			"client_uid": str(),
+			"secret":     str(),
+			"provider":   providerEnum(),
+		}, "client_uid", "secret", "provider"),
+		"WebhookEvent": object(map[string]*openapi.Schema{
+			"id":              integer(),
+			"client_id":       integer(),
+			"provider":        str(),
+			"raw_body":        str(),
+			"received_at":     dateTime(),
+			"processed":       boolean(),
+			"processed_at":    dateTime(),
+			"attempts":        integer(),
+			"error_message":   str(),
+			"outcome":         enum(string(payments.OutcomeSaved), string(payments.OutcomeIgnored)),
+			"next_attempt_at": dateTime(),
+			"dead_at":         dateTime(),
+			"status":          enum(webhooks.Statuses...),
+		}, "id", "provider", "raw_body", "received_at", "processed", "attempts", "status"),
+		"EventDetail": object(map[string]*openapi.Schema{
+			"event":    ref("WebhookEvent"),
+			"delivery": nullable(ref("Delivery")),
+			"payment":  nullable(freeObject()),
+		}, "event"),
+		"Delivery": object(map[string]*openapi.Schema{
+			"headers":      mapOf(array(str())),
+			"source_ip":    nullable(str()),
+			"query_string": str(),
+		}, "headers", "query_string"),
+		"EnqueuedEvent": object(map[string]*openapi.Schema{
+			"status":   str(),
+			"event_id": integer(),
+			"provider": str(),
+			"received": dateTime(),
+		}, "status", "event_id"),
+		"ReplayedEvent": object(map[string]*openapi.Schema{
+			"status":   str(),
+			"event_id": integer(),
+		}, "status", "event_id"),
+		"Refund": object(map[string]*openapi.Schema{
+			"id":                  integer(),
+			"provider":            str(),
+			"external_id":         str(),
+			"payment_external_id": str(),
+			"amount":              number(),
+			"currency":            str(),
+			"status":              enum(payments.RefundPending, payments.RefundSucceeded, payments.RefundFailed, payments.RefundCanceled),
+			"reason":              str(),
+			"cumulative":          boolean(),
+			"refunded_at":         dateTime(),
+			"updated_at":          dateTime(),
+		}, "id", "provider", "external_id", "payment_external_id", "amount", "currency", "status", "cumulative", "updated_at"),
+		"Dispute": object(map[string]*openapi.Schema{
+			"id":                  integer(),
+			"provider":            str(),
+			"external_id":         str(),
+			"payment_external_id": str(),
+			"amount":              number(),
+			"currency":            str(),
+			"status":              enum(payments.DisputeNeedsResponse, payments.DisputeUnderReview, payments.DisputeWon, payments.DisputeLost, payments.DisputeClosed),
+			"reason":              str(),
+			"opened_at":           dateTime(),
+			"closed_at":           dateTime(),
+			"updated_at":          dateTime(),
+		}, "id", "provider", "external_id", "payment_external_id", "amount", "currency", "status", "updated_at"),
+		"PaymentBalance": object(map[string]*openapi.Schema{
+			"client_id":     integer(),
+			"provider":      str(),
+			"external_id":   str(),
+			"currency":      str(),
+			"gross":         number(),
+			"refunded":      number(),
+			"disputed_lost": number(),
+			"disputed_open": number(),
+			"net":           number(),
+			"refunds":       array(ref("Refund")),
+			"disputes":      array(ref("Dispute")),
+		}, "provider", "external_id", "currency", "gross", "refunded", "disputed_lost", "disputed_open", "net", "refunds", "disputes"),
+		"APIKey": object(apiKeyProperties(), "id", "name", "prefix", "scopes", "created_at"),
+		"CreatedAPIKey": object(func() map[string]*openapi.Schema {
+			props := apiKeyProperties()
+			props["key"] = str()
+			return props
+		}(), "id", "name", "prefix", "scopes", "created_at", "key"),
+		"AuditEntry": object(map[string]*openapi.Schema{
+			"id":           integer(),
+			"created_at":   dateTime(),
+			"actor_key_id": integer(),
+			"actor_name":   str(),
+			"action":       str(),
+			"target_type":  str(),
+			"target_id":    str(),
+			"before":       freeObject(),
+			"after":        freeObject(),
+			"diff":         freeObject(),
+			"status_code":  integer(),
+			"source_ip":    str(),
+			"method":       str(),
+			"path":         str(),
+		}, "id", "created_at", "actor_name", "action", "status_code"),
+	}
+}
+
+func apiKeyProperties() map[string]*openapi.Schema {
+	return map[string]*openapi.Schema{
+		"id":           integer(),
+		"name":         str(),
+		"prefix":       str(),
+		"scopes":       array(enum(auth.AllScopes...)),
+		"client_id":    integer(),
+		"client_uid":   str(),
+		"expires_at":   dateTime(),
+		"last_used_at": dateTime(),
+		"revoked_at":   dateTime(),
+		"created_at":   dateTime(),
+	}
+}
+
+// admin registra una operación del admin con su seguridad y scope.
+func admin(doc *openapi.Document, method, path, scope string, op *openapi.Operation) {
+	op.Scope = scope
+	op.Security = []map[string][]string{{"bearer": {}}, {"apiKey": {}}}
+	doc.Add(method, path, op)
+}
+
+func ok(status, description string, schema *openapi.Schema) map[string]*openapi.Response {
+	return map[string]*openapi.Response{
+		status: {
+			Description: description,
+			Content:     map[string]*openapi.MediaType{"application/json": {Schema: schema}},
+		},
+		"default": problem(),
+	}
+}
+
+func problem() *openapi.Response {
+	return &openapi.Response{Ref: "#/components/responses/Problem"}
+}
+
+func jsonBody(schema *openapi.Schema) *openapi.RequestBody {
+	return &openapi.RequestBody{
+		Required: true,
+		Content:  map[string]*openapi.MediaType{"application/json": {Schema: schema}},
+	}
+}
+
+func pathParam(name string, schema *openapi.Schema) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "path", Required: true, Schema: schema}
+}
+
+func queryParam(name string, schema *openapi.Schema) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Schema: schema}
+}
+
+func ref(name string) *openapi.Schema {
+	return &openapi.Schema{Ref: "#/components/schemas/" + name}
+}
+
+func str() *openapi.Schema      { return &openapi.Schema{Type: "string"} }
+func integer() *openapi.Schema  { return &openapi.Schema{Type: "integer", Format: "int64"} }
+func number() *openapi.Schema   { return &openapi.Schema{Type: "number"} }
+func boolean() *openapi.Schema  { return &openapi.Schema{Type: "boolean"} }
+func dateTime() *openapi.Schema { return &openapi.Schema{Type: "string", Format: "date-time"} }
+
+func enum(values ...string) *openapi.Schema {
+	return &openapi.Schema{Type: "string", Enum: values}
+}
+
+func providerEnum() *openapi.Schema {
+	return enum(clients.SupportedProviders...)
+}
+
+func array(items *openapi.Schema) *openapi.Schema {
+	return &openapi.Schema{Type: "array", Items: items}
+}
+
+func object(props map[string]*openapi.Schema, required ...string) *openapi.Schema {
+	return &openapi.Schema{Type: "object", Properties: props, Required: required}
+}
+
+// closed es un objeto que rechaza campos desconocidos (bodies de request).
+func closed(props map[string]*openapi.Schema, required ...string) *openapi.Schema {
+	s := object(props, required...)
+	s.AdditionalProperties = false
+	return s
+}
+
+// freeObject es un objeto JSON arbitrario (metadata, settings).
+func freeObject() *openapi.Schema {
+	return &openapi.Schema{Type: "object", AdditionalProperties: true}
+}
+
+// mapOf es un objeto con claves libres y valores del schema dado.
+func mapOf(values *openapi.Schema) *openapi.Schema {
+	return &openapi.Schema{Type: "object", AdditionalProperties: values}
+}
+
+func described(s *openapi.Schema, description string) *openapi.Schema {
+	s.Description = description
+	return s
+}
+
+func nullable(s *openapi.Schema) *openapi.Schema {
+	s.Nullable = true
+	return s
+}
+
+func minimum(s *openapi.Schema, min float64) *openapi.Schema {
+	s.Minimum = &min
+	return s
+}
+
+func minLength(s *openapi.Schema, n int) *openapi.Schema {
+	s.MinLength = &n
+	return s
+}
+
+func minItems(s *openapi.Schema, n int) *openapi.Schema {
+	s.MinItems = &n
+	return s
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Kmicac/Webhook-Relay/internal/clients"
+	"github.com/Kmicac/Webhook-Relay/internal/openapi"
+	"github.com/Kmicac/Webhook-Relay/internal/storage"
+)
+
+// newTestServer arma el router real. El pool no se conecta hasta la
+// primera query, así que alcanza para inspeccionar las rutas sin base.
+func newTestServer(t *testing.T) *echo.Echo {
+	t.Helper()
+	pool, err := pgxpool.New(context.Background(), "postgres://test@127.0.0.1:1/test?sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	e, err := NewServer(&storage.PostgresStore{DB: pool})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	return e
+}
+
+// Toda ruta del router tiene que estar en la spec y toda operación de la
+// spec tiene que tener ruta.
+func TestRoutesMatchSpec(t *testing.T) {
+	e := newTestServer(t)
+	spec := apiSpec()
+
+	registered := map[string]bool{}
+	for _, r := range e.Routes() {
+		if r.Method == echo.RouteNotFound || strings.Contains(r.Path, "*") {
+			continue
+		}
+		registered[r.Method+" "+openapi.Path(r.Path)] = true
+	}
+	documented := map[string]bool{}
+	for _, r := range spec.Routes() {
+		documented[r] = true
+	}
+
+	for r := range registered {
+		if !documented[r] {
+			t.Errorf("route %s is not in the spec", r)
+		}
+	}
+	for r := range documented {
+		if !registered[r] {
+			t.Errorf("spec operation %s has no route", r)
+		}
+	}
+
+	if err := spec.CheckRoutes(e.Routes()); err != nil {
+		t.Errorf("CheckRoutes: %v", err)
+	}
+}
+
+func TestCheckRoutesReportsBothDirections(t *testing.T) {
+	spec := apiSpec()
+
+	e := echo.New()
+	e.GET("/not-documented", func(c echo.Context) error { return nil })
+
+	err := spec.CheckRoutes(e.Routes())
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	msg := err.Error()
+	if !strings.Contains(msg, "GET /not-documented") {
+		t.Errorf("missing route not reported: %s", msg)
+	}
+	if !strings.Contains(msg, "POST /admin/clients") {
+		t.Errorf("stale operation not reported: %s", msg)
+	}
+}
+
+func TestCreateClientProviderEnum(t *testing.T) {
+	spec := apiSpec()
+
+	e := echo.New()
+	e.HTTPErrorHandler = errorHandler
+	e.POST("/admin/clients", func(c echo.Context) error {
+		return c.NoContent(http.StatusCreated)
+	}, spec.Validator)
+
+	type tc struct {
+		name   string
+		body   string
+		status int
+		detail string
+	}
+	var cases []tc
+	for _, p := range clients.SupportedProviders {
+		cases = append(cases, tc{name: p, body: `{"provider":"` + p + `"}`, status: http.StatusCreated})
+	}
+	cases = append(cases,
+		tc{name: "unknown", body: `{"provider":"bitcoin"}`, status: http.StatusBadRequest, detail: "body.provider"},
+		tc{name: "case sensitive", body: `{"provider":"Stripe"}`, status: http.StatusBadRequest, detail: "body.provider"},
+		tc{name: "empty", body: `{"provider":""}`, status: http.StatusBadRequest, detail: "body.provider"},
+		tc{name: "not a string", body: `{"provider":1}`, status: http.StatusBadRequest, detail: "body.provider"},
+		tc{name: "missing", body: `{"client_uid":"acme"}`, status: http.StatusBadRequest, detail: "body.provider"},
+		tc{name: "unknown field", body: `{"provider":"stripe","secret":"x"}`, status: http.StatusBadRequest, detail: "body.secret"},
+	)
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/clients", strings.NewReader(c.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != c.status {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, c.status, rec.Body.String())
+			}
+			if c.detail == "" {
+				return
+			}
+			var p Problem
+			if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+				t.Fatal(err)
+			}
+			if p.Code != "invalid_request" || !strings.HasPrefix(p.Detail, c.detail) {
+				t.Errorf("problem = %s %q, want invalid_request %q...", p.Code, p.Detail, c.detail)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+// Package apperr define los errores de dominio que devuelven repositorios,
+// servicios y handlers. El error handler central de la API los traduce a
+// respuestas problem+json con un código estable.
+package apperr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindValidation
+	KindUnauthorized
+	KindForbidden
+	KindNotFound
+	KindConflict
+	KindGone
+	KindTooLarge
+	KindUnsupportedMedia
+	KindRateLimited
+	KindUnavailable
+)
+
+// Error es un error de dominio. Code es estable y lo pueden usar los
+// clientes para decidir qué hacer; Message es para humanos.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is hace que errors.Is(err, ErrX) funcione aunque el error se haya
+// copiado con Wrap: dos *Error son iguales si tienen el mismo Kind y Code.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Kind == e.Kind && t.Code == e.Code
+}
+
+// Wrap devuelve una copia del error con la causa adjunta.
+func (e *Error) Wrap(err error) *Error {
+	cp := *e
+	cp.Err = err
+	return &cp
+}
+
+func New(kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func Validation(code, message string) *Error {
+	return New(KindValidation, code, message)
+}
+
+func Unauthorized(code, message string) *Error {
+	return New(KindUnauthorized, code, message)
+}
+
+func Forbidden(code, message string) *Error {
+	return New(KindForbidden, code, message)
+}
+
+func NotFound(code, message string) *Error {
+	return New(KindNotFound, code, message)
+}
+
+func Conflict(code, message string) *Error {
+	return New(KindConflict, code, message)
+}
+
+func Unavailable(code, message string) *Error {
+	return New(KindUnavailable, code, message)
+}
+
+func Internal(code, message string) *Error {
+	return New(KindInternal, code, message)
+}
+
+// As extrae el *Error de la cadena, si hay uno.
+func As(err error) (*Error, bool) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
+
+// KindOf devuelve el Kind del error; cualquier error no tipado es interno.
+func KindOf(err error) Kind {
+	if e, ok := As(err); ok {
+		return e.Kind
+	}
+	return KindInternal
+}
+
+func IsNotFound(err error) bool {
+	return KindOf(err) == KindNotFound
+}
+
+// HTTPStatus es el status HTTP que corresponde a cada Kind.
+func HTTPStatus(kind Kind) int {
+	switch kind {
+	case KindValidation:
+		return http.StatusBadRequest
+	case KindUnauthorized:
+		return http.StatusUnauthorized
+	case KindForbidden:
+		return http.StatusForbidden
+	case KindNotFound:
+		return http.StatusNotFound
+	case KindConflict:
+		return http.StatusConflict
+	case KindGone:
+		return http.StatusGone
+	case KindTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case KindUnsupportedMedia:
+		return http.StatusUnsupportedMediaType
+	case KindRateLimited:
+		return http.StatusTooManyRequests
+	case KindUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Retryable indica si vale la pena reintentar el mismo request más tarde.
+func Retryable(kind Kind) bool {
+	switch kind {
+	case KindRateLimited, KindUnavailable, KindInternal:
+		return true
+	}
+	return false
+}
+
+// FromDB traduce un error de pgx: sin filas -> notFound, violación de
+// unique -> conflict, problemas de conexión o timeouts -> unavailable.
+// notFound/conflict pueden ser nil si no aplican.
+func FromDB(err error, notFound, conflict *Error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) && notFound != nil {
+		return notFound.Wrap(err)
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == "23505" && conflict != nil:
+			return conflict.Wrap(err)
+		case pgErr.Code == "57014": // query_canceled (statement_timeout)
+			return dbUnavailable.Wrap(err)
+		case strings.HasPrefix(pgErr.Code, "08"): // connection_exception
+			return dbUnavailable.Wrap(err)
+		}
+		return dbInternal.Wrap(err)
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || pgconn.Timeout(err) || pgconn.SafeToRetry(err) {
+		return dbUnavailable.Wrap(err)
+	}
+
+	var connErr *pgconn.ConnectError
+	var netErr net.Error
+	if errors.As(err, &connErr) || errors.As(err, &netErr) {
+		return dbUnavailable.Wrap(err)
+	}
+
+	return dbInternal.Wrap(err)
+}
+
+var (
+	dbUnavailable = Unavailable("database_unavailable", "database temporarily unavailable")
+	dbInternal    = Internal("database_error", "database error")
+)
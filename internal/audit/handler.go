@@ -0,0 +1,223 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Kmicac/Webhook-Relay/internal/apperr"
+)
+
+const detailsKey = "audit.details"
+
+// insertErrors cuenta, por acción, las entradas que no se pudieron guardar.
+var insertErrors = expvar.NewMap("audit_insert_errors")
+
+type details struct {
+	action     string
+	targetType string
+	targetID   string
+	before     interface{}
+	after      interface{}
+}
+
+// Record deja en el contexto del request qué hizo el handler, para que el
+// middleware lo persista al terminar. before/after se guardan tal cual los
+// serializa encoding/json: quien llama es responsable de no pasar secrets.
+func Record(c echo.Context, action, targetType, targetID string, before, after interface{}) {
+	c.Set(detailsKey, &details{
+		action:     action,
+		targetType: targetType,
+		targetID:   targetID,
+		before:     before,
+		after:      after,
+	})
+}
+
+// ActorFunc resuelve quién hizo el request (id de API key y nombre).
+type ActorFunc func(c echo.Context) (keyID *int64, name string)
+
+type Handler struct {
+	repo  *Repository
+	actor ActorFunc
+}
+
+func NewHandler(repo *Repository, actor ActorFunc) *Handler {
+	return &Handler{
+		repo:  repo,
+		actor: actor,
+	}
+}
+
+// Middleware registra toda request que modifica algo (todo lo que no es
+// GET/HEAD/OPTIONS), haya salido bien o no. Tiene que ir después del
+// middleware de autenticación para conocer al actor.
+func (h *Handler) Middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		switch c.Request().Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return next(c)
+		}
+
+		err := next(c)
+
+		// si el handler devolvió error la respuesta todavía no se escribió:
+		// el status es el que va a poner el error handler
+		status := c.Response().Status
+		var he *echo.HTTPError
+		if e, ok := apperr.As(err); ok {
+			status = apperr.HTTPStatus(e.Kind)
+		} else if errors.As(err, &he) {
+			status = he.Code
+		} else if err != nil {
+			status = http.StatusInternalServerError
+		}
+
+		keyID, name := h.actor(c)
+		entry := &Entry{
+			ActorKeyID: keyID,
+			ActorName:  name,
+			Action:     c.Request().Method + " " + c.Path(),
+			StatusCode: status,
+			SourceIP:   c.RealIP(),
+			Method:     c.Request().Method,
+			Path:       c.Request().URL.Path,
+		}
+
+		if d, ok := c.Get(detailsKey).(*details); ok {
+			entry.Action = d.action
+			entry.TargetType = nonEmpty(d.targetType)
+			entry.TargetID = nonEmpty(d.targetID)
+			entry.Before = toMap(d.before)
+			entry.After = toMap(d.after)
+			entry.Diff = diff(entry.Before, entry.After)
+		}
+
+		// la request ya terminó: no queremos perder la entrada si el
+		// cliente cortó la conexión. Si el handler ya respondió no hay
+		// forma de hacerla fallar, así que la pérdida queda en el log y
+		// en la métrica para poder alertar.
+		ctx := context.WithoutCancel(c.Request().Context())
+		if ierr := h.repo.Insert(ctx, entry); ierr != nil {
+			insertErrors.Add(entry.Action, 1)
+			log.Printf("[Audit] entry lost: action=%s actor=%s path=%s status=%d: %v\n",
+				entry.Action, entry.ActorName, entry.Path, entry.StatusCode, ierr)
+		}
+
+		return err
+	}
+}
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// GET /admin/audit?actor_key_id=&action=&target_type=&target_id=&since=&until=&before_id=&limit=
+func (h *Handler) ListEntries(c echo.Context) error {
+	f := Filter{
+		Action:     c.QueryParam("action"),
+		TargetType: c.QueryParam("target_type"),
+		TargetID:   c.QueryParam("target_id"),
+		Limit:      defaultListLimit,
+	}
+
+	if v := c.QueryParam("actor_key_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return apperr.Validation("invalid_actor_key_id", "invalid actor_key_id")
+		}
+		f.ActorKeyID = &id
+	}
+	if v := c.QueryParam("before_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return apperr.Validation("invalid_before_id", "invalid before_id")
+		}
+		f.BeforeID = id
+	}
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return apperr.Validation("invalid_limit", "invalid limit")
+		}
+		f.Limit = min(n, maxListLimit)
+	}
+	for name, dst := range map[string]**time.Time{"since": &f.Since, "until": &f.Until} {
+		if v := c.QueryParam(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return apperr.Validation("invalid_"+name, "invalid "+name+", expected RFC3339")
+			}
+			*dst = &t
+		}
+	}
+
+	entries, err := h.repo.List(c.Request().Context(), f)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, entries)
+}
+
+func nonEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// toMap pasa v por JSON para guardarlo como objeto.
+func toMap(v interface{}) map[string]interface{} {
+	if v == nil {
+		return nil
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil
+	}
+	return m
+}
+
+// diff devuelve las claves de primer nivel que cambiaron:
+// {"campo": {"before": x, "after": y}}.
+func diff(before, after map[string]interface{}) map[string]interface{} {
+	if before == nil && after == nil {
+		return nil
+	}
+
+	out := map[string]interface{}{}
+	for k, bv := range before {
+		if av, ok := after[k]; !ok || !reflect.DeepEqual(bv, av) {
+			out[k] = map[string]interface{}{"before": bv, "after": after[k]}
+		}
+	}
+	for k, av := range after {
+		if _, ok := before[k]; !ok {
+			out[k] = map[string]interface{}{"before": nil, "after": av}
+		}
+	}
+
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
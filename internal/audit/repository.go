@@ -0,0 +1,137 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Kmicac/Webhook-Relay/internal/apperr"
+	"github.com/Kmicac/Webhook-Relay/internal/storage"
+)
+
+// Entry es una acción registrada en audit_log.
+type Entry struct {
+	ID         int64                  `json:"id"`
+	CreatedAt  time.Time              `json:"created_at"`
+	ActorKeyID *int64                 `json:"actor_key_id,omitempty"`
+	ActorName  string                 `json:"actor_name"`
+	Action     string                 `json:"action"`
+	TargetType *string                `json:"target_type,omitempty"`
+	TargetID   *string                `json:"target_id,omitempty"`
+	Before     map[string]interface{} `json:"before,omitempty"`
+	After      map[string]interface{} `json:"after,omitempty"`
+	Diff       map[string]interface{} `json:"diff,omitempty"`
+	StatusCode int                    `json:"status_code"`
+	SourceIP   string                 `json:"source_ip"`
+	Method     string                 `json:"method"`
+	Path       string                 `json:"path"`
+}
+
+// Filter son los filtros de GET /admin/audit.
+type Filter struct {
+	ActorKeyID *int64
+	Action     string
+	TargetType string
+	TargetID   string
+	Since      *time.Time
+	Until      *time.Time
+	BeforeID   int64
+	Limit      int
+}
+
+type Repository struct {
+	db *storage.PostgresStore
+}
+
+func NewRepository(store *storage.PostgresStore) *Repository {
+	return &Repository{db: store}
+}
+
+func (r *Repository) Insert(ctx context.Context, e *Entry) error {
+	return r.db.DB.QueryRow(
+		ctx,
+		`INSERT INTO audit_log (actor_key_id, actor_name, action, target_type, target_id,
+                                before, after, diff, status_code, source_ip, method, path)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+         RETURNING id, created_at`,
+		e.ActorKeyID, e.ActorName, e.Action, e.TargetType, e.TargetID,
+		e.Before, e.After, e.Diff, e.StatusCode, e.SourceIP, e.Method, e.Path,
+	).Scan(&e.ID, &e.CreatedAt)
+}
+
+func (r *Repository) List(ctx context.Context, f Filter) ([]Entry, error) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if f.ActorKeyID != nil {
+		conds = append(conds, "actor_key_id = "+arg(*f.ActorKeyID))
+	}
+	if f.Action != "" {
+		conds = append(conds, "action = "+arg(f.Action))
+	}
+	if f.TargetType != "" {
+		conds = append(conds, "target_type = "+arg(f.TargetType))
+	}
+	if f.TargetID != "" {
+		conds = append(conds, "target_id = "+arg(f.TargetID))
+	}
+	if f.Since != nil {
+		conds = append(conds, "created_at >= "+arg(*f.Since))
+	}
+	if f.Until != nil {
+		conds = append(conds, "created_at < "+arg(*f.Until))
+	}
+	if f.BeforeID > 0 {
+		conds = append(conds, "id < "+arg(f.BeforeID))
+	}
+
+	query := `SELECT id, created_at, actor_key_id, actor_name, action, target_type, target_id,
+                     before, after, diff, status_code, COALESCE(source_ip, ''), method, path
+              FROM audit_log`
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT " + arg(f.Limit)
+
+	rows, err := r.db.DB.Query(ctx, query, args...)
+	if err != nil {
+		log.Printf("[AuditRepository] error listing entries: %v\n", err)
+		return nil, apperr.FromDB(err, nil, nil)
+	}
+	defer rows.Close()
+
+	result := []Entry{}
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(
+			&e.ID,
+			&e.CreatedAt,
+			&e.ActorKeyID,
+			&e.ActorName,
+			&e.Action,
+			&e.TargetType,
+			&e.TargetID,
+			&e.Before,
+			&e.After,
+			&e.Diff,
+			&e.StatusCode,
+			&e.SourceIP,
+			&e.Method,
+			&e.Path,
+		); err != nil {
+			return nil, apperr.FromDB(err, nil, nil)
+		}
+		result = append(result, e)
+	}
+
+	return result, apperr.FromDB(rows.Err(), nil, nil)
+}
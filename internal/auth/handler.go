@@ -0,0 +1,284 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Kmicac/Webhook-Relay/internal/apperr"
+	"github.com/Kmicac/Webhook-Relay/internal/audit"
+)
+
+const principalKey = "principal"
+
+var (
+	ErrUnauthorized    = apperr.Unauthorized("unauthorized", "unauthorized")
+	errAuthUnavailable = apperr.Unavailable("auth_unavailable", "auth unavailable")
+	// mismo Kind y Code que clients.ErrClientNotFound: para otro tenant el
+	// cliente "no existe"
+	errClientHidden = apperr.NotFound("client_not_found", "client not found")
+)
+
+// Principal es quien hace el request al admin: el master token o una API key.
+type Principal struct {
+	KeyID     *int64
+	Name      string
+	Scopes    []string
+	ClientID  *int64 // si no es nil, sólo puede ver datos de ese cliente
+	ClientUID *string
+	Master    bool
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	if p.Master {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccessClient indica si el principal puede operar sobre el cliente uid.
+func (p *Principal) CanAccessClient(uid string) bool {
+	return p.ClientUID == nil || *p.ClientUID == uid
+}
+
+// Actor adapta el principal para el audit log.
+func Actor(c echo.Context) (*int64, string) {
+	p := PrincipalFrom(c)
+	if p == nil {
+		return nil, "anonymous"
+	}
+	return p.KeyID, p.Name
+}
+
+// PrincipalFrom devuelve el principal autenticado del request.
+// Sin middleware de auth devuelve nil.
+func PrincipalFrom(c echo.Context) *Principal {
+	p, _ := c.Get(principalKey).(*Principal)
+	return p
+}
+
+type Handler struct {
+	repo        *Repository
+	masterToken string
+}
+
+func NewHandler(repo *Repository, masterToken string) *Handler {
+	return &Handler{
+		repo:        repo,
+		masterToken: masterToken,
+	}
+}
+
+// Authenticate acepta el master token o una API key en
+// "Authorization: Bearer <key>", "X-API-Key" o "X-Admin-Token" (legacy).
+func (h *Handler) Authenticate(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		token := credentialFrom(c.Request())
+		if token == "" {
+			return ErrUnauthorized
+		}
+
+		if h.masterToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.masterToken)) == 1 {
+			c.Set(principalKey, &Principal{Name: "master", Master: true})
+			return next(c)
+		}
+
+		ctx := c.Request().Context()
+		key, err := h.repo.FindByPlainKey(ctx, token)
+		if errors.Is(err, ErrKeyNotFound) {
+			return ErrUnauthorized
+		}
+		if err != nil {
+			log.Printf("[Auth] error looking up api key: %v\n", err)
+			return errAuthUnavailable.Wrap(err)
+		}
+		if !key.Active(time.Now()) {
+			return ErrUnauthorized
+		}
+
+		if err := h.repo.TouchLastUsed(ctx, key.ID); err != nil {
+			log.Printf("[Auth] error updating last_used_at (key=%d): %v\n", key.ID, err)
+		}
+
+		c.Set(principalKey, &Principal{
+			KeyID:     &key.ID,
+			Name:      key.Name,
+			Scopes:    key.Scopes,
+			ClientID:  key.ClientID,
+			ClientUID: key.ClientUID,
+		})
+		return next(c)
+	}
+}
+
+// RequireScope corta con 403 si el principal no tiene el scope.
+func RequireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			p := PrincipalFrom(c)
+			if p == nil || !p.HasScope(scope) {
+				return apperr.Forbidden("missing_scope", "missing scope "+scope)
+			}
+			return next(c)
+		}
+	}
+}
+
+// RequireClientParam restringe las rutas /clients/:param a keys del mismo
+// cliente. Para keys de otro tenant respondemos 404 y no 403, así no se
+// filtra qué clientes existen.
+func RequireClientParam(param string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			p := PrincipalFrom(c)
+			if p == nil || !p.CanAccessClient(c.Param(param)) {
+				return errClientHidden
+			}
+			return next(c)
+		}
+	}
+}
+
+// RequireGlobal rechaza keys limitadas a un cliente (p.ej. para crear clientes).
+func RequireGlobal(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		p := PrincipalFrom(c)
+		if p == nil || p.ClientUID != nil {
+			return apperr.Forbidden("global_key_required", "not allowed for client-scoped keys")
+		}
+		return next(c)
+	}
+}
+
+type createKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ClientUID string     `json:"client_uid"` // opcional, limita la key a un cliente
+	ExpiresAt *time.Time `json:"expires_at"` // opcional
+}
+
+type createKeyResponse struct {
+	*APIKey
+	Key string `json:"key"` // lo mostramos solo una vez
+}
+
+// POST /admin/api-keys
+func (h *Handler) CreateKey(c echo.Context) error {
+	var req createKeyRequest
+	if err := c.Bind(&req); err != nil {
+		return apperr.Validation("invalid_body", "invalid body").Wrap(err)
+	}
+
+	if req.Name == "" {
+		return apperr.Validation("name_required", "name is required")
+	}
+	if len(req.Scopes) == 0 {
+		return apperr.Validation("scopes_required", "at least one scope is required")
+	}
+	for _, s := range req.Scopes {
+		if !IsValidScope(s) {
+			return apperr.Validation("invalid_scope", "invalid scope "+s)
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return apperr.Validation("invalid_expires_at", "expires_at must be in the future")
+	}
+
+	// una key no puede dar más de lo que tiene quien la crea
+	p := PrincipalFrom(c)
+	for _, s := range req.Scopes {
+		if !p.HasScope(s) {
+			return apperr.Forbidden("scope_not_grantable", "cannot grant scope "+s)
+		}
+	}
+	if p.ClientUID != nil {
+		if req.ClientUID != "" && req.ClientUID != *p.ClientUID {
+			return apperr.Forbidden("foreign_client", "cannot create keys for another client")
+		}
+		req.ClientUID = *p.ClientUID
+	}
+
+	key, plain, err := h.repo.Create(c.Request().Context(), req.Name, req.Scopes, req.ClientUID, req.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	audit.Record(c, "api_key.create", "api_key", strconv.FormatInt(key.ID, 10), nil, key)
+
+	return c.JSON(http.StatusCreated, createKeyResponse{APIKey: key, Key: plain})
+}
+
+// GET /admin/api-keys
+func (h *Handler) ListKeys(c echo.Context) error {
+	keys, err := h.repo.List(c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	p := PrincipalFrom(c)
+	if p.ClientUID != nil {
+		own := []APIKey{}
+		for _, k := range keys {
+			if k.ClientUID != nil && *k.ClientUID == *p.ClientUID {
+				own = append(own, k)
+			}
+		}
+		keys = own
+	}
+
+	return c.JSON(http.StatusOK, keys)
+}
+
+// DELETE /admin/api-keys/:id
+func (h *Handler) RevokeKey(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return apperr.Validation("invalid_key_id", "invalid key id")
+	}
+
+	ctx := c.Request().Context()
+	key, err := h.repo.FindByID(ctx, id)
+	if err == nil && !PrincipalFrom(c).CanAccessClient(derefOr(key.ClientUID, "")) {
+		err = ErrKeyNotFound
+	}
+	if err == nil {
+		err = h.repo.Revoke(ctx, id)
+	}
+	if err != nil {
+		return err
+	}
+
+	audit.Record(c, "api_key.revoke", "api_key", c.Param("id"), key, nil)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func credentialFrom(r *http.Request) string {
+	if v := r.Header.Get("Authorization"); v != "" {
+		if token, ok := strings.CutPrefix(v, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	if v := r.Header.Get("X-API-Key"); v != "" {
+		return v
+	}
+	return r.Header.Get("X-Admin-Token")
+}
+
+func derefOr(s *string, def string) string {
+	if s == nil {
+		return def
+	}
+	return *s
+}
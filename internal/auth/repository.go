@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Kmicac/Webhook-Relay/internal/apperr"
+	"github.com/Kmicac/Webhook-Relay/internal/storage"
+)
+
+// Scopes de la API de admin.
+const (
+	ScopeClientsRead  = "clients:read"
+	ScopeClientsWrite = "clients:write"
+	ScopeEventsRead   = "events:read"
+	ScopeEventsReplay = "events:replay"
+	ScopeKeysWrite    = "keys:write"
+	ScopeAuditRead    = "audit:read"
+	ScopeMetricsRead  = "metrics:read"
+)
+
+var AllScopes = []string{
+	ScopeClientsRead,
+	ScopeClientsWrite,
+	ScopeEventsRead,
+	ScopeEventsReplay,
+	ScopeKeysWrite,
+	ScopeAuditRead,
+	ScopeMetricsRead,
+}
+
+func IsValidScope(s string) bool {
+	for _, v := range AllScopes {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKey es una key del admin. La key en claro sólo se conoce al crearla.
+type APIKey struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ClientID   *int64     `json:"client_id,omitempty"`
+	ClientUID  *string    `json:"client_uid,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (k *APIKey) Active(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
+
+var (
+	ErrKeyNotFound    = apperr.NotFound("api_key_not_found", "api key not found")
+	ErrClientNotFound = apperr.Validation("unknown_client", "client not found")
+)
+
+type Repository struct {
+	db *storage.PostgresStore
+}
+
+func NewRepository(store *storage.PostgresStore) *Repository {
+	return &Repository{db: store}
+}
+
+const keyColumns = `k.id, k.name, k.key_prefix, k.scopes, k.client_id, c.client_uid,
+                    k.expires_at, k.last_used_at, k.revoked_at, k.created_at`
+
+const keyFrom = `api_keys k LEFT JOIN clients c ON c.id = k.client_id`
+
+func scanKey(row pgx.Row) (*APIKey, error) {
+	var k APIKey
+	if err := row.Scan(
+		&k.ID,
+		&k.Name,
+		&k.Prefix,
+		&k.Scopes,
+		&k.ClientID,
+		&k.ClientUID,
+		&k.ExpiresAt,
+		&k.LastUsedAt,
+		&k.RevokedAt,
+		&k.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// Create genera una key nueva y devuelve la key en claro junto al registro.
+// Si clientUID no está vacío la key queda limitada a ese cliente.
+func (r *Repository) Create(ctx context.Context, name string, scopes []string, clientUID string, expiresAt *time.Time) (*APIKey, string, error) {
+	var clientID *int64
+	if clientUID != "" {
+		var id int64
+		err := r.db.DB.QueryRow(
+			ctx,
+			`SELECT id FROM clients WHERE client_uid = $1 AND deleted_at IS NULL`,
+			clientUID,
+		).Scan(&id)
+		if err != nil {
+			return nil, "", apperr.FromDB(err, ErrClientNotFound, nil)
+		}
+		clientID = &id
+	}
+
+	plain, prefix, err := generateKey()
+	if err != nil {
+		return nil, "", apperr.Internal("key_generation_failed", "failed to generate api key").Wrap(err)
+	}
+
+	var id int64
+	err = r.db.DB.QueryRow(
+		ctx,
+		`INSERT INTO api_keys (name, key_prefix, key_hash, scopes, client_id, expires_at)
+         VALUES ($1, $2, $3, $4, $5, $6)
+         RETURNING id`,
+		name, prefix, hashKey(plain), scopes, clientID, expiresAt,
+	).Scan(&id)
+	if err != nil {
+		log.Printf("[AuthRepository] error creating api key: %v\n", err)
+		return nil, "", apperr.FromDB(err, nil, nil)
+	}
+
+	k, err := r.FindByID(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+	return k, plain, nil
+}
+
+func (r *Repository) FindByID(ctx context.Context, id int64) (*APIKey, error) {
+	k, err := scanKey(r.db.DB.QueryRow(
+		ctx,
+		`SELECT `+keyColumns+` FROM `+keyFrom+` WHERE k.id = $1`,
+		id,
+	))
+	if err != nil {
+		return nil, apperr.FromDB(err, ErrKeyNotFound, nil)
+	}
+	return k, nil
+}
+
+// FindByPlainKey busca una key por el hash de su valor en claro.
+func (r *Repository) FindByPlainKey(ctx context.Context, plain string) (*APIKey, error) {
+	k, err := scanKey(r.db.DB.QueryRow(
+		ctx,
+		`SELECT `+keyColumns+` FROM `+keyFrom+` WHERE k.key_hash = $1`,
+		hashKey(plain),
+	))
+	if err != nil {
+		return nil, apperr.FromDB(err, ErrKeyNotFound, nil)
+	}
+	return k, nil
+}
+
+func (r *Repository) List(ctx context.Context) ([]APIKey, error) {
+	rows, err := r.db.DB.Query(
+		ctx,
+		`SELECT `+keyColumns+` FROM `+keyFrom+` ORDER BY k.id DESC`,
+	)
+	if err != nil {
+		log.Printf("[AuthRepository] error listing api keys: %v\n", err)
+		return nil, apperr.FromDB(err, nil, nil)
+	}
+	defer rows.Close()
+
+	result := []APIKey{}
+	for rows.Next() {
+		k, err := scanKey(rows)
+		if err != nil {
+			return nil, apperr.FromDB(err, nil, nil)
+		}
+		result = append(result, *k)
+	}
+
+	return result, apperr.FromDB(rows.Err(), nil, nil)
+}
+
+func (r *Repository) Revoke(ctx context.Context, id int64) error {
+	tag, err := r.db.DB.Exec(
+		ctx,
+		`UPDATE api_keys SET revoked_at = COALESCE(revoked_at, NOW()) WHERE id = $1`,
+		id,
+	)
+	if err != nil {
+		return apperr.FromDB(err, nil, nil)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+// TouchLastUsed actualiza last_used_at como mucho una vez por minuto
+// para no escribir en cada request.
+func (r *Repository) TouchLastUsed(ctx context.Context, id int64) error {
+	_, err := r.db.DB.Exec(
+		ctx,
+		`UPDATE api_keys
+         SET last_used_at = NOW()
+         WHERE id = $1
+           AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`,
+		id,
+	)
+	return err
+}
+
+// generateKey arma una key "wr_<prefix>_<secret>". El prefix se guarda
+// en claro para poder identificar la key en listados.
+func generateKey() (plain, prefix string, err error) {
+	b := make([]byte, 28)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	prefix = hex.EncodeToString(b[:4])
+	plain = "wr_" + prefix + "_" + hex.EncodeToString(b[4:])
+	return plain, prefix, nil
+}
+
+func hashKey(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
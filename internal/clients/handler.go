@@ -3,39 +3,45 @@ package clients
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"fmt"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
+
+	"github.com/Kmicac/Webhook-Relay/internal/allowlist"
+	"github.com/Kmicac/Webhook-Relay/internal/apperr"
+	"github.com/Kmicac/Webhook-Relay/internal/audit"
+	"github.com/Kmicac/Webhook-Relay/internal/auth"
+	"github.com/Kmicac/Webhook-Relay/internal/generic"
+	"github.com/Kmicac/Webhook-Relay/internal/payments"
+)
+
+var (
+	errInvalidBody          = apperr.Validation("invalid_body", "invalid body")
+	errNothingToUpdate      = apperr.Validation("nothing_to_update", "nothing to update")
+	errProviderRequired     = apperr.Validation("provider_required", "provider is required")
+	errUnsupportedProvider  = apperr.Validation("unsupported_provider", "unsupported provider")
+	errInvalidRateLimit     = apperr.Validation("invalid_rate_limit", "rate limits must be positive")
+	errSecretGeneration     = apperr.Internal("secret_generation_failed", "failed to generate secret")
+	errInvalidHMACKey       = apperr.Validation("invalid_hmac_key", "settings.hmac_key must be a hex string")
+	errInvalidSettings      = apperr.Validation("invalid_settings", "provider settings must be non-empty strings")
+	errInvalidGenericConfig = apperr.Validation("invalid_generic_config", "invalid generic provider settings")
+	errOperatorOnlyFields   = apperr.Forbidden("global_key_required", "rate limits and allowed_cidrs can only be changed with a global key")
 )
 
 type Handler struct {
-	repo       *Repository
-	adminToken string
+	repo *Repository
 }
 
-func NewHandler(repo *Repository, adminToken string) *Handler {
+func NewHandler(repo *Repository) *Handler {
 	return &Handler{
-		repo:       repo,
-		adminToken: adminToken,
-	}
-}
-
-// middleware simple para admin
-func (h *Handler) RequireAdmin(next echo.HandlerFunc) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		token := c.Request().Header.Get("X-Admin-Token")
-		if token == "" || token != h.adminToken {
-			return c.JSON(http.StatusUnauthorized, map[string]string{
-				"error": "unauthorized",
-			})
-		}
-		return next(c)
+		repo: repo,
 	}
 }
 
 type createClientRequest struct {
 	ClientUID string `json:"client_uid"` // opcional, si vacío generamos uno
-	Provider  string `json:"provider"`   // "mercadopago", "stripe", "paypal"
+	Provider  string `json:"provider"`   // uno de SupportedProviders
 }
 
 type createClientResponse struct {
@@ -48,60 +54,362 @@ type createClientResponse struct {
 func (h *Handler) CreateClient(c echo.Context) error {
 	var req createClientRequest
 	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "invalid body",
-		})
+		return errInvalidBody.Wrap(err)
 	}
 
 	if req.Provider == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "provider is required",
-		})
+		return errProviderRequired
+	}
+
+	if !IsSupportedProvider(req.Provider) {
+		return errUnsupportedProvider
 	}
 
 	if req.ClientUID == "" {
 		uid, err := generateRandomHex(8)
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{
-				"error": "failed to generate client uid",
-			})
+			return errSecretGeneration.Wrap(err)
 		}
 		req.ClientUID = uid
 	}
 
 	secret, err := generateRandomHex(32)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to generate secret",
-		})
+		return errSecretGeneration.Wrap(err)
 	}
 
-	client, err := h.repo.Create(req.ClientUID, secret, req.Provider)
+	client, err := h.repo.Create(req.ClientUID, req.Provider, secret)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to create client",
-		})
+		return err
 	}
 
+	audit.Record(c, "client.create", "client", client.UID, nil, client)
+
 	return c.JSON(http.StatusCreated, createClientResponse{
 		ClientUID: client.UID,
 		Secret:    secret,
-		Provider:  client.Provider,
+		Provider:  req.Provider,
 	})
 }
 
-// GET /admin/clients
+// GET /admin/clients?include_deleted=true
 func (h *Handler) ListClients(c echo.Context) error {
-	clients, err := h.repo.List()
+	includeDeleted := c.QueryParam("include_deleted") == "true"
+
+	clients, err := h.repo.List(includeDeleted)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to list clients",
-		})
+		return err
+	}
+
+	// las keys de un tenant sólo ven su propio cliente
+	if p := auth.PrincipalFrom(c); p != nil && p.ClientUID != nil {
+		own := []Client{}
+		for _, cl := range clients {
+			if cl.UID == *p.ClientUID {
+				own = append(own, cl)
+			}
+		}
+		clients = own
+	}
+
+	if clients == nil {
+		clients = []Client{}
 	}
 
 	return c.JSON(http.StatusOK, clients)
 }
 
+// GET /admin/clients/:uid
+func (h *Handler) GetClient(c echo.Context) error {
+	client, err := h.repo.FindByUID(c.Param("uid"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, client)
+}
+
+type updateClientRequest struct {
+	Metadata       map[string]interface{} `json:"metadata"`         // se mergea; null borra la clave
+	RateLimitRPS   *float64               `json:"rate_limit_rps"`   // 0 vuelve al default
+	RateLimitBurst *int                   `json:"rate_limit_burst"` // 0 vuelve al default
+	AllowedCIDRs   *[]string              `json:"allowed_cidrs"`    // reemplaza la lista
+}
+
+// PATCH /admin/clients/:uid
+func (h *Handler) UpdateClient(c echo.Context) error {
+	var req updateClientRequest
+	if err := c.Bind(&req); err != nil {
+		return errInvalidBody.Wrap(err)
+	}
+
+	if req.Metadata == nil && req.RateLimitRPS == nil && req.RateLimitBurst == nil && req.AllowedCIDRs == nil {
+		return errNothingToUpdate
+	}
+
+	// los límites y los rangos de IP los pone el operador: una key del
+	// tenant no puede subirse el rate limit ni abrir su allowlist
+	if p := auth.PrincipalFrom(c); p != nil && p.ClientUID != nil &&
+		(req.RateLimitRPS != nil || req.RateLimitBurst != nil || req.AllowedCIDRs != nil) {
+		return errOperatorOnlyFields
+	}
+
+	if (req.RateLimitRPS != nil && *req.RateLimitRPS < 0) || (req.RateLimitBurst != nil && *req.RateLimitBurst < 0) {
+		return errInvalidRateLimit
+	}
+
+	if req.AllowedCIDRs != nil {
+		if _, err := allowlist.ParsePrefixes(*req.AllowedCIDRs); err != nil {
+			return apperr.Validation("invalid_cidr", err.Error())
+		}
+	}
+
+	before := h.snapshot(c.Param("uid"))
+
+	client, err := h.repo.Update(c.Param("uid"), ClientUpdate{
+		Metadata:       req.Metadata,
+		RateLimitRPS:   req.RateLimitRPS,
+		RateLimitBurst: req.RateLimitBurst,
+		AllowedCIDRs:   req.AllowedCIDRs,
+	})
+	if err != nil {
+		return err
+	}
+
+	audit.Record(c, "client.update", "client", client.UID, before, client)
+
+	return c.JSON(http.StatusOK, client)
+}
+
+// POST /admin/clients/:uid/enable
+func (h *Handler) EnableClient(c echo.Context) error {
+	before := h.snapshot(c.Param("uid"))
+
+	client, err := h.repo.Enable(c.Param("uid"))
+	if err != nil {
+		return err
+	}
+
+	audit.Record(c, "client.enable", "client", client.UID, before, client)
+
+	return c.JSON(http.StatusOK, client)
+}
+
+// DELETE /admin/clients/:uid (soft delete, los eventos se conservan)
+func (h *Handler) DeleteClient(c echo.Context) error {
+	before := h.snapshot(c.Param("uid"))
+
+	client, err := h.repo.SoftDelete(c.Param("uid"))
+	if err != nil {
+		return err
+	}
+
+	audit.Record(c, "client.delete", "client", client.UID, before, client)
+
+	return c.JSON(http.StatusOK, client)
+}
+
+// POST /admin/clients/:uid/disable
+func (h *Handler) DisableClient(c echo.Context) error {
+	before := h.snapshot(c.Param("uid"))
+
+	client, err := h.repo.Disable(c.Param("uid"))
+	if err != nil {
+		return err
+	}
+
+	audit.Record(c, "client.disable", "client", client.UID, before, client)
+
+	return c.JSON(http.StatusOK, client)
+}
+
+// activeClient busca el cliente de la URL; los borrados cuentan como inexistentes.
+func (h *Handler) activeClient(c echo.Context) (*Client, error) {
+	client, err := h.repo.FindByUID(c.Param("uid"))
+	if err != nil {
+		return nil, err
+	}
+	if client.Deleted() {
+		return nil, ErrClientNotFound
+	}
+	return client, nil
+}
+
+// GET /admin/clients/:uid/providers
+func (h *Handler) ListProviders(c echo.Context) error {
+	client, err := h.activeClient(c)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, client.Providers)
+}
+
+type addProviderRequest struct {
+	Provider string                 `json:"provider"`
+	Settings map[string]interface{} `json:"settings"`
+}
+
+// POST /admin/clients/:uid/providers
+func (h *Handler) AddProvider(c echo.Context) error {
+	var req addProviderRequest
+	if err := c.Bind(&req); err != nil {
+		return errInvalidBody.Wrap(err)
+	}
+
+	if !IsSupportedProvider(req.Provider) {
+		return errUnsupportedProvider
+	}
+
+	if err := validateSettings(req.Provider, req.Settings); err != nil {
+		return err
+	}
+	// el generic no sirve sin firma y mapping: se exigen al darlo de alta
+	if req.Provider == "generic" {
+		if _, err := generic.ParseConfig(req.Settings); err != nil {
+			return errInvalidGenericConfig.Wrap(err)
+		}
+	}
+
+	client, err := h.activeClient(c)
+	if err != nil {
+		return err
+	}
+
+	secret, err := generateRandomHex(32)
+	if err != nil {
+		return errSecretGeneration.Wrap(err)
+	}
+
+	cfg, err := h.repo.AddProvider(client.ID, req.Provider, secret, req.Settings)
+	if err != nil {
+		return err
+	}
+
+	audit.Record(c, "client.provider.add", "client_provider", providerTarget(client, cfg.Provider), nil, cfg)
+
+	return c.JSON(http.StatusCreated, createClientResponse{
+		ClientUID: client.UID,
+		Secret:    secret,
+		Provider:  req.Provider,
+	})
+}
+
+type updateProviderRequest struct {
+	Enabled  *bool                  `json:"enabled"`
+	Settings map[string]interface{} `json:"settings"` // se mergea; null borra la clave
+}
+
+// PATCH /admin/clients/:uid/providers/:provider
+func (h *Handler) UpdateProvider(c echo.Context) error {
+	var req updateProviderRequest
+	if err := c.Bind(&req); err != nil {
+		return errInvalidBody.Wrap(err)
+	}
+
+	if req.Enabled == nil && req.Settings == nil {
+		return errNothingToUpdate
+	}
+
+	// un secret redactado que vuelve tal cual significa "no cambia": se
+	// saca del merge y queda el guardado
+	for _, k := range secretSettings[c.Param("provider")] {
+		if isRedacted(req.Settings[k]) {
+			delete(req.Settings, k)
+		}
+	}
+
+	if err := validateSettings(c.Param("provider"), req.Settings); err != nil {
+		return err
+	}
+
+	client, err := h.activeClient(c)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := h.repo.UpdateProvider(client.ID, c.Param("provider"), ProviderUpdate{
+		Enabled:  req.Enabled,
+		Settings: req.Settings,
+	})
+	if err != nil {
+		return err
+	}
+
+	audit.Record(c, "client.provider.update", "client_provider", providerTarget(client, cfg.Provider),
+		findProvider(client, cfg.Provider), cfg)
+
+	return c.JSON(http.StatusOK, cfg)
+}
+
+// DELETE /admin/clients/:uid/providers/:provider
+func (h *Handler) RemoveProvider(c echo.Context) error {
+	client, err := h.activeClient(c)
+	if err != nil {
+		return err
+	}
+
+	provider := c.Param("provider")
+	if err := h.repo.RemoveProvider(client.ID, provider); err != nil {
+		return err
+	}
+
+	audit.Record(c, "client.provider.remove", "client_provider", providerTarget(client, provider),
+		findProvider(client, provider), nil)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// POST /admin/clients/:uid/providers/:provider/rotate-secret
+func (h *Handler) RotateSecret(c echo.Context) error {
+	client, err := h.activeClient(c)
+	if err != nil {
+		return err
+	}
+
+	secret, err := generateRandomHex(32)
+	if err != nil {
+		return errSecretGeneration.Wrap(err)
+	}
+
+	cfg, err := h.repo.RotateSecret(client.ID, c.Param("provider"), secret)
+	if err != nil {
+		return err
+	}
+
+	// el secret no se serializa, queda registrado sólo el cambio de updated_at
+	audit.Record(c, "client.provider.rotate_secret", "client_provider", providerTarget(client, cfg.Provider),
+		findProvider(client, cfg.Provider), cfg)
+
+	return c.JSON(http.StatusOK, createClientResponse{
+		ClientUID: client.UID,
+		Secret:    secret,
+		Provider:  cfg.Provider,
+	})
+}
+
+// snapshot devuelve el estado actual del cliente para el audit log.
+func (h *Handler) snapshot(uid string) *Client {
+	client, err := h.repo.FindByUID(uid)
+	if err != nil {
+		return nil
+	}
+	return client
+}
+
+func findProvider(client *Client, provider string) *ProviderConfig {
+	for i := range client.Providers {
+		if client.Providers[i].Provider == provider {
+			return &client.Providers[i]
+		}
+	}
+	return nil
+}
+
+func providerTarget(client *Client, provider string) string {
+	return client.UID + "/" + provider
+}
+
 func generateRandomHex(nBytes int) (string, error) {
 	b := make([]byte, nBytes)
 	if _, err := rand.Read(b); err != nil {
@@ -109,3 +417,76 @@ func generateRandomHex(nBytes int) (string, error) {
 	}
 	return hex.EncodeToString(b), nil
 }
+
+// signingSettings son las claves de settings con credenciales que genera
+// el provider y que el relay usa para verificar firmas.
+//
+//	stripe: signing_secret (whsec_..., del endpoint en el Dashboard)
+//	paypal: webhook_id (id del webhook en la app de PayPal)
+//	adyen:  hmac_key (hex, del Customer Area)
+//	dlocal: secret_key, x_login (opcional, se compara con el header X-Login)
+//	payu:   api_key
+var signingSettings = map[string][]string{
+	"stripe": {"signing_secret"},
+	"paypal": {"webhook_id"},
+	"adyen":  {"hmac_key"},
+	"dlocal": {"secret_key", "x_login"},
+	"payu":   {"api_key"},
+}
+
+// validateSettings valida las claves de settings que usa el relay. Las
+// demás se guardan tal cual; null (borrar la clave en un PATCH) vale.
+func validateSettings(provider string, settings map[string]interface{}) error {
+	for _, name := range secretSettings[provider] {
+		if isRedacted(settings[name]) {
+			return errInvalidSettings.Wrap(fmt.Errorf("settings.%s", name))
+		}
+	}
+
+	if provider == "generic" {
+		return validateGenericSettings(settings)
+	}
+
+	for _, name := range signingSettings[provider] {
+		v, ok := settings[name]
+		if !ok || v == nil {
+			continue
+		}
+		s, ok := v.(string)
+		if !ok || s == "" {
+			return errInvalidSettings.Wrap(fmt.Errorf("settings.%s", name))
+		}
+		if name == "hmac_key" {
+			if _, err := hex.DecodeString(s); err != nil {
+				return errInvalidHMACKey
+			}
+		}
+	}
+	return nil
+}
+
+// validateGenericSettings valida la firma, el mapping JSONPath y que
+// status_map traduzca a estados canónicos (ver package generic).
+func validateGenericSettings(settings map[string]interface{}) error {
+	if err := generic.ValidateSettings(settings); err != nil {
+		return errInvalidGenericConfig.Wrap(err)
+	}
+
+	statusMap, _ := settings["status_map"].(map[string]interface{})
+	for raw, v := range statusMap {
+		s, _ := v.(string)
+		if !isCanonicalStatus(s) {
+			return errInvalidGenericConfig.Wrap(fmt.Errorf("status_map.%s: %q is not one of %v", raw, s, payments.Statuses))
+		}
+	}
+	return nil
+}
+
+func isCanonicalStatus(s string) bool {
+	for _, st := range payments.Statuses {
+		if st == s {
+			return true
+		}
+	}
+	return false
+}
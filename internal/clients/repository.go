@@ -2,19 +2,144 @@ package clients
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"log"
+	"strings"
+	"time"
 
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Kmicac/Webhook-Relay/internal/apperr"
 	"github.com/Kmicac/Webhook-Relay/internal/storage"
 )
 
+// SupportedProviders son los providers que acepta HandlePayment.
+var SupportedProviders = []string{"mercadopago", "stripe", "paypal", "adyen", "dlocal", "payu", "generic"}
+
+func IsSupportedProvider(p string) bool {
+	for _, sp := range SupportedProviders {
+		if sp == p {
+			return true
+		}
+	}
+	return false
+}
+
 type Client struct {
-	ID       int64  `json:"id"`
-	UID      string `json:"client_uid"`
-	Secret   string `json:"-"`
-	Provider string `json:"provider"`
+	ID        int64                  `json:"id"`
+	UID       string                 `json:"client_uid"`
+	Metadata  map[string]interface{} `json:"metadata"`
+	Providers []ProviderConfig       `json:"providers"`
+
+	// overrides del rate limit de ingestión (nil = default global)
+	RateLimitRPS   *float64 `json:"rate_limit_rps,omitempty"`
+	RateLimitBurst *int     `json:"rate_limit_burst,omitempty"`
+
+	// IPs/CIDRs desde las que el cliente puede enviar webhooks (vacío = todas)
+	AllowedCIDRs []string `json:"allowed_cidrs"`
+
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+}
+
+func (c *Client) Disabled() bool {
+	return c.DisabledAt != nil
 }
 
+func (c *Client) Deleted() bool {
+	return c.DeletedAt != nil
+}
+
+// ProviderConfig es la configuración de un provider para un cliente:
+// cada uno tiene su propio secret de firma y sus settings.
+type ProviderConfig struct {
+	ID        int64                  `json:"id"`
+	ClientID  int64                  `json:"client_id"`
+	Provider  string                 `json:"provider"`
+	Secret    string                 `json:"-"`
+	Settings  map[string]interface{} `json:"settings"`
+	Enabled   bool                   `json:"enabled"`
+	CreatedAt time.Time              `json:"created_at"`
+	UpdatedAt *time.Time             `json:"updated_at,omitempty"`
+}
+
+// secretSettings son las claves de settings que son credenciales. Igual
+// que Secret, no salen en las respuestas del admin ni en el audit log: se
+// reemplazan por "[redacted:<huella>]", que alcanza para ver que cambiaron.
+var secretSettings = map[string][]string{
+	"mercadopago": {"access_token"},
+	"stripe":      {"signing_secret"},
+	"adyen":       {"hmac_key"},
+	"dlocal":      {"secret_key"},
+	"payu":        {"api_key"},
+}
+
+const redactedPrefix = "[redacted:"
+
+// MarshalJSON serializa la config con las secretSettings redactadas. En la
+// base se guarda Settings (el map), así que esto no afecta lo persistido.
+func (p ProviderConfig) MarshalJSON() ([]byte, error) {
+	type plain ProviderConfig
+	out := plain(p)
+	out.Settings = redactSettings(p.Provider, p.Settings)
+	return json.Marshal(out)
+}
+
+func redactSettings(provider string, settings map[string]interface{}) map[string]interface{} {
+	keys := secretSettings[provider]
+	if len(keys) == 0 || settings == nil {
+		return settings
+	}
+	out := make(map[string]interface{}, len(settings))
+	for k, v := range settings {
+		out[k] = v
+	}
+	for _, k := range keys {
+		if s, ok := out[k].(string); ok && s != "" {
+			sum := sha256.Sum256([]byte(s))
+			out[k] = redactedPrefix + hex.EncodeToString(sum[:4]) + "]"
+		}
+	}
+	return out
+}
+
+// isRedacted indica si v es un valor redactado que volvió en un request
+// (p.ej. un PATCH armado a partir de un GET).
+func isRedacted(v interface{}) bool {
+	s, ok := v.(string)
+	return ok && strings.HasPrefix(s, redactedPrefix)
+}
+
+// ClientUpdate son los campos modificables vía PATCH. nil = no se toca.
+// Metadata se mergea con la existente; las claves con null se eliminan.
+// Un rate limit en 0 vuelve al default global.
+type ClientUpdate struct {
+	Metadata       map[string]interface{}
+	RateLimitRPS   *float64
+	RateLimitBurst *int
+	AllowedCIDRs   *[]string // reemplaza la lista; vacía = sin restricción
+}
+
+// ProviderUpdate es el PATCH de una configuración de provider.
+// Settings se mergea igual que la metadata del cliente.
+type ProviderUpdate struct {
+	Enabled  *bool
+	Settings map[string]interface{}
+}
+
+var (
+	ErrClientNotFound   = apperr.NotFound("client_not_found", "client not found")
+	ErrClientExists     = apperr.Conflict("client_exists", "client uid already exists")
+	ErrClientDeleted    = apperr.New(apperr.KindGone, "client_deleted", "client deleted")
+	ErrClientDisabled   = apperr.Forbidden("client_disabled", "client disabled")
+	ErrProviderNotFound = apperr.NotFound("provider_not_configured", "provider not configured for client")
+	ErrProviderExists   = apperr.Conflict("provider_exists", "provider already configured for client")
+)
+
 type Repository struct {
 	db *storage.PostgresStore
 }
@@ -23,61 +148,382 @@ func NewRepository(store *storage.PostgresStore) *Repository {
 	return &Repository{db: store}
 }
 
+const clientColumns = `id, client_uid, metadata, rate_limit_rps, rate_limit_burst, allowed_cidrs, disabled_at, updated_at, deleted_at`
+
+const providerColumns = `id, client_id, provider, secret, settings, enabled, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanClient(row rowScanner) (*Client, error) {
+	var c Client
+	if err := row.Scan(
+		&c.ID,
+		&c.UID,
+		&c.Metadata,
+		&c.RateLimitRPS,
+		&c.RateLimitBurst,
+		&c.AllowedCIDRs,
+		&c.DisabledAt,
+		&c.UpdatedAt,
+		&c.DeletedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func scanProvider(row rowScanner) (*ProviderConfig, error) {
+	var p ProviderConfig
+	if err := row.Scan(
+		&p.ID,
+		&p.ClientID,
+		&p.Provider,
+		&p.Secret,
+		&p.Settings,
+		&p.Enabled,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// FindByUID devuelve el cliente (con sus providers) aunque esté
+// deshabilitado o borrado; el caller decide qué hacer en cada caso.
 func (r *Repository) FindByUID(uid string) (*Client, error) {
 	row := r.db.DB.QueryRow(
 		context.Background(),
-		`SELECT id, client_uid, secret, provider
+		`SELECT `+clientColumns+`
          FROM clients
          WHERE client_uid = $1`,
 		uid,
 	)
 
-	var c Client
-	if err := row.Scan(&c.ID, &c.UID, &c.Secret, &c.Provider); err != nil {
-		return nil, errors.New("client not found")
+	c, err := scanClient(row)
+	if err != nil {
+		return nil, apperr.FromDB(err, ErrClientNotFound, nil)
 	}
 
-	return &c, nil
+	if err := r.loadProviders(context.Background(), []*Client{c}); err != nil {
+		return nil, apperr.FromDB(err, nil, nil)
+	}
+
+	return c, nil
 }
 
-func (r *Repository) List() ([]Client, error) {
+// List devuelve los clientes; los borrados sólo si includeDeleted.
+func (r *Repository) List(includeDeleted bool) ([]Client, error) {
 	rows, err := r.db.DB.Query(
 		context.Background(),
-		`SELECT id, client_uid, provider
+		`SELECT `+clientColumns+`
          FROM clients
+         WHERE $1 OR deleted_at IS NULL
          ORDER BY id DESC`,
+		includeDeleted,
 	)
 	if err != nil {
 		log.Printf("[ClientsRepository] List ERROR: %v", err)
-		return nil, err
+		return nil, apperr.FromDB(err, nil, nil)
 	}
 	defer rows.Close()
 
 	var result []Client
 	for rows.Next() {
-		var c Client
-		if err := rows.Scan(&c.ID, &c.UID, &c.Provider); err != nil {
-			return nil, err
+		c, err := scanClient(rows)
+		if err != nil {
+			return nil, apperr.FromDB(err, nil, nil)
 		}
-		result = append(result, c)
+		result = append(result, *c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperr.FromDB(err, nil, nil)
+	}
+
+	ptrs := make([]*Client, len(result))
+	for i := range result {
+		ptrs[i] = &result[i]
+	}
+	if err := r.loadProviders(context.Background(), ptrs); err != nil {
+		return nil, apperr.FromDB(err, nil, nil)
 	}
 
 	return result, nil
 }
 
-func (r *Repository) Create(uid, secret, provider string) (*Client, error) {
+// loadProviders completa Providers de cada cliente con una sola query.
+func (r *Repository) loadProviders(ctx context.Context, list []*Client) error {
+	if len(list) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*Client, len(list))
+	ids := make([]int64, 0, len(list))
+	for _, c := range list {
+		c.Providers = []ProviderConfig{}
+		byID[c.ID] = c
+		ids = append(ids, c.ID)
+	}
+
+	rows, err := r.db.DB.Query(
+		ctx,
+		`SELECT `+providerColumns+`
+         FROM client_providers
+         WHERE client_id = ANY($1)
+         ORDER BY provider`,
+		ids,
+	)
+	if err != nil {
+		log.Printf("[ClientsRepository] loadProviders ERROR: %v", err)
+		return apperr.FromDB(err, nil, nil)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanProvider(rows)
+		if err != nil {
+			return apperr.FromDB(err, nil, nil)
+		}
+		if c, ok := byID[p.ClientID]; ok {
+			c.Providers = append(c.Providers, *p)
+		}
+	}
+
+	return rows.Err()
+}
+
+// Create da de alta el cliente y, si provider no está vacío, su primera
+// configuración de provider, todo en una transacción.
+func (r *Repository) Create(uid, provider, secret string) (*Client, error) {
+	ctx := context.Background()
+
+	tx, err := r.db.DB.Begin(ctx)
+	if err != nil {
+		return nil, apperr.FromDB(err, nil, nil)
+	}
+	defer tx.Rollback(ctx)
+
+	c, err := scanClient(tx.QueryRow(
+		ctx,
+		`INSERT INTO clients (client_uid)
+         VALUES ($1)
+         RETURNING `+clientColumns,
+		uid,
+	))
+	if err != nil {
+		return nil, apperr.FromDB(err, nil, ErrClientExists)
+	}
+
+	c.Providers = []ProviderConfig{}
+	if provider != "" {
+		p, err := scanProvider(tx.QueryRow(
+			ctx,
+			`INSERT INTO client_providers (client_id, provider, secret)
+             VALUES ($1, $2, $3)
+             RETURNING `+providerColumns,
+			c.ID, provider, secret,
+		))
+		if err != nil {
+			return nil, apperr.FromDB(err, nil, ErrProviderExists)
+		}
+		c.Providers = append(c.Providers, *p)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, apperr.FromDB(err, nil, nil)
+	}
+
+	return c, nil
+}
+
+// Update aplica un PATCH sobre un cliente no borrado.
+func (r *Repository) Update(uid string, upd ClientUpdate) (*Client, error) {
+	var metadata interface{}
+	if upd.Metadata != nil {
+		metadata = upd.Metadata
+	}
+
 	row := r.db.DB.QueryRow(
 		context.Background(),
-		`INSERT INTO clients (client_uid, secret, provider)
-         VALUES ($1, $2, $3)
-         RETURNING id, client_uid, secret, provider`,
-		uid, secret, provider,
+		`UPDATE clients
+         SET metadata         = CASE WHEN $2::jsonb IS NULL THEN metadata
+                                     ELSE jsonb_strip_nulls(metadata || $2::jsonb) END,
+             rate_limit_rps   = CASE WHEN $3::float8 IS NULL THEN rate_limit_rps
+                                     ELSE NULLIF($3::float8, 0) END,
+             rate_limit_burst = CASE WHEN $4::int IS NULL THEN rate_limit_burst
+                                     ELSE NULLIF($4::int, 0) END,
+             allowed_cidrs    = COALESCE($5::text[], allowed_cidrs),
+             updated_at       = NOW()
+         WHERE client_uid = $1 AND deleted_at IS NULL
+         RETURNING `+clientColumns,
+		uid, metadata, upd.RateLimitRPS, upd.RateLimitBurst, upd.AllowedCIDRs,
 	)
 
-	var c Client
-	if err := row.Scan(&c.ID, &c.UID, &c.Secret, &c.Provider); err != nil {
-		return nil, err
+	return r.scanWithProviders(row)
+}
+
+// Disable marca el cliente como deshabilitado. Deshabilitar dos veces
+// conserva la fecha original.
+func (r *Repository) Disable(uid string) (*Client, error) {
+	return r.setDisabled(uid, true)
+}
+
+// Enable vuelve a habilitar un cliente deshabilitado.
+func (r *Repository) Enable(uid string) (*Client, error) {
+	return r.setDisabled(uid, false)
+}
+
+func (r *Repository) setDisabled(uid string, disabled bool) (*Client, error) {
+	row := r.db.DB.QueryRow(
+		context.Background(),
+		`UPDATE clients
+         SET disabled_at = CASE WHEN $2 THEN COALESCE(disabled_at, NOW()) ELSE NULL END,
+             updated_at  = NOW()
+         WHERE client_uid = $1 AND deleted_at IS NULL
+         RETURNING `+clientColumns,
+		uid, disabled,
+	)
+
+	return r.scanWithProviders(row)
+}
+
+// SoftDelete da de baja al cliente sin borrar la fila, así sus eventos
+// históricos siguen referenciándolo.
+func (r *Repository) SoftDelete(uid string) (*Client, error) {
+	row := r.db.DB.QueryRow(
+		context.Background(),
+		`UPDATE clients
+         SET deleted_at  = NOW(),
+             disabled_at = COALESCE(disabled_at, NOW()),
+             updated_at  = NOW()
+         WHERE client_uid = $1 AND deleted_at IS NULL
+         RETURNING `+clientColumns,
+		uid,
+	)
+
+	return r.scanWithProviders(row)
+}
+
+func (r *Repository) scanWithProviders(row rowScanner) (*Client, error) {
+	c, err := scanClient(row)
+	if err != nil {
+		return nil, apperr.FromDB(err, ErrClientNotFound, nil)
 	}
 
-	return &c, nil
+	if err := r.loadProviders(context.Background(), []*Client{c}); err != nil {
+		return nil, apperr.FromDB(err, nil, nil)
+	}
+
+	return c, nil
+}
+
+// FindProvider devuelve la configuración de provider de un cliente.
+func (r *Repository) FindProvider(clientID int64, provider string) (*ProviderConfig, error) {
+	row := r.db.DB.QueryRow(
+		context.Background(),
+		`SELECT `+providerColumns+`
+         FROM client_providers
+         WHERE client_id = $1 AND provider = $2`,
+		clientID, provider,
+	)
+
+	p, err := scanProvider(row)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("[ClientsRepository] FindProvider ERROR: %v", err)
+	}
+	if err != nil {
+		return nil, apperr.FromDB(err, ErrProviderNotFound, nil)
+	}
+
+	return p, nil
+}
+
+// AddProvider agrega un provider a un cliente existente.
+func (r *Repository) AddProvider(clientID int64, provider, secret string, settings map[string]interface{}) (*ProviderConfig, error) {
+	if settings == nil {
+		settings = map[string]interface{}{}
+	}
+
+	row := r.db.DB.QueryRow(
+		context.Background(),
+		`INSERT INTO client_providers (client_id, provider, secret, settings)
+         VALUES ($1, $2, $3, $4)
+         ON CONFLICT (client_id, provider) DO NOTHING
+         RETURNING `+providerColumns,
+		clientID, provider, secret, settings,
+	)
+
+	p, err := scanProvider(row)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("[ClientsRepository] AddProvider ERROR: %v", err)
+	}
+	if err != nil {
+		// ON CONFLICT DO NOTHING no devuelve filas
+		return nil, apperr.FromDB(err, ErrProviderExists, nil)
+	}
+
+	return p, nil
+}
+
+// UpdateProvider habilita/deshabilita un provider o mergea sus settings.
+func (r *Repository) UpdateProvider(clientID int64, provider string, upd ProviderUpdate) (*ProviderConfig, error) {
+	var settings interface{}
+	if upd.Settings != nil {
+		settings = upd.Settings
+	}
+
+	row := r.db.DB.QueryRow(
+		context.Background(),
+		`UPDATE client_providers
+         SET enabled    = COALESCE($3, enabled),
+             settings   = CASE WHEN $4::jsonb IS NULL THEN settings
+                               ELSE jsonb_strip_nulls(settings || $4::jsonb) END,
+             updated_at = NOW()
+         WHERE client_id = $1 AND provider = $2
+         RETURNING `+providerColumns,
+		clientID, provider, upd.Enabled, settings,
+	)
+
+	p, err := scanProvider(row)
+	if err != nil {
+		return nil, apperr.FromDB(err, ErrProviderNotFound, nil)
+	}
+	return p, nil
+}
+
+// RemoveProvider borra la configuración de un provider.
+func (r *Repository) RemoveProvider(clientID int64, provider string) error {
+	tag, err := r.db.DB.Exec(
+		context.Background(),
+		`DELETE FROM client_providers WHERE client_id = $1 AND provider = $2`,
+		clientID, provider,
+	)
+	if err != nil {
+		return apperr.FromDB(err, nil, nil)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrProviderNotFound
+	}
+	return nil
+}
+
+// RotateSecret reemplaza el secret de un provider del cliente.
+func (r *Repository) RotateSecret(clientID int64, provider, secret string) (*ProviderConfig, error) {
+	row := r.db.DB.QueryRow(
+		context.Background(),
+		`UPDATE client_providers
+         SET secret = $3,
+             updated_at = NOW()
+         WHERE client_id = $1 AND provider = $2
+         RETURNING `+providerColumns,
+		clientID, provider, secret,
+	)
+
+	p, err := scanProvider(row)
+	if err != nil {
+		return nil, apperr.FromDB(err, ErrProviderNotFound, nil)
+	}
+	return p, nil
 }
@@ -0,0 +1,191 @@
+// Package generic describe un provider "generic": pasarelas chicas que se
+// configuran por cliente, sin código. La firma es declarativa (header,
+// algoritmo, encoding y qué se firma) y los campos del pago se sacan del
+// body con expresiones JSONPath.
+//
+// La configuración va en los settings del provider del cliente:
+//
+//	{
+//	  "signature": {
+//	    "header": "X-Hub-Signature-256",
+//	    "prefix": "sha256=",
+//	    "algorithm": "sha256",
+//	    "encoding": "hex",
+//	    "template": "{header:X-Timestamp}.{body}",
+//	    "timestamp_header": "X-Timestamp"
+//	  },
+//	  "mapping": {
+//	    "id": "$.data.id",
+//	    "status": "$.data.status",
+//	    "amount": "$.data.amount",
+//	    "currency": "$.data.currency"
+//	  },
+//	  "amount_decimals": 2,
+//	  "status_map": {"paid": "captured", "void": "canceled"}
+//	}
+//
+// La clave del HMAC es el secret del provider que genera el relay.
+package generic
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Campos de PaymentEvent que se pueden mapear.
+const (
+	FieldID           = "id"
+	FieldStatus       = "status"
+	FieldStatusDetail = "status_detail"
+	FieldAmount       = "amount"
+	FieldCurrency     = "currency"
+	FieldPayerEmail   = "payer_email"
+	FieldApprovedAt   = "approved_at"
+	FieldEventType    = "event_type"
+)
+
+var (
+	fields         = []string{FieldID, FieldStatus, FieldStatusDetail, FieldAmount, FieldCurrency, FieldPayerEmail, FieldApprovedAt, FieldEventType}
+	requiredFields = []string{FieldID, FieldStatus, FieldAmount}
+)
+
+// ErrNotConfigured: el cliente tiene el provider generic sin configurar.
+var ErrNotConfigured = errors.New("generic: provider settings have no signature/mapping")
+
+// Config es la configuración del provider generic de un cliente.
+type Config struct {
+	Signature      Signature         `json:"signature"`
+	Mapping        map[string]string `json:"mapping"`
+	AmountDecimals int               `json:"amount_decimals"` // el monto viene en unidades mínimas (2 = centavos)
+	StatusMap      map[string]string `json:"status_map"`      // estado del gateway -> estado canónico
+
+	paths map[string]Path
+}
+
+// settingsKeys son las claves de settings que pertenecen a la config.
+var settingsKeys = []string{"signature", "mapping", "amount_decimals", "status_map"}
+
+// ParseConfig lee y valida la configuración desde los settings del
+// provider. Las claves de settings que no son de la config se ignoran.
+func ParseConfig(settings map[string]interface{}) (*Config, error) {
+	if settings["signature"] == nil || settings["mapping"] == nil {
+		return nil, ErrNotConfigured
+	}
+
+	cfg := &Config{}
+	if err := decodeSettings(settings, cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Signature.validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.compileMapping(); err != nil {
+		return nil, err
+	}
+	if cfg.AmountDecimals < 0 || cfg.AmountDecimals > 6 {
+		return nil, fmt.Errorf("amount_decimals must be between 0 and 6")
+	}
+
+	return cfg, nil
+}
+
+// ValidateSettings valida las claves de la config presentes en settings,
+// para un PATCH que reemplaza sólo algunas (null borra la clave).
+func ValidateSettings(settings map[string]interface{}) error {
+	partial := map[string]interface{}{}
+	for _, k := range settingsKeys {
+		if v := settings[k]; v != nil {
+			partial[k] = v
+		}
+	}
+
+	cfg := &Config{}
+	if err := decodeSettings(partial, cfg); err != nil {
+		return err
+	}
+	if partial["signature"] != nil {
+		if err := cfg.Signature.validate(); err != nil {
+			return err
+		}
+	}
+	if partial["mapping"] != nil {
+		if err := cfg.compileMapping(); err != nil {
+			return err
+		}
+	}
+	if cfg.AmountDecimals < 0 || cfg.AmountDecimals > 6 {
+		return fmt.Errorf("amount_decimals must be between 0 and 6")
+	}
+	return nil
+}
+
+// Lookup devuelve el valor del campo mapeado en doc.
+func (c *Config) Lookup(doc interface{}, field string) (interface{}, bool) {
+	p, ok := c.paths[field]
+	if !ok {
+		return nil, false
+	}
+	return p.Lookup(doc)
+}
+
+func (c *Config) compileMapping() error {
+	c.paths = make(map[string]Path, len(c.Mapping))
+
+	names := make([]string, 0, len(c.Mapping))
+	for name := range c.Mapping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !contains(fields, name) {
+			return fmt.Errorf("mapping.%s: unknown field (valid: %v)", name, fields)
+		}
+		p, err := CompilePath(c.Mapping[name])
+		if err != nil {
+			return fmt.Errorf("mapping.%s: %w", name, err)
+		}
+		c.paths[name] = p
+	}
+
+	for _, name := range requiredFields {
+		if _, ok := c.paths[name]; !ok {
+			return fmt.Errorf("mapping.%s is required", name)
+		}
+	}
+	return nil
+}
+
+// decodeSettings pasa settings (ya decodificado de JSONB) a la config,
+// rechazando claves desconocidas dentro de signature.
+func decodeSettings(settings map[string]interface{}, cfg *Config) error {
+	raw, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, cfg); err != nil {
+		return fmt.Errorf("invalid generic settings: %w", err)
+	}
+
+	if sig, ok := settings["signature"]; ok && sig != nil {
+		raw, _ := json.Marshal(sig)
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&Signature{}); err != nil {
+			return fmt.Errorf("invalid signature settings: %w", err)
+		}
+	}
+	return nil
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package generic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Path es una expresión JSONPath compilada. Se soporta el subconjunto que
+// alcanza para mapear un campo: $, .campo, ['campo'] y [índice].
+// Comodines, filtros y slices no.
+type Path struct {
+	expr  string
+	steps []step
+}
+
+type step struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// CompilePath parsea una expresión como "$.data.object['amount']" o
+// "$.items[0].id".
+func CompilePath(expr string) (Path, error) {
+	p := Path{expr: expr}
+	if !strings.HasPrefix(expr, "$") {
+		return p, fmt.Errorf("jsonpath %q: must start with $", expr)
+	}
+
+	rest := expr[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			n := 0
+			for n < len(rest) && isNameChar(rest[n]) {
+				n++
+			}
+			if n == 0 {
+				return p, fmt.Errorf("jsonpath %q: expected a field name after '.'", expr)
+			}
+			p.steps = append(p.steps, step{key: rest[:n]})
+			rest = rest[n:]
+
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return p, fmt.Errorf("jsonpath %q: unclosed '['", expr)
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				p.steps = append(p.steps, step{key: inner[1 : len(inner)-1]})
+				continue
+			}
+			i, err := strconv.Atoi(inner)
+			if err != nil || i < 0 {
+				return p, fmt.Errorf("jsonpath %q: unsupported selector [%s]", expr, inner)
+			}
+			p.steps = append(p.steps, step{index: i, isIndex: true})
+
+		default:
+			return p, fmt.Errorf("jsonpath %q: unexpected %q", expr, rest[0])
+		}
+	}
+
+	return p, nil
+}
+
+// Lookup evalúa la expresión sobre un documento decodificado con
+// encoding/json. Devuelve false si algún tramo no existe.
+func (p Path) Lookup(doc interface{}) (interface{}, bool) {
+	cur := doc
+	for _, s := range p.steps {
+		if s.isIndex {
+			arr, ok := cur.([]interface{})
+			if !ok || s.index >= len(arr) {
+				return nil, false
+			}
+			cur = arr[s.index]
+			continue
+		}
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = obj[s.key]; !ok {
+			return nil, false
+		}
+	}
+	return cur, cur != nil
+}
+
+func (p Path) String() string {
+	return p.expr
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c == '-' || c == '$' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
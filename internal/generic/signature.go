@@ -0,0 +1,165 @@
+package generic
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signature describe cómo firma el gateway: HMAC(secret, contenido) con
+// el algoritmo y encoding indicados, en un header.
+//
+// Template arma el contenido firmado con dos placeholders: {body} (el body
+// tal cual llegó) y {header:Nombre}. Sin template se firma el body.
+//
+// Con TimestampHeader (segundos, milisegundos o RFC3339) se aplica la
+// protección contra replays; si el gateway no manda timestamp no. El
+// template tiene que firmar ese header ({header:<TimestampHeader>}): si no,
+// se podría reenviar un request capturado con un timestamp nuevo.
+type Signature struct {
+	Header          string `json:"header"`
+	Prefix          string `json:"prefix"`    // se quita del valor del header, p.ej. "sha256="
+	Algorithm       string `json:"algorithm"` // sha1, sha256, sha512
+	Encoding        string `json:"encoding"`  // hex, base64
+	Template        string `json:"template"`
+	TimestampHeader string `json:"timestamp_header"`
+}
+
+var algorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+func (s Signature) validate() error {
+	if s.Header == "" {
+		return fmt.Errorf("signature.header is required")
+	}
+	if _, ok := algorithms[s.Algorithm]; !ok {
+		return fmt.Errorf("signature.algorithm must be sha1, sha256 or sha512")
+	}
+	if s.Encoding != "hex" && s.Encoding != "base64" {
+		return fmt.Errorf("signature.encoding must be hex or base64")
+	}
+	if _, err := s.render(http.Header{}, nil); err != nil {
+		return err
+	}
+	if s.TimestampHeader != "" && !s.signsHeader(s.TimestampHeader) {
+		return fmt.Errorf("signature.template must include {header:%s} when timestamp_header is set", s.TimestampHeader)
+	}
+	return nil
+}
+
+// signsHeader dice si el template incluye el header en el contenido
+// firmado (los nombres de headers no distinguen mayúsculas).
+func (s Signature) signsHeader(name string) bool {
+	const probe = "\x00signed-header\x00"
+	h := http.Header{}
+	h.Set(name, probe)
+	content, err := s.render(h, nil)
+	return err == nil && strings.Contains(string(content), probe)
+}
+
+// Verify recalcula la firma y la compara con la del header.
+func (s Signature) Verify(secret string, h http.Header, body []byte) bool {
+	newHash, ok := algorithms[s.Algorithm]
+	if !ok || secret == "" {
+		return false
+	}
+
+	got := strings.TrimSpace(h.Get(s.Header))
+	if s.Prefix != "" {
+		if !strings.HasPrefix(got, s.Prefix) {
+			return false
+		}
+		got = strings.TrimPrefix(got, s.Prefix)
+	}
+	if got == "" {
+		return false
+	}
+
+	content, err := s.render(h, body)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(content)
+	sum := mac.Sum(nil)
+
+	var expected string
+	if s.Encoding == "base64" {
+		expected = base64.StdEncoding.EncodeToString(sum)
+	} else {
+		expected = hex.EncodeToString(sum)
+		got = strings.ToLower(got)
+	}
+
+	return hmac.Equal([]byte(expected), []byte(got))
+}
+
+// ReplayToken devuelve el timestamp y la firma del request para el guard
+// de replays. ok es false si la config no declara timestamp_header.
+func (s Signature) ReplayToken(h http.Header) (ts time.Time, nonce string, ok bool) {
+	if s.TimestampHeader == "" {
+		return time.Time{}, "", false
+	}
+
+	v := strings.TrimSpace(h.Get(s.TimestampHeader))
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+		if n > 1e12 {
+			ts = time.UnixMilli(n)
+		} else {
+			ts = time.Unix(n, 0)
+		}
+	} else if t, err := time.Parse(time.RFC3339, v); err == nil {
+		ts = t
+	}
+
+	return ts, h.Get(s.Header), true
+}
+
+// render arma el contenido firmado a partir del template.
+func (s Signature) render(h http.Header, body []byte) ([]byte, error) {
+	tmpl := s.Template
+	if tmpl == "" {
+		tmpl = "{body}"
+	}
+
+	var out []byte
+	for tmpl != "" {
+		start := strings.IndexByte(tmpl, '{')
+		if start < 0 {
+			out = append(out, tmpl...)
+			break
+		}
+		out = append(out, tmpl[:start]...)
+
+		end := strings.IndexByte(tmpl[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("signature.template: unclosed '{'")
+		}
+		name := tmpl[start+1 : start+end]
+		tmpl = tmpl[start+end+1:]
+
+		switch {
+		case name == "body":
+			out = append(out, body...)
+		case strings.HasPrefix(name, "header:") && len(name) > len("header:"):
+			out = append(out, h.Get(strings.TrimPrefix(name, "header:"))...)
+		default:
+			return nil, fmt.Errorf("signature.template: unknown placeholder {%s}", name)
+		}
+	}
+
+	return out, nil
+}
@@ -0,0 +1,91 @@
+package mercadopago
+
+import (
+	"sync"
+	"time"
+)
+
+// Cache guarda las respuestas de la API por poco tiempo, por notificación:
+// cuando MercadoPago reintenta la misma entrega nos ahorramos el request.
+// Notificaciones distintas del mismo pago (created + updated) no lo
+// comparten, porque la segunda puede traer otro estado (ver Enrich).
+type Cache struct {
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	body      []byte
+	expiresAt time.Time
+}
+
+// NewCache crea el cache; ttl <= 0 lo deshabilita.
+func NewCache(ttl time.Duration, maxEntries int) *Cache {
+	if maxEntries <= 0 {
+		maxEntries = 10000
+	}
+	return &Cache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    map[string]cacheEntry{},
+	}
+}
+
+func (c *Cache) Get(key string) ([]byte, bool) {
+	if c == nil || c.ttl <= 0 {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !c.now().Before(e.expiresAt) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e.body, true
+}
+
+func (c *Cache) Set(key string, body []byte) {
+	if c == nil || c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if len(c.entries) >= c.maxEntries {
+		c.evict(now)
+	}
+	c.entries[key] = cacheEntry{body: body, expiresAt: now.Add(c.ttl)}
+}
+
+// evict borra lo vencido y, si sigue lleno, lo que esté más cerca de vencer.
+func (c *Cache) evict(now time.Time) {
+	var (
+		oldestKey string
+		oldest    time.Time
+	)
+	for k, e := range c.entries {
+		if !now.Before(e.expiresAt) {
+			delete(c.entries, k)
+			continue
+		}
+		if oldestKey == "" || e.expiresAt.Before(oldest) {
+			oldestKey, oldest = k, e.expiresAt
+		}
+	}
+	if len(c.entries) >= c.maxEntries && oldestKey != "" {
+		delete(c.entries, oldestKey)
+	}
+}
@@ -0,0 +1,67 @@
+package mercadopago
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCacheTTL(t *testing.T) {
+	now := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	c := NewCache(time.Minute, 0)
+	c.now = func() time.Time { return now }
+
+	c.Set("1/123", []byte("a"))
+	if got, ok := c.Get("1/123"); !ok || string(got) != "a" {
+		t.Fatalf("Get = %q, %v", got, ok)
+	}
+	if _, ok := c.Get("2/123"); ok {
+		t.Error("keys are per client")
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := c.Get("1/123"); ok {
+		t.Error("entry served after its TTL")
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	now := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	c := NewCache(time.Minute, 2)
+	c.now = func() time.Time { return now }
+
+	c.Set("a", []byte("a"))
+	now = now.Add(time.Second)
+	c.Set("b", []byte("b"))
+	now = now.Add(time.Second)
+	c.Set("c", []byte("c")) // lleno: sale "a", la más cerca de vencer
+
+	if _, ok := c.Get("a"); ok {
+		t.Error("oldest entry was not evicted")
+	}
+	for _, k := range []string{"b", "c"} {
+		if _, ok := c.Get(k); !ok {
+			t.Errorf("%s was evicted", k)
+		}
+	}
+
+	// lo vencido se va antes que lo vigente
+	now = now.Add(time.Minute - time.Second)
+	c.Set("d", []byte("d"))
+	if _, ok := c.Get("c"); !ok {
+		t.Error("live entry evicted while an expired one was available")
+	}
+}
+
+func TestCacheDisabled(t *testing.T) {
+	c := NewCache(0, 0)
+	c.Set("k", []byte("v"))
+	if _, ok := c.Get("k"); ok {
+		t.Error("ttl 0 should disable the cache")
+	}
+
+	var nilCache *Cache
+	nilCache.Set("k", []byte("v"))
+	if _, ok := nilCache.Get("k"); ok {
+		t.Error("nil cache returned a value")
+	}
+}
@@ -0,0 +1,80 @@
+// Package mercadopago resuelve las notificaciones "thin" de MercadoPago:
+// el webhook sólo trae el id del pago y el detalle hay que pedirlo a
+// /v1/payments/:id con el access token del vendedor.
+package mercadopago
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultBaseURL = "https://api.mercadopago.com"
+
+	maxResponseBytes = 1 << 20 // 1 MiB
+)
+
+var (
+	ErrPaymentNotFound = errors.New("mercadopago: payment not found")
+	ErrUnauthorized    = errors.New("mercadopago: access token rejected")
+)
+
+// API es lo que necesita el enricher de la API de MercadoPago. Está como
+// interfaz para poder apuntarlo a un stub local.
+type API interface {
+	// GetPayment devuelve el JSON del pago tal como lo manda la API.
+	GetPayment(ctx context.Context, accessToken, paymentID string) ([]byte, error)
+}
+
+// HTTPClient es el cliente real de la API REST.
+type HTTPClient struct {
+	BaseURL string
+	HTTP    *http.Client
+}
+
+func NewHTTPClient(baseURL string, timeout time.Duration) *HTTPClient {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &HTTPClient{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		HTTP:    &http.Client{Timeout: timeout},
+	}
+}
+
+func (c *HTTPClient) GetPayment(ctx context.Context, accessToken, paymentID string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/v1/payments/"+url.PathEscape(paymentID), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("mercadopago: fetching payment %s: %w", paymentID, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return nil, fmt.Errorf("mercadopago: reading payment %s: %w", paymentID, err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return body, nil
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("%w (id=%s)", ErrPaymentNotFound, paymentID)
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return nil, ErrUnauthorized
+	default:
+		return nil, fmt.Errorf("mercadopago: fetching payment %s: unexpected status %d", paymentID, resp.StatusCode)
+	}
+}
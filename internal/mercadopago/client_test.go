@@ -0,0 +1,83 @@
+package mercadopago
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPClientGetPayment(t *testing.T) {
+	var gotPath, gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAuth = r.URL.EscapedPath(), r.Header.Get("Authorization")
+		switch r.URL.Path {
+		case "/v1/payments/123":
+			w.Write([]byte(`{"id":123,"status":"approved"}`))
+		case "/v1/payments/404":
+			w.WriteHeader(http.StatusNotFound)
+		case "/v1/payments/401":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/v1/payments/403":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewHTTPClient(srv.URL+"/", time.Second)
+	ctx := context.Background()
+
+	body, err := c.GetPayment(ctx, "APP_USR-token", "123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != `{"id":123,"status":"approved"}` {
+		t.Errorf("body = %s", body)
+	}
+	if gotAuth != "Bearer APP_USR-token" {
+		t.Errorf("Authorization = %q", gotAuth)
+	}
+
+	// el id viene del webhook: no puede cambiar el path
+	if _, err := c.GetPayment(ctx, "t", "../users/me"); err == nil {
+		t.Error("expected an error")
+	}
+	if gotPath != "/v1/payments/..%2Fusers%2Fme" {
+		t.Errorf("path = %q, want the id escaped", gotPath)
+	}
+
+	cases := []struct {
+		id   string
+		want error
+	}{
+		{"404", ErrPaymentNotFound},
+		{"401", ErrUnauthorized},
+		{"403", ErrUnauthorized},
+	}
+	for _, tc := range cases {
+		if _, err := c.GetPayment(ctx, "t", tc.id); !errors.Is(err, tc.want) {
+			t.Errorf("GetPayment(%s) = %v, want %v", tc.id, err, tc.want)
+		}
+	}
+
+	_, err = c.GetPayment(ctx, "t", "500")
+	if err == nil || errors.Is(err, ErrPaymentNotFound) || errors.Is(err, ErrUnauthorized) {
+		t.Errorf("GetPayment(500) = %v, want a generic error", err)
+	}
+}
+
+func TestHTTPClientTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	c := NewHTTPClient(srv.URL, 20*time.Millisecond)
+	if _, err := c.GetPayment(context.Background(), "t", "1"); err == nil {
+		t.Fatal("expected a timeout")
+	}
+}
@@ -0,0 +1,169 @@
+package mercadopago
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultCacheTTL   = time.Minute
+	defaultAPITimeout = 10 * time.Second
+)
+
+var ErrMissingAccessToken = errors.New("mercadopago: client has no access_token configured")
+
+// Notification es una notificación "thin": sólo tipo y id del recurso.
+type Notification struct {
+	Type string // "payment", "merchant_order", "subscription_preapproval", ...
+	ID   string
+
+	// Delivery identifica la notificación en sí (id, action y
+	// date_created del webhook): vacío si el formato no la trae (feed v2)
+	Delivery string
+}
+
+// ParseNotification reconoce los dos formatos de notificación:
+//
+//	{"type":"payment","action":"payment.updated","data":{"id":"123"}}  (webhooks)
+//	{"topic":"payment","resource":"123"}                                (feed v2)
+//
+// Un body con el pago completo (tiene "status") no es una notificación.
+func ParseNotification(body []byte) (Notification, bool) {
+	var n struct {
+		NotificationID json.RawMessage `json:"id"`
+		Action         string          `json:"action"`
+		DateCreated    string          `json:"date_created"`
+		Type           string          `json:"type"`
+		Topic          string          `json:"topic"`
+		Resource       string          `json:"resource"`
+		Status         json.RawMessage `json:"status"`
+		Data           struct {
+			ID json.RawMessage `json:"id"`
+		} `json:"data"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&n); err != nil || n.Status != nil {
+		return Notification{}, false
+	}
+
+	if n.Type != "" && len(n.Data.ID) > 0 {
+		id := strings.Trim(string(n.Data.ID), `"`)
+		notif := Notification{Type: n.Type, ID: id}
+		if nid := strings.Trim(string(n.NotificationID), `"`); nid != "" {
+			notif.Delivery = nid + "/" + n.Action + "/" + n.DateCreated
+		}
+		return notif, id != ""
+	}
+
+	if n.Topic != "" && n.Resource != "" {
+		// resource puede ser el id o la URL del recurso
+		id := n.Resource[strings.LastIndex(n.Resource, "/")+1:]
+		return Notification{Type: n.Topic, ID: id}, id != ""
+	}
+
+	return Notification{}, false
+}
+
+// CredentialsFunc devuelve el access token del cliente.
+type CredentialsFunc func(ctx context.Context, clientID int64) (string, error)
+
+// Enricher reemplaza las notificaciones de pago por el pago completo.
+type Enricher struct {
+	API         API
+	Cache       *Cache
+	Credentials CredentialsFunc
+}
+
+// EnricherFromEnv arma el enricher con el cliente HTTP real.
+//
+//	MERCADOPAGO_API_URL       base de la API (default https://api.mercadopago.com;
+//	                          apuntarlo a un stub local en desarrollo)
+//	MERCADOPAGO_API_TIMEOUT   timeout por request (default 10s)
+//	MERCADOPAGO_CACHE_TTL     cache de respuestas por notificación, para
+//	                          las redeliveries (default 1m, 0 = sin cache)
+func EnricherFromEnv(creds CredentialsFunc) (*Enricher, error) {
+	timeout, err := envDuration("MERCADOPAGO_API_TIMEOUT", defaultAPITimeout)
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := envDuration("MERCADOPAGO_CACHE_TTL", defaultCacheTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Enricher{
+		API:         NewHTTPClient(os.Getenv("MERCADOPAGO_API_URL"), timeout),
+		Cache:       NewCache(ttl, 0),
+		Credentials: creds,
+	}, nil
+}
+
+// Enrich devuelve el body a procesar. Para notificaciones de pago de
+// MercadoPago trae el pago de la API; cualquier otra cosa (otros providers,
+// pagos completos, notificaciones de otros recursos) pasa sin cambios.
+func (e *Enricher) Enrich(ctx context.Context, clientID int64, provider string, body []byte) ([]byte, error) {
+	if provider != "mercadopago" {
+		return body, nil
+	}
+
+	n, ok := ParseNotification(body)
+	if !ok || n.Type != "payment" {
+		return body, nil
+	}
+
+	// el cache sólo evita volver a pedir el pago cuando el provider
+	// reenvía la misma notificación: payment.created y payment.updated
+	// llegan con segundos de diferencia y el segundo tiene que ver el
+	// estado nuevo
+	key := ""
+	if n.Delivery != "" {
+		key = strconv.FormatInt(clientID, 10) + "/" + n.ID + "/" + n.Delivery
+		if cached, ok := e.Cache.Get(key); ok {
+			return cached, nil
+		}
+	}
+
+	token, err := e.Credentials(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return nil, ErrMissingAccessToken
+	}
+
+	payment, err := e.API.GetPayment(ctx, token, n.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(payment) {
+		return nil, fmt.Errorf("mercadopago: invalid JSON for payment %s", n.ID)
+	}
+
+	log.Printf("[MercadoPago] fetched payment %s for client %d\n", n.ID, clientID)
+	if key != "" {
+		e.Cache.Set(key, payment)
+	}
+
+	return payment, nil
+}
+
+func envDuration(key string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", key, v)
+	}
+	return d, nil
+}
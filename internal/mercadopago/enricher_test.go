@@ -0,0 +1,185 @@
+package mercadopago
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const paymentJSON = `{"id":123,"status":"approved","transaction_amount":100}`
+
+// newTestEnricher apunta el cliente HTTP real a un stub de /v1/payments.
+func newTestEnricher(t *testing.T, tokens map[int64]string) (*Enricher, *int32) {
+	t.Helper()
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if r.Header.Get("Authorization") != "Bearer seller-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/payments/123":
+			w.Write([]byte(paymentJSON))
+		case "/v1/payments/999":
+			w.Write([]byte(`<html>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return &Enricher{
+		API:   NewHTTPClient(srv.URL, time.Second),
+		Cache: NewCache(time.Minute, 0),
+		Credentials: func(ctx context.Context, clientID int64) (string, error) {
+			return tokens[clientID], nil
+		},
+	}, &hits
+}
+
+// notification arma un webhook de pago como los manda MercadoPago.
+func notification(id int64, action, date string) []byte {
+	return []byte(`{"id":` + strconv.FormatInt(id, 10) + `,"type":"payment","action":"` + action +
+		`","date_created":"` + date + `","data":{"id":"123"}}`)
+}
+
+func TestEnrichFetchesThinNotifications(t *testing.T) {
+	cases := []struct {
+		name      string
+		body      string
+		wantCache bool // una redelivery de la misma notificación sale del cache
+	}{
+		{"webhook", `{"id":901,"type":"payment","action":"payment.updated","date_created":"2024-03-05T12:00:00Z","data":{"id":"123"}}`, true},
+		{"webhook numeric id", `{"id":902,"type":"payment","action":"payment.created","data":{"id":123}}`, true},
+		{"webhook without notification id", `{"type":"payment","action":"payment.updated","data":{"id":"123"}}`, false},
+		{"feed v2", `{"topic":"payment","resource":"123"}`, false},
+		{"feed v2 url", `{"topic":"payment","resource":"https://api.mercadolibre.com/collections/notifications/123"}`, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e, hits := newTestEnricher(t, map[int64]string{1: "seller-token"})
+
+			for range 2 {
+				got, err := e.Enrich(context.Background(), 1, "mercadopago", []byte(tc.body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != paymentJSON {
+					t.Errorf("body = %s", got)
+				}
+			}
+
+			want := int32(2)
+			if tc.wantCache {
+				want = 1
+			}
+			if n := atomic.LoadInt32(hits); n != want {
+				t.Errorf("API hit %d times, want %d", n, want)
+			}
+		})
+	}
+}
+
+func TestEnrichRefetchesNewNotifications(t *testing.T) {
+	e, hits := newTestEnricher(t, map[int64]string{1: "seller-token"})
+
+	// created y updated del mismo pago: el segundo puede traer la
+	// aprobación, no puede salir del cache
+	for _, body := range [][]byte{
+		notification(901, "payment.created", "2024-03-05T12:00:00Z"),
+		notification(902, "payment.updated", "2024-03-05T12:00:04Z"),
+		notification(902, "payment.updated", "2024-03-05T12:00:04Z"), // redelivery
+	} {
+		if _, err := e.Enrich(context.Background(), 1, "mercadopago", body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt32(hits); n != 2 {
+		t.Errorf("API hit %d times, want 2", n)
+	}
+}
+
+func TestEnrichCacheIsPerClient(t *testing.T) {
+	e, hits := newTestEnricher(t, map[int64]string{1: "seller-token", 2: "seller-token"})
+	body := notification(901, "payment.updated", "2024-03-05T12:00:00Z")
+
+	for _, clientID := range []int64{1, 2} {
+		if _, err := e.Enrich(context.Background(), clientID, "mercadopago", body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt32(hits); n != 2 {
+		t.Errorf("API hit %d times, want 2", n)
+	}
+}
+
+func TestEnrichPassThrough(t *testing.T) {
+	cases := []struct {
+		name     string
+		provider string
+		body     string
+	}{
+		{"other provider", "stripe", `{"type":"payment","data":{"id":"123"}}`},
+		{"full payment", "mercadopago", paymentJSON},
+		{"merchant order", "mercadopago", `{"topic":"merchant_order","resource":"456"}`},
+		{"not a notification", "mercadopago", `{"foo":"bar"}`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e, hits := newTestEnricher(t, map[int64]string{1: "seller-token"})
+
+			got, err := e.Enrich(context.Background(), 1, tc.provider, []byte(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.body {
+				t.Errorf("body = %s, want it unchanged", got)
+			}
+			if n := atomic.LoadInt32(hits); n != 0 {
+				t.Errorf("API hit %d times, want 0", n)
+			}
+		})
+	}
+}
+
+func TestEnrichErrors(t *testing.T) {
+	cases := []struct {
+		name     string
+		clientID int64
+		id       string
+		want     error
+	}{
+		{"no access token", 2, "123", ErrMissingAccessToken},
+		{"token rejected", 3, "123", ErrUnauthorized},
+		{"payment not found", 1, "404", ErrPaymentNotFound},
+		{"invalid JSON", 1, "999", nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e, _ := newTestEnricher(t, map[int64]string{1: "seller-token", 3: "revoked"})
+			body := []byte(`{"id":901,"type":"payment","data":{"id":"` + tc.id + `"}}`)
+
+			_, err := e.Enrich(context.Background(), tc.clientID, "mercadopago", body)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if tc.want != nil && !errors.Is(err, tc.want) {
+				t.Errorf("err = %v, want %v", err, tc.want)
+			}
+
+			// los errores no se cachean
+			if _, err := e.Enrich(context.Background(), tc.clientID, "mercadopago", body); err == nil {
+				t.Error("failed fetch was cached")
+			}
+		})
+	}
+}
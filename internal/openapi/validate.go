@@ -0,0 +1,332 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Kmicac/Webhook-Relay/internal/apperr"
+)
+
+const maxValidatedBodyBytes = 1 << 20 // 1 MiB
+
+var (
+	errInvalidRequest = apperr.Validation("invalid_request", "request does not match the API specification")
+	errBodyTooLarge   = apperr.New(apperr.KindTooLarge, "body_too_large", "request body too large")
+)
+
+// Validator valida parámetros de path, query y el body JSON contra la
+// operación del documento que corresponde a la ruta de Echo. Las rutas sin
+// operación pasan sin validar (CheckRoutes se encarga de que no haya).
+func (d *Document) Validator(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		op := d.Operation(c.Request().Method, c.Path())
+		if op == nil {
+			return next(c)
+		}
+
+		for _, p := range op.Parameters {
+			if err := d.validateParam(c, p); err != nil {
+				return err
+			}
+		}
+
+		if op.RequestBody != nil {
+			if err := d.validateBody(c, op.RequestBody); err != nil {
+				return err
+			}
+		}
+
+		return next(c)
+	}
+}
+
+func (d *Document) validateParam(c echo.Context, p Parameter) error {
+	var raw string
+	switch p.In {
+	case "path":
+		raw = c.Param(p.Name)
+	case "query":
+		raw = c.QueryParam(p.Name)
+	case "header":
+		raw = c.Request().Header.Get(p.Name)
+	default:
+		return nil
+	}
+
+	if raw == "" {
+		if p.Required {
+			return invalid(p.In+"."+p.Name, "is required")
+		}
+		return nil
+	}
+
+	v, err := coerce(d.Resolve(p.Schema), raw)
+	if err != nil {
+		return invalid(p.In+"."+p.Name, err.Error())
+	}
+	return d.Validate(p.Schema, v, p.In+"."+p.Name)
+}
+
+// coerce convierte un parámetro (siempre string) al tipo del schema.
+func coerce(s *Schema, raw string) (interface{}, error) {
+	if s == nil {
+		return raw, nil
+	}
+	switch s.Type {
+	case "integer":
+		if _, err := strconv.ParseInt(raw, 10, 64); err != nil {
+			return nil, errors.New("must be an integer")
+		}
+		return json.Number(raw), nil
+	case "number":
+		if _, err := strconv.ParseFloat(raw, 64); err != nil {
+			return nil, errors.New("must be a number")
+		}
+		return json.Number(raw), nil
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, errors.New("must be a boolean")
+		}
+		return b, nil
+	}
+	return raw, nil
+}
+
+// validateBody lee el body, lo valida y lo deja de nuevo en el request
+// para que el handler pueda hacer Bind.
+func (d *Document) validateBody(c echo.Context, rb *RequestBody) error {
+	mt := rb.Content[echo.MIMEApplicationJSON]
+	if mt == nil {
+		return nil
+	}
+
+	req := c.Request()
+	data, err := io.ReadAll(http.MaxBytesReader(c.Response(), req.Body, maxValidatedBodyBytes))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return errBodyTooLarge
+		}
+		return errInvalidRequest.Wrap(err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		if rb.Required {
+			return invalid("body", "is required")
+		}
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return invalid("body", "is not valid JSON")
+	}
+
+	return d.Validate(mt.Schema, v, "body")
+}
+
+// Validate valida v (decodificado con UseNumber) contra s. El error indica
+// el campo con notación de puntos, p.ej. "body.scopes[1]".
+func (d *Document) Validate(s *Schema, v interface{}, field string) error {
+	s = d.Resolve(s)
+	if s == nil {
+		return nil
+	}
+
+	if v == nil {
+		if s.Nullable {
+			return nil
+		}
+		return invalid(field, "must not be null")
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return invalid(field, "must be an object")
+		}
+		return d.validateObject(s, obj, field)
+
+	case "array":
+		arr, ok := v.([]interface{})
+		if !ok {
+			return invalid(field, "must be an array")
+		}
+		if s.MinItems != nil && len(arr) < *s.MinItems {
+			return invalid(field, fmt.Sprintf("must have at least %d items", *s.MinItems))
+		}
+		for i, item := range arr {
+			if err := d.Validate(s.Items, item, fmt.Sprintf("%s[%d]", field, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return invalid(field, "must be a string")
+		}
+		return validateString(s, str, field)
+
+	case "integer", "number":
+		n, ok := v.(json.Number)
+		if !ok {
+			return invalid(field, "must be a "+s.Type)
+		}
+		return validateNumber(s, n, field)
+
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return invalid(field, "must be a boolean")
+		}
+	}
+
+	return nil
+}
+
+func (d *Document) validateObject(s *Schema, obj map[string]interface{}, field string) error {
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			return invalid(field+"."+name, "is required")
+		}
+	}
+
+	// orden estable para que el error sea siempre el mismo
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if prop, ok := s.Properties[k]; ok {
+			if err := d.Validate(prop, obj[k], field+"."+k); err != nil {
+				return err
+			}
+			continue
+		}
+		switch extra := s.AdditionalProperties.(type) {
+		case bool:
+			if !extra {
+				return invalid(field+"."+k, "is not a known field")
+			}
+		case *Schema:
+			if err := d.Validate(extra, obj[k], field+"."+k); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateString(s *Schema, str, field string) error {
+	if len(s.Enum) > 0 && !contains(s.Enum, str) {
+		return invalid(field, "must be one of "+strings.Join(s.Enum, ", "))
+	}
+	if s.MinLength != nil && len(str) < *s.MinLength {
+		return invalid(field, fmt.Sprintf("must be at least %d characters", *s.MinLength))
+	}
+	if s.MaxLength != nil && len(str) > *s.MaxLength {
+		return invalid(field, fmt.Sprintf("must be at most %d characters", *s.MaxLength))
+	}
+	if s.Format == "date-time" {
+		if _, err := time.Parse(time.RFC3339, str); err != nil {
+			return invalid(field, "must be an RFC3339 date-time")
+		}
+	}
+	return nil
+}
+
+func validateNumber(s *Schema, n json.Number, field string) error {
+	if s.Type == "integer" {
+		if _, err := n.Int64(); err != nil {
+			return invalid(field, "must be an integer")
+		}
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return invalid(field, "must be a number")
+	}
+	if s.Minimum != nil && f < *s.Minimum {
+		return invalid(field, "must be >= "+strconv.FormatFloat(*s.Minimum, 'f', -1, 64))
+	}
+	if s.Maximum != nil && f > *s.Maximum {
+		return invalid(field, "must be <= "+strconv.FormatFloat(*s.Maximum, 'f', -1, 64))
+	}
+	return nil
+}
+
+func invalid(field, msg string) error {
+	e := *errInvalidRequest
+	e.Message = field + " " + msg
+	return &e
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckRoutes compara la tabla de rutas de Echo con el documento y
+// devuelve un error listando las diferencias en ambos sentidos.
+func (d *Document) CheckRoutes(routes []*echo.Route) error {
+	registered := map[string]bool{}
+	for _, r := range routes {
+		// rutas internas de Echo (p.ej. los RouteNotFound de los grupos)
+		if r.Method == echo.RouteNotFound || strings.Contains(r.Path, "*") {
+			continue
+		}
+		registered[r.Method+" "+Path(r.Path)] = true
+	}
+
+	documented := map[string]bool{}
+	for _, r := range d.Routes() {
+		documented[r] = true
+	}
+
+	var missing, stale []string
+	for r := range registered {
+		if !documented[r] {
+			missing = append(missing, r)
+		}
+	}
+	for r := range documented {
+		if !registered[r] {
+			stale = append(stale, r)
+		}
+	}
+	if len(missing) == 0 && len(stale) == 0 {
+		return nil
+	}
+
+	sort.Strings(missing)
+	sort.Strings(stale)
+	var parts []string
+	if len(missing) > 0 {
+		parts = append(parts, "routes not in spec: "+strings.Join(missing, ", "))
+	}
+	if len(stale) > 0 {
+		parts = append(parts, "spec operations without route: "+strings.Join(stale, ", "))
+	}
+	return fmt.Errorf("openapi spec out of sync with router: %s", strings.Join(parts, "; "))
+}
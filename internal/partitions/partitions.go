@@ -0,0 +1,371 @@
+// Package partitions mantiene las tablas particionadas por mes
+// (webhook_events y payments, ver migrations/0014). Crea las particiones
+// de los próximos meses antes de que hagan falta y desancla las que
+// quedaron fuera de la retención: desanclar es instantáneo y no genera el
+// bloat de un DELETE masivo.
+//
+// La retención por cliente/provider de internal/retention sigue borrando
+// filas sueltas dentro de los meses vivos; esto es para el volumen.
+//
+// La partición <tabla>_legacy que dejó la migración empieza en MINVALUE:
+// se desancla recién cuando vence el último mes de su rango, y hasta
+// entonces sólo la achica internal/retention.
+package partitions
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Kmicac/Webhook-Relay/internal/storage"
+)
+
+var stats = expvar.NewMap("partitions")
+
+// lockKey evita que dos workers mantengan las particiones a la vez.
+const lockKey int64 = 0x7061_7274_6974 // "partit"
+
+const (
+	defaultAhead    = 3
+	defaultInterval = 6 * time.Hour
+)
+
+// Table es una tabla particionada por rango mensual.
+type Table struct {
+	Name string
+	// RetainMonths: una partición cuyo rango terminó hace más de N meses
+	// se desancla. 0 = nunca.
+	RetainMonths int
+	// Busy es una condición SQL: si alguna fila de la partición la cumple
+	// no se desancla (p.ej. eventos todavía pendientes).
+	Busy string
+}
+
+type Manager struct {
+	db     *storage.PostgresStore
+	Tables []Table
+	// Ahead es cuántos meses después del actual tienen que existir.
+	Ahead int
+	// DropDetached borra la partición después de desanclarla; si no,
+	// queda como tabla suelta para archivarla (pg_dump) y borrarla a mano.
+	DropDetached bool
+	Interval     time.Duration
+	now          func() time.Time
+}
+
+// ManagerFromEnv arma el manager desde variables de entorno:
+//
+//	PARTITION_MONTHS_AHEAD            meses creados por adelantado (default 3)
+//	PARTITION_INTERVAL                cada cuánto corre (default 6h)
+//	WEBHOOK_EVENTS_RETAIN_MONTHS      meses que se mantienen anclados (default 0 = siempre)
+//	PAYMENTS_RETAIN_MONTHS            idem para payments (default 0)
+//	PARTITION_DROP_DETACHED           true para borrar lo desanclado (default false)
+func ManagerFromEnv(store *storage.PostgresStore) (*Manager, error) {
+	m := &Manager{
+		db:       store,
+		Interval: defaultInterval,
+		now:      time.Now,
+	}
+
+	var err error
+	if m.Ahead, err = envInt("PARTITION_MONTHS_AHEAD", defaultAhead); err != nil {
+		return nil, err
+	}
+	eventMonths, err := envInt("WEBHOOK_EVENTS_RETAIN_MONTHS", 0)
+	if err != nil {
+		return nil, err
+	}
+	paymentMonths, err := envInt("PAYMENTS_RETAIN_MONTHS", 0)
+	if err != nil {
+		return nil, err
+	}
+	if v := os.Getenv("PARTITION_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid PARTITION_INTERVAL %q", v)
+		}
+		m.Interval = d
+	}
+	if v := os.Getenv("PARTITION_DROP_DETACHED"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PARTITION_DROP_DETACHED %q", v)
+		}
+		m.DropDetached = b
+	}
+
+	m.Tables = []Table{
+		// un evento sin procesar (pendiente o esperando reintento) todavía
+		// tiene que llegar al worker
+		{Name: "webhook_events", RetainMonths: eventMonths, Busy: "processed = FALSE AND dead_at IS NULL"},
+		{Name: "payments", RetainMonths: paymentMonths},
+	}
+	return m, nil
+}
+
+// Run mantiene las particiones cada Interval hasta que se cancele ctx.
+func (m *Manager) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.Maintain(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("[Partitions] %v\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Maintain hace una pasada sobre todas las tablas si ningún otro proceso
+// la está haciendo.
+func (m *Manager) Maintain(ctx context.Context) error {
+	_, err := m.db.WithTryLock(ctx, lockKey, func() error {
+		for _, t := range m.Tables {
+			if err := m.maintain(ctx, t); err != nil {
+				return fmt.Errorf("%s: %w", t.Name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		stats.Add("errors", 1)
+	}
+	return err
+}
+
+func (m *Manager) maintain(ctx context.Context, t Table) error {
+	parts, err := m.list(ctx, t.Name)
+	if err != nil {
+		return err
+	}
+
+	// un DETACH CONCURRENTLY interrumpido deja la partición a medio
+	// desanclar hasta que se complete con FINALIZE
+	for _, p := range parts {
+		if p.DetachPending {
+			if err := m.finalize(ctx, t, p); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := m.create(ctx, t, parts); err != nil {
+		return err
+	}
+
+	if t.RetainMonths > 0 {
+		cutoff := monthStart(m.now()).AddDate(0, -t.RetainMonths, 0)
+		for _, p := range parts {
+			if p.DetachPending || p.To.IsZero() || p.To.After(cutoff) {
+				continue
+			}
+			if err := m.detach(ctx, t, p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// create agrega particiones mensuales desde la última existente hasta
+// Ahead meses después del actual. Empieza en la última y no en el mes
+// actual para no dejar huecos si el worker estuvo parado.
+func (m *Manager) create(ctx context.Context, t Table, parts []partition) error {
+	var from time.Time
+	for _, p := range parts {
+		if p.To.After(from) {
+			from = p.To
+		}
+	}
+	current := monthStart(m.now())
+	if from.IsZero() {
+		from = current
+	}
+	until := current.AddDate(0, m.Ahead+1, 0)
+
+	for start := from; start.Before(until); start = start.AddDate(0, 1, 0) {
+		end := start.AddDate(0, 1, 0)
+		name := partitionName(t.Name, start)
+		_, err := m.db.DB.Exec(ctx, fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')`,
+			pgx.Identifier{name}.Sanitize(), pgx.Identifier{t.Name}.Sanitize(),
+			start.Format(time.RFC3339), end.Format(time.RFC3339),
+		))
+		if err != nil {
+			return fmt.Errorf("create partition %s: %w", name, err)
+		}
+		stats.Add("created", 1)
+		log.Printf("[Partitions] created %s [%s, %s)\n", name, start.Format("2006-01-02"), end.Format("2006-01-02"))
+	}
+	return nil
+}
+
+// detach desancla la partición con CONCURRENTLY: no bloquea las lecturas
+// ni escrituras de la tabla mientras espera.
+func (m *Manager) detach(ctx context.Context, t Table, p partition) error {
+	if t.Busy != "" {
+		var busy bool
+		err := m.db.DB.QueryRow(ctx, fmt.Sprintf(
+			`SELECT EXISTS (SELECT 1 FROM %s WHERE %s)`,
+			pgx.Identifier{p.Name}.Sanitize(), t.Busy,
+		)).Scan(&busy)
+		if err != nil {
+			return err
+		}
+		if busy {
+			log.Printf("[Partitions] %s is past retention but still has pending rows, keeping it\n", p.Name)
+			return nil
+		}
+	}
+
+	_, err := m.db.DB.Exec(ctx, fmt.Sprintf(
+		`ALTER TABLE %s DETACH PARTITION %s CONCURRENTLY`,
+		pgx.Identifier{t.Name}.Sanitize(), pgx.Identifier{p.Name}.Sanitize(),
+	))
+	if err != nil {
+		return fmt.Errorf("detach %s: %w", p.Name, err)
+	}
+	stats.Add("detached", 1)
+	log.Printf("[Partitions] detached %s\n", p.Name)
+
+	return m.dropDetached(ctx, p)
+}
+
+func (m *Manager) finalize(ctx context.Context, t Table, p partition) error {
+	_, err := m.db.DB.Exec(ctx, fmt.Sprintf(
+		`ALTER TABLE %s DETACH PARTITION %s FINALIZE`,
+		pgx.Identifier{t.Name}.Sanitize(), pgx.Identifier{p.Name}.Sanitize(),
+	))
+	if err != nil {
+		return fmt.Errorf("finalize detach %s: %w", p.Name, err)
+	}
+	log.Printf("[Partitions] finalized detach of %s\n", p.Name)
+
+	return m.dropDetached(ctx, p)
+}
+
+func (m *Manager) dropDetached(ctx context.Context, p partition) error {
+	if !m.DropDetached {
+		return nil
+	}
+	if _, err := m.db.DB.Exec(ctx, `DROP TABLE `+pgx.Identifier{p.Name}.Sanitize()); err != nil {
+		return fmt.Errorf("drop %s: %w", p.Name, err)
+	}
+	stats.Add("dropped", 1)
+	log.Printf("[Partitions] dropped %s\n", p.Name)
+	return nil
+}
+
+// partition es una partición anclada. From/To en cero son MINVALUE/MAXVALUE.
+type partition struct {
+	Name          string
+	From, To      time.Time
+	DetachPending bool
+}
+
+// list devuelve las particiones con sus rangos. Los límites se leen con
+// TimeZone UTC para que pg_get_expr los escriba siempre igual.
+func (m *Manager) list(ctx context.Context, table string) ([]partition, error) {
+	var parts []partition
+	err := pgx.BeginFunc(ctx, m.db.DB, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SET LOCAL TimeZone = 'UTC'`); err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(
+			ctx,
+			`SELECT c.relname, pg_get_expr(c.relpartbound, c.oid), i.inhdetachpending
+             FROM pg_inherits i
+             JOIN pg_class c ON c.oid = i.inhrelid
+             WHERE i.inhparent = $1::regclass
+             ORDER BY c.relname`,
+			table,
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var (
+				p     partition
+				bound string
+			)
+			if err := rows.Scan(&p.Name, &bound, &p.DetachPending); err != nil {
+				return err
+			}
+			if p.From, p.To, err = parseBound(bound); err != nil {
+				return fmt.Errorf("partition %s: %w", p.Name, err)
+			}
+			parts = append(parts, p)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list partitions: %w", err)
+	}
+	return parts, nil
+}
+
+var boundRe = regexp.MustCompile(`^FOR VALUES FROM \((.+)\) TO \((.+)\)$`)
+
+// parseBound lee "FOR VALUES FROM ('2025-01-01 00:00:00+00') TO (...)".
+func parseBound(expr string) (from, to time.Time, err error) {
+	m := boundRe.FindStringSubmatch(expr)
+	if m == nil {
+		return from, to, fmt.Errorf("unexpected partition bound %q", expr)
+	}
+	if from, err = parseBoundValue(m[1]); err != nil {
+		return from, to, err
+	}
+	to, err = parseBoundValue(m[2])
+	return from, to, err
+}
+
+func parseBoundValue(v string) (time.Time, error) {
+	if v == "MINVALUE" || v == "MAXVALUE" {
+		return time.Time{}, nil
+	}
+	s := strings.Trim(v, "'")
+	for _, layout := range []string{"2006-01-02 15:04:05-07", "2006-01-02 15:04:05.999999-07"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unexpected partition bound value %q", v)
+}
+
+// partitionName sigue la convención de la migración: <tabla>_pAAAA_MM.
+func partitionName(table string, month time.Time) string {
+	return fmt.Sprintf("%s_p%s", table, month.UTC().Format("2006_01"))
+}
+
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func envInt(key string, def int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q", key, v)
+	}
+	return n, nil
+}
@@ -0,0 +1,170 @@
+package payments
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Adyen manda los montos en la unidad mínima de la moneda; la cantidad de
+// decimales depende de la moneda (la mayoría 2).
+// https://docs.adyen.com/development-resources/currency-codes
+var adyenExponents = map[string]int{
+	"CVE": 0, "DJF": 0, "GNF": 0, "IDR": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0,
+	"XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// eventCodes de disputas y su estado normalizado.
+var adyenDisputeStatuses = map[string]string{
+	"NOTIFICATION_OF_CHARGEBACK":   DisputeNeedsResponse,
+	"REQUEST_FOR_INFORMATION":      DisputeNeedsResponse,
+	"INFORMATION_SUPPLIED":         DisputeUnderReview,
+	"DISPUTE_DEFENSE_PERIOD_ENDED": DisputeUnderReview,
+	"CHARGEBACK":                   DisputeLost,
+	"SECOND_CHARGEBACK":            DisputeLost,
+	"PREARBITRATION_LOST":          DisputeLost,
+	"CHARGEBACK_REVERSED":          DisputeWon,
+	"PREARBITRATION_WON":           DisputeWon,
+}
+
+type adyenNotification struct {
+	NotificationItems []struct {
+		Item *adyenItem `json:"NotificationRequestItem"`
+	} `json:"notificationItems"`
+}
+
+type adyenAmountValue struct {
+	Value    flexNumber `json:"value"`
+	Currency string     `json:"currency"`
+}
+
+type adyenItem struct {
+	EventCode         string           `json:"eventCode"`
+	Success           string           `json:"success"` // "true" / "false"
+	PspReference      string           `json:"pspReference"`
+	OriginalReference string           `json:"originalReference"`
+	Amount            adyenAmountValue `json:"amount"`
+	EventDate         string           `json:"eventDate"`
+	Reason            string           `json:"reason"`
+	AdditionalData    struct {
+		ShopperEmail string `json:"shopperEmail"`
+	} `json:"additionalData"`
+}
+
+// parseAdyenPayload normaliza un lote de notificaciones de Adyen:
+//
+//	{"live":"false","notificationItems":[{"NotificationRequestItem":{...}}, ...]}
+//
+// Cada item se convierte en su propio pago, reembolso o disputa; todo el
+// lote se guarda junto. Los eventCode que no nos interesan (REPORT_AVAILABLE,
+// RECURRING_CONTRACT, ...) se saltean; un item que sí nos interesa y está
+// incompleto hace fallar el lote entero.
+func parseAdyenPayload(body []byte) (Normalized, error) {
+	var (
+		n     Normalized
+		batch adyenNotification
+	)
+	if err := decodePayload(body, &batch); err != nil {
+		return n, err
+	}
+
+	for i, wrapper := range batch.NotificationItems {
+		item := wrapper.Item
+		if item == nil {
+			continue
+		}
+
+		eventCode := item.EventCode
+		known := eventCode == "REFUND" || eventCode == "REFUND_FAILED" || eventCode == "REFUNDED_REVERSED" ||
+			adyenDisputeStatuses[eventCode] != "" || statusMaps["adyen"][eventCode] != ""
+		if !known {
+			continue
+		}
+		if err := require(fmt.Sprintf("adyen item %d (%s)", i, eventCode)).str("pspReference", item.PspReference).str("success", item.Success).num("amount.value", item.Amount.Value).err(); err != nil {
+			return Normalized{}, err
+		}
+
+		success := item.Success == "true"
+		// las modificaciones (captura, reembolso, ...) apuntan al pago
+		// original en originalReference; la autorización es el pago
+		paymentRef := firstNonEmpty(item.OriginalReference, item.PspReference)
+		amount, currency := adyenAmount(item.Amount)
+		eventDate := parseTime(item.EventDate)
+
+		switch {
+		case eventCode == "REFUND" || eventCode == "REFUND_FAILED" || eventCode == "REFUNDED_REVERSED":
+			r := Refund{
+				ExternalID:        item.PspReference,
+				PaymentExternalID: item.OriginalReference,
+				Amount:            amount,
+				Currency:          currency,
+				Reason:            item.Reason,
+			}
+			switch {
+			case eventCode == "REFUNDED_REVERSED":
+				r.Status = RefundCanceled
+			case eventCode == "REFUND" && success:
+				r.Status = RefundSucceeded
+				r.RefundedAt = eventDate
+			default:
+				r.Status = RefundFailed
+			}
+			n.Refunds = append(n.Refunds, r)
+
+		case adyenDisputeStatuses[eventCode] != "":
+			// Adyen no le da id propio a la disputa: una por pago
+			d := Dispute{
+				ExternalID:        paymentRef,
+				PaymentExternalID: paymentRef,
+				Amount:            amount,
+				Currency:          currency,
+				Status:            adyenDisputeStatuses[eventCode],
+				Reason:            item.Reason,
+			}
+			if d.Closed() {
+				d.ClosedAt = eventDate
+			} else {
+				d.OpenedAt = eventDate
+			}
+			n.Disputes = append(n.Disputes, d)
+
+		default:
+			// una modificación rechazada (captura, cancelación) no cambia
+			// el estado del pago; una autorización rechazada es un pago fallido
+			if !success && eventCode != "AUTHORISATION" {
+				continue
+			}
+			ev := PaymentEvent{
+				Kind:         KindPayment,
+				ExternalID:   paymentRef,
+				EventType:    eventCode,
+				RawStatus:    eventCode,
+				StatusDetail: item.Reason,
+				Amount:       amount,
+				Currency:     currency,
+				PayerEmail:   item.AdditionalData.ShopperEmail,
+			}
+			if !success {
+				ev.Status = StatusFailed
+			} else if eventCode == "AUTHORISATION" || eventCode == "CAPTURE" {
+				ev.ApprovedAt = eventDate
+			}
+			n.Payments = append(n.Payments, ev)
+		}
+	}
+
+	return n, nil
+}
+
+// adyenAmount lee {"value": 1000, "currency": "EUR"}.
+func adyenAmount(a adyenAmountValue) (float64, string) {
+	currency := strings.ToUpper(a.Currency)
+
+	exp, ok := adyenExponents[currency]
+	if !ok {
+		exp = 2
+	}
+	return a.Value.Float() / math.Pow10(exp), currency
+}
@@ -0,0 +1,139 @@
+package payments
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Kmicac/Webhook-Relay/internal/apperr"
+)
+
+// ErrInvalidPayload: el webhook no se puede decodificar o le faltan campos
+// obligatorios. El evento falla con el detalle en vez de guardar un pago
+// con ceros.
+var ErrInvalidPayload = apperr.Validation("invalid_payload", "invalid provider payload")
+
+// decodePayload decodifica el body en el struct del provider. Con UseNumber
+// los números que terminan en campos interface{} no pasan por float64.
+func decodePayload(body []byte, v interface{}) error {
+	if err := decodeJSON(body, v); err != nil {
+		return ErrInvalidPayload.Wrap(fmt.Errorf("invalid json: %w", err))
+	}
+	return nil
+}
+
+// decodeObject decodifica un objeto ya separado del envelope (data.object
+// de Stripe, resource de PayPal).
+func decodeObject(what string, raw json.RawMessage, v interface{}) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ErrInvalidPayload.Wrap(fmt.Errorf("%s: missing object", what))
+	}
+	if err := decodeJSON(raw, v); err != nil {
+		return ErrInvalidPayload.Wrap(fmt.Errorf("%s: %w", what, err))
+	}
+	return nil
+}
+
+func decodeJSON(body []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// flexString acepta un string o un número (p.ej. los ids de MercadoPago);
+// el número se guarda con su texto original.
+type flexString string
+
+func (s *flexString) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	if len(b) > 0 && b[0] == '"' {
+		var v string
+		if err := json.Unmarshal(b, &v); err != nil {
+			return err
+		}
+		*s = flexString(v)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return fmt.Errorf("expected a string or a number, got %s", b)
+	}
+	*s = flexString(n.String())
+	return nil
+}
+
+// flexNumber es un monto que puede venir como número o como string
+// ("10.00", PayPal y PayU). Set distingue "no vino" de un cero.
+type flexNumber struct {
+	Value json.Number
+	Set   bool
+}
+
+func (n *flexNumber) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	raw := b
+	if len(b) > 0 && b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		if s = strings.TrimSpace(s); s == "" {
+			return nil
+		}
+		raw = []byte(s)
+	}
+
+	var num json.Number
+	if err := json.Unmarshal(raw, &num); err != nil {
+		return fmt.Errorf("expected a number, got %s", b)
+	}
+	n.Value, n.Set = num, true
+	return nil
+}
+
+// Float devuelve el valor, 0 si no vino.
+func (n flexNumber) Float() float64 {
+	if !n.Set {
+		return 0
+	}
+	f, _ := n.Value.Float64()
+	return f
+}
+
+// required junta los campos obligatorios que faltan en un objeto para
+// reportarlos todos juntos.
+type required struct {
+	what    string
+	missing []string
+}
+
+func require(what string) *required {
+	return &required{what: what}
+}
+
+func (r *required) str(name, v string) *required {
+	return r.has(name, strings.TrimSpace(v) != "")
+}
+
+func (r *required) num(name string, v flexNumber) *required {
+	return r.has(name, v.Set)
+}
+
+func (r *required) has(name string, ok bool) *required {
+	if !ok {
+		r.missing = append(r.missing, name)
+	}
+	return r
+}
+
+func (r *required) err() error {
+	if len(r.missing) == 0 {
+		return nil
+	}
+	return ErrInvalidPayload.Wrap(fmt.Errorf("%s: missing %s", r.what, strings.Join(r.missing, ", ")))
+}
@@ -0,0 +1,121 @@
+package payments
+
+import (
+	"strings"
+	"time"
+)
+
+// dlocalResource es un pago, reembolso o contracargo de dLocal; los tres
+// comparten la forma.
+type dlocalResource struct {
+	ID           string     `json:"id"`
+	PaymentID    string     `json:"payment_id"`
+	Status       string     `json:"status"`
+	StatusDetail string     `json:"status_detail"`
+	Amount       flexNumber `json:"amount"`
+	Currency     string     `json:"currency"`
+	CreatedDate  string     `json:"created_date"`
+	ApprovedDate string     `json:"approved_date"`
+	Payer        struct {
+		Email string `json:"email"`
+	} `json:"payer"`
+}
+
+// dLocal manda el recurso completo en el body. El tipo se reconoce por el
+// prefijo del id: pagos "D-...", reembolsos "REF-..." y contracargos
+// "CHAR-..." (estos dos traen además payment_id).
+func parseDLocalPayload(body []byte) (Normalized, error) {
+	var res dlocalResource
+	if err := decodePayload(body, &res); err != nil {
+		return Normalized{}, err
+	}
+
+	switch {
+	case strings.HasPrefix(res.ID, "REF") && res.PaymentID != "":
+		if err := require("dlocal refund").str("status", res.Status).num("amount", res.Amount).err(); err != nil {
+			return Normalized{}, err
+		}
+		return Normalized{Refunds: []Refund{parseDLocalRefund(res)}}, nil
+	case strings.HasPrefix(res.ID, "CHAR") && res.PaymentID != "":
+		if err := require("dlocal chargeback").str("status", res.Status).num("amount", res.Amount).err(); err != nil {
+			return Normalized{}, err
+		}
+		return Normalized{Disputes: []Dispute{parseDLocalChargeback(res)}}, nil
+	}
+
+	if err := require("dlocal payment").str("id", res.ID).str("status", res.Status).num("amount", res.Amount).err(); err != nil {
+		return Normalized{}, err
+	}
+	ev := PaymentEvent{
+		Kind:         KindPayment,
+		ExternalID:   res.ID,
+		RawStatus:    res.Status,
+		StatusDetail: res.StatusDetail,
+		Amount:       res.Amount.Float(),
+		Currency:     res.Currency,
+		PayerEmail:   res.Payer.Email,
+		ApprovedAt:   parseDLocalTime(res.ApprovedDate),
+	}
+	return Normalized{Payments: []PaymentEvent{ev}}, nil
+}
+
+func parseDLocalRefund(res dlocalResource) Refund {
+	r := Refund{
+		ExternalID:        res.ID,
+		PaymentExternalID: res.PaymentID,
+		Amount:            res.Amount.Float(),
+		Currency:          res.Currency,
+		Reason:            res.StatusDetail,
+	}
+
+	switch res.Status {
+	case "SUCCESS":
+		r.Status = RefundSucceeded
+		r.RefundedAt = parseDLocalTime(res.CreatedDate)
+	case "REJECTED":
+		r.Status = RefundFailed
+	case "CANCELLED":
+		r.Status = RefundCanceled
+	default: // PENDING
+		r.Status = RefundPending
+	}
+
+	return r
+}
+
+func parseDLocalChargeback(res dlocalResource) Dispute {
+	d := Dispute{
+		ExternalID:        res.ID,
+		PaymentExternalID: res.PaymentID,
+		Amount:            res.Amount.Float(),
+		Currency:          res.Currency,
+		Reason:            res.StatusDetail,
+		OpenedAt:          parseDLocalTime(res.CreatedDate),
+	}
+
+	switch res.Status {
+	case "COMPLETED":
+		d.Status = DisputeLost
+	case "REVERSED", "DISPUTE_WON":
+		d.Status = DisputeWon
+	case "DISPUTE_IN_PROGRESS":
+		d.Status = DisputeUnderReview
+	default: // PENDING
+		d.Status = DisputeNeedsResponse
+	}
+
+	return d
+}
+
+// parseDLocalTime acepta RFC3339 y el formato de dLocal con offset sin
+// dos puntos ("2018-12-26T20:26:09.000+0000").
+func parseDLocalTime(value string) *time.Time {
+	if t := parseTime(value); t != nil {
+		return t
+	}
+	t, err := time.Parse("2006-01-02T15:04:05.000-0700", value)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
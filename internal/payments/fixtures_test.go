@@ -0,0 +1,133 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readFixture devuelve el provider y el payload de un request de
+// internal/webhooks/testdata: el .json que deja el test de firmas de ese
+// paquete (el body tal cual o, en PayU, el formulario pasado a JSON). El
+// provider es el prefijo del nombre.
+func readFixture(t *testing.T, name string) (string, []byte) {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("..", "webhooks", "testdata", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider, _, _ := strings.Cut(name, "_")
+	return provider, bytes.TrimRight(body, "\n")
+}
+
+func fixtureTime(t *testing.T, layout, value string) *time.Time {
+	t.Helper()
+	ts, err := time.Parse(layout, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ts
+}
+
+func TestNormalizeFixtures(t *testing.T) {
+	const dlocalLayout = "2006-01-02T15:04:05.000-0700"
+
+	cases := []struct {
+		fixture string
+		want    Normalized
+	}{
+		{
+			fixture: "dlocal_payment_paid",
+			want: Normalized{Payments: []PaymentEvent{{
+				ExternalID:   "D-4-7c6a3b2e-9f41-4d1a-8e2b-5a0c1f3e7d90",
+				Kind:         KindPayment,
+				Status:       StatusCaptured,
+				RawStatus:    "PAID",
+				StatusDetail: "The payment was paid.",
+				Amount:       120,
+				Currency:     "BRL",
+				PayerEmail:   "maria.souza@example.com",
+				ApprovedAt:   fixtureTime(t, dlocalLayout, "2024-03-05T14:22:30.000+0000"),
+				Provider:     "dlocal",
+			}}},
+		},
+		{
+			fixture: "dlocal_refund_success",
+			want: Normalized{Refunds: []Refund{{
+				Provider:          "dlocal",
+				ExternalID:        "REF-42342-3e1f9a7b-0c2d-4b8e-a6f5-1d9c8b7a6e50",
+				PaymentExternalID: "D-4-7c6a3b2e-9f41-4d1a-8e2b-5a0c1f3e7d90",
+				Amount:            20,
+				Currency:          "BRL",
+				Status:            RefundSucceeded,
+				Reason:            "The refund was paid",
+				RefundedAt:        fixtureTime(t, dlocalLayout, "2024-03-07T09:10:02.000+0000"),
+			}}},
+		},
+		{
+			fixture: "dlocal_chargeback_completed",
+			want: Normalized{Disputes: []Dispute{{
+				Provider:          "dlocal",
+				ExternalID:        "CHAR42-2024-0402-8d7e6f5a",
+				PaymentExternalID: "D-4-7c6a3b2e-9f41-4d1a-8e2b-5a0c1f3e7d90",
+				Amount:            100,
+				Currency:          "BRL",
+				Status:            DisputeLost,
+				Reason:            "The chargeback was completed",
+				OpenedAt:          fixtureTime(t, dlocalLayout, "2024-04-01T12:30:00.000+0000"),
+			}}},
+		},
+		{
+			fixture: "payu_confirmation_approved",
+			want: Normalized{Payments: []PaymentEvent{{
+				ExternalID:   "e5a8f4b2-6c1d-4f7e-9a3b-2d8c7e6f5a41",
+				Kind:         KindPayment,
+				Status:       StatusCaptured,
+				RawStatus:    "4",
+				StatusDetail: "APPROVED",
+				Amount:       150000,
+				Currency:     "COP",
+				PayerEmail:   "juan.perez@example.com",
+				ApprovedAt:   fixtureTime(t, "2006-01-02 15:04:05", "2024-03-05 09:41:27"),
+				Provider:     "payu",
+			}}},
+		},
+		{
+			fixture: "payu_confirmation_declined_sha256",
+			want: Normalized{Payments: []PaymentEvent{{
+				ExternalID:   "0b9c8d7e-6f5a-4b3c-8d2e-1f0a9b8c7d61",
+				Kind:         KindPayment,
+				Status:       StatusFailed,
+				RawStatus:    "6",
+				StatusDetail: "ANTIFRAUD_REJECTED",
+				Amount:       89990.5,
+				Currency:     "COP",
+				PayerEmail:   "juan.perez@example.com",
+				Provider:     "payu",
+			}}},
+		},
+	}
+
+	s := &Service{}
+	for _, tc := range cases {
+		t.Run(tc.fixture, func(t *testing.T) {
+			provider, body := readFixture(t, tc.fixture)
+
+			got, err := s.normalize(context.Background(), body, 1, nil, provider)
+			if err != nil {
+				t.Fatalf("normalize: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				gotJSON, _ := json.MarshalIndent(got, "", "  ")
+				wantJSON, _ := json.MarshalIndent(tc.want, "", "  ")
+				t.Errorf("got %s\nwant %s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kmicac/Webhook-Relay/internal/generic"
+)
+
+// GenericConfigFunc devuelve la configuración del provider generic de un
+// cliente (ver package generic).
+type GenericConfigFunc func(ctx context.Context, clientID int64) (*generic.Config, error)
+
+// parseGenericPayload arma el pago con el mapping JSONPath del cliente. El
+// estado pasa por status_map si está; si no, tiene que venir ya canónico.
+func parseGenericPayload(cfg *generic.Config, body []byte) (Normalized, error) {
+	var (
+		n   Normalized
+		doc interface{}
+	)
+	if err := decodePayload(body, &doc); err != nil {
+		return n, err
+	}
+
+	ev := PaymentEvent{
+		Kind:         KindPayment,
+		ExternalID:   genericString(cfg, doc, generic.FieldID),
+		EventType:    genericString(cfg, doc, generic.FieldEventType),
+		RawStatus:    genericString(cfg, doc, generic.FieldStatus),
+		StatusDetail: genericString(cfg, doc, generic.FieldStatusDetail),
+		Currency:     strings.ToUpper(genericString(cfg, doc, generic.FieldCurrency)),
+		PayerEmail:   genericString(cfg, doc, generic.FieldPayerEmail),
+	}
+	amount, hasAmount := cfg.Lookup(doc, generic.FieldAmount)
+
+	// los faltantes se reportan con la expresión del mapping
+	if err := require("generic payload").
+		str(cfg.Mapping[generic.FieldID], ev.ExternalID).
+		str(cfg.Mapping[generic.FieldStatus], ev.RawStatus).
+		has(cfg.Mapping[generic.FieldAmount], hasAmount).
+		err(); err != nil {
+		return n, err
+	}
+
+	value, err := genericAmount(amount)
+	if err != nil {
+		return n, ErrInvalidPayload.Wrap(fmt.Errorf("generic payload: %s: %w", cfg.Mapping[generic.FieldAmount], err))
+	}
+	ev.Amount = value / math.Pow10(cfg.AmountDecimals)
+
+	if v, ok := cfg.Lookup(doc, generic.FieldApprovedAt); ok {
+		ev.ApprovedAt = genericTime(v)
+	}
+
+	if s, ok := cfg.StatusMap[ev.RawStatus]; ok {
+		ev.Status = s
+	}
+
+	n.Payments = []PaymentEvent{ev}
+	return n, nil
+}
+
+// genericString convierte el valor mapeado a string; los números quedan
+// con su texto original.
+func genericString(cfg *generic.Config, doc interface{}, field string) string {
+	v, ok := cfg.Lookup(doc, field)
+	if !ok {
+		return ""
+	}
+	switch t := v.(type) {
+	case string:
+		return t
+	case json.Number:
+		return t.String()
+	case bool:
+		return strconv.FormatBool(t)
+	}
+	return ""
+}
+
+// genericAmount acepta el monto como número o como string ("12.50").
+func genericAmount(v interface{}) (float64, error) {
+	switch t := v.(type) {
+	case json.Number:
+		return t.Float64()
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(t), 64)
+	}
+	return 0, fmt.Errorf("expected a number, got %T", v)
+}
+
+// genericTime acepta RFC3339 o un timestamp unix (segundos o milisegundos).
+func genericTime(v interface{}) *time.Time {
+	switch t := v.(type) {
+	case string:
+		return parseTime(t)
+	case json.Number:
+		n, err := t.Int64()
+		if err != nil || n <= 0 {
+			return nil
+		}
+		var ts time.Time
+		if n > 1e12 {
+			ts = time.UnixMilli(n)
+		} else {
+			ts = time.Unix(n, 0)
+		}
+		return &ts
+	}
+	return nil
+}
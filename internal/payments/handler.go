@@ -0,0 +1,39 @@
+package payments
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Kmicac/Webhook-Relay/internal/auth"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// GET /admin/payments/:provider/:external_id?client=
+// Neto del pago con sus reembolsos y disputas. Las keys de un cliente sólo
+// ven sus pagos; los demás cuentan como inexistentes. Una key global elige
+// el cliente con ?client= si el pago existe en más de uno.
+func (h *Handler) GetBalance(c echo.Context) error {
+	f := BalanceFilter{
+		Provider:   c.Param("provider"),
+		ExternalID: c.Param("external_id"),
+		ClientUID:  c.QueryParam("client"),
+	}
+	if p := auth.PrincipalFrom(c); p != nil {
+		f.ClientID = p.ClientID
+	}
+
+	balance, err := h.service.Balance(c.Request().Context(), f)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, balance)
+}
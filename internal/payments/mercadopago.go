@@ -0,0 +1,183 @@
+package payments
+
+import "time"
+
+// mpPayment es el recurso de /v1/payments (sólo los campos que usamos).
+type mpPayment struct {
+	ID                        flexString `json:"id"`
+	Status                    string     `json:"status"`
+	StatusDetail              string     `json:"status_detail"`
+	TransactionAmount         flexNumber `json:"transaction_amount"`
+	Amount                    flexNumber `json:"amount"` // payloads viejos / de prueba
+	TransactionAmountRefunded flexNumber `json:"transaction_amount_refunded"`
+	CurrencyID                string     `json:"currency_id"`
+	DateApproved              string     `json:"date_approved"`
+	DateLastUpdated           string     `json:"date_last_updated"`
+	Payer                     struct {
+		Email string `json:"email"`
+	} `json:"payer"`
+	Refunds []mpRefund `json:"refunds"`
+}
+
+type mpRefund struct {
+	ID          flexString `json:"id"`
+	Status      string     `json:"status"`
+	Amount      flexNumber `json:"amount"`
+	Reason      string     `json:"reason"`
+	DateCreated string     `json:"date_created"`
+}
+
+// parseMercadoPagoPayload normaliza un pago de /v1/payments. El pago trae
+// sus reembolsos (refunds) y el estado de la disputa, si la hay, así que
+// un mismo webhook puede generar las tres cosas.
+func parseMercadoPagoPayload(body []byte) (Normalized, error) {
+	var p mpPayment
+	if err := decodePayload(body, &p); err != nil {
+		return Normalized{}, err
+	}
+
+	amount := p.TransactionAmount
+	if !amount.Set {
+		amount = p.Amount
+	}
+	if err := require("mercadopago payment").str("id", string(p.ID)).str("status", p.Status).num("transaction_amount", amount).err(); err != nil {
+		return Normalized{}, err
+	}
+
+	ev := &PaymentEvent{
+		Kind:         KindPayment,
+		ExternalID:   string(p.ID),
+		RawStatus:    p.Status,
+		StatusDetail: p.StatusDetail,
+		Amount:       amount.Float(),
+		Currency:     p.CurrencyID,
+		PayerEmail:   p.Payer.Email,
+		ApprovedAt:   parseTime(p.DateApproved),
+	}
+
+	// un reembolso parcial deja el pago "approved"; el detalle lo dice
+	if ev.RawStatus == "approved" && ev.StatusDetail == "partially_refunded" {
+		ev.Status = StatusPartiallyRefunded
+	}
+
+	refunds, err := parseMercadoPagoRefunds(p, ev)
+	if err != nil {
+		return Normalized{}, err
+	}
+
+	n := Normalized{
+		Payments: []PaymentEvent{*ev},
+		Refunds:  refunds,
+	}
+	if d := parseMercadoPagoDispute(p, ev); d != nil {
+		n.Disputes = []Dispute{*d}
+	}
+	return n, nil
+}
+
+func parseMercadoPagoRefunds(p mpPayment, ev *PaymentEvent) ([]Refund, error) {
+	var refunds []Refund
+	for _, item := range p.Refunds {
+		if err := require("mercadopago refund").str("id", string(item.ID)).num("amount", item.Amount).err(); err != nil {
+			return nil, err
+		}
+		r := Refund{
+			ExternalID:        string(item.ID),
+			PaymentExternalID: ev.ExternalID,
+			Amount:            item.Amount.Float(),
+			Currency:          ev.Currency,
+			Reason:            item.Reason,
+		}
+		switch item.Status {
+		case "approved":
+			r.Status = RefundSucceeded
+			r.RefundedAt = parseTime(item.DateCreated)
+		case "rejected":
+			r.Status = RefundFailed
+		case "cancelled":
+			r.Status = RefundCanceled
+		default: // in_process, authorized
+			r.Status = RefundPending
+		}
+		refunds = append(refunds, r)
+	}
+	if len(refunds) > 0 {
+		return refunds, nil
+	}
+
+	// algunas respuestas sólo traen el total reembolsado
+	if amount := p.TransactionAmountRefunded.Float(); amount > 0 {
+		return []Refund{{
+			ExternalID:        cumulativeRefundID(ev.ExternalID),
+			PaymentExternalID: ev.ExternalID,
+			Amount:            amount,
+			Currency:          ev.Currency,
+			Status:            RefundSucceeded,
+			Cumulative:        true,
+		}}, nil
+	}
+
+	return nil, nil
+}
+
+// parseMercadoPagoDispute deriva la disputa del estado del pago. MercadoPago
+// no le da id propio en el pago: hay a lo sumo una por pago y usamos el id
+// del pago.
+//
+//	in_mediation                    reclamo abierto         -> under_review
+//	charged_back / in_process       contracargo en curso    -> under_review
+//	charged_back / settled          contracargo perdido     -> lost
+//	charged_back / reimbursed       contracargo ganado      -> won
+//	approved (después de mediación) resuelto a favor        -> won
+//	refunded (después de mediación) resuelto con devolución -> closed
+//
+// En el último caso la plata ya está en el reembolso: cerrarla como lost
+// la descontaría dos veces del neto.
+func parseMercadoPagoDispute(p mpPayment, ev *PaymentEvent) *Dispute {
+	d := &Dispute{
+		ExternalID:        ev.ExternalID,
+		PaymentExternalID: ev.ExternalID,
+		Amount:            ev.Amount,
+		Currency:          ev.Currency,
+		Reason:            ev.StatusDetail,
+	}
+	updatedAt := parseTime(p.DateLastUpdated)
+
+	switch ev.RawStatus {
+	case "in_mediation":
+		d.Status = DisputeUnderReview
+	case "charged_back":
+		switch ev.StatusDetail {
+		case "settled":
+			d.Status = DisputeLost
+		case "reimbursed":
+			d.Status = DisputeWon
+		default:
+			d.Status = DisputeUnderReview
+		}
+	case "approved":
+		d.Status, d.resolveOnly = DisputeWon, true
+	case "refunded":
+		d.Status, d.resolveOnly = DisputeClosed, true
+	default:
+		return nil
+	}
+
+	if d.Closed() {
+		d.ClosedAt = updatedAt
+	} else {
+		d.OpenedAt = updatedAt
+	}
+	return d
+}
+
+func parseTime(value string) *time.Time {
+	if value == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,217 @@
+package payments
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// paypalEvent es el envelope de los webhooks de PayPal.
+type paypalEvent struct {
+	EventType string          `json:"event_type"`
+	Resource  json.RawMessage `json:"resource"`
+}
+
+type paypalMoney struct {
+	Value        flexNumber `json:"value"` // string ("10.00")
+	CurrencyCode string     `json:"currency_code"`
+}
+
+type paypalLink struct {
+	Href string `json:"href"`
+	Rel  string `json:"rel"`
+}
+
+// paypalResource es una Capture, Authorization u Order; también el
+// payload sin envelope.
+type paypalResource struct {
+	ID           string      `json:"id"`
+	Status       string      `json:"status"`
+	StatusDetail string      `json:"status_detail"`
+	Amount       paypalMoney `json:"amount"`
+	UpdateTime   string      `json:"update_time"`
+	Payer        struct {
+		EmailAddress string `json:"email_address"`
+	} `json:"payer"`
+}
+
+type paypalRefund struct {
+	ID          string       `json:"id"`
+	Status      string       `json:"status"`
+	Amount      paypalMoney  `json:"amount"`
+	NoteToPayer string       `json:"note_to_payer"`
+	CreateTime  string       `json:"create_time"`
+	UpdateTime  string       `json:"update_time"`
+	Links       []paypalLink `json:"links"`
+}
+
+type paypalDispute struct {
+	DisputeID            string      `json:"dispute_id"`
+	Status               string      `json:"status"`
+	Reason               string      `json:"reason"`
+	DisputeAmount        paypalMoney `json:"dispute_amount"`
+	CreateTime           string      `json:"create_time"`
+	UpdateTime           string      `json:"update_time"`
+	DisputedTransactions []struct {
+		SellerTransactionID string `json:"seller_transaction_id"`
+	} `json:"disputed_transactions"`
+	DisputeOutcome struct {
+		OutcomeCode string `json:"outcome_code"`
+	} `json:"dispute_outcome"`
+}
+
+// parsePaypalPayload normaliza un webhook de PayPal. Los webhooks reales
+// vienen envueltos ({"event_type": ..., "resource": {...}}) y el recurso
+// depende del tipo; sin envelope se toma el payload como el recurso de
+// pago, que es lo que se aceptaba antes.
+func parsePaypalPayload(body []byte) (Normalized, error) {
+	var event paypalEvent
+	if err := decodePayload(body, &event); err != nil {
+		return Normalized{}, err
+	}
+
+	eventType := event.EventType
+	resource := event.Resource
+	if eventType == "" || len(resource) == 0 || string(resource) == "null" {
+		ev, err := parsePaypalResource(body)
+		if err != nil {
+			return Normalized{}, err
+		}
+		return Normalized{Payments: []PaymentEvent{*ev}}, nil
+	}
+
+	switch {
+	case eventType == "PAYMENT.CAPTURE.REFUNDED":
+		r, err := parsePaypalRefund(resource)
+		if err != nil {
+			return Normalized{}, err
+		}
+		return Normalized{Refunds: []Refund{r}}, nil
+	case strings.HasPrefix(eventType, "CUSTOMER.DISPUTE."):
+		d, err := parsePaypalDispute(resource)
+		if err != nil {
+			return Normalized{}, err
+		}
+		return Normalized{Disputes: []Dispute{*d}}, nil
+	default:
+		ev, err := parsePaypalResource(resource)
+		if err != nil {
+			return Normalized{}, err
+		}
+		ev.EventType = eventType
+		// CREATED es "autorizado" en una Authorization y "pendiente" en una Order
+		if strings.HasPrefix(eventType, "PAYMENT.AUTHORIZATION.") && ev.RawStatus == "CREATED" {
+			ev.Status = StatusAuthorized
+		}
+		return Normalized{Payments: []PaymentEvent{*ev}}, nil
+	}
+}
+
+func parsePaypalResource(raw json.RawMessage) (*PaymentEvent, error) {
+	var res paypalResource
+	if err := decodeObject("paypal resource", raw, &res); err != nil {
+		return nil, err
+	}
+	if err := require("paypal resource").str("id", res.ID).str("status", res.Status).num("amount.value", res.Amount.Value).err(); err != nil {
+		return nil, err
+	}
+
+	return &PaymentEvent{
+		Kind:         KindPayment,
+		ExternalID:   res.ID,
+		RawStatus:    res.Status,
+		StatusDetail: res.StatusDetail,
+		Amount:       res.Amount.Value.Float(),
+		Currency:     res.Amount.CurrencyCode,
+		PayerEmail:   res.Payer.EmailAddress,
+		ApprovedAt:   parseTime(res.UpdateTime),
+	}, nil
+}
+
+// parsePaypalRefund lee el recurso Refund de PAYMENT.CAPTURE.REFUNDED. El
+// id de la captura (nuestro pago) sólo viene en el link "up".
+func parsePaypalRefund(raw json.RawMessage) (Refund, error) {
+	var res paypalRefund
+	if err := decodeObject("paypal refund", raw, &res); err != nil {
+		return Refund{}, err
+	}
+	if err := require("paypal refund").str("id", res.ID).str("status", res.Status).num("amount.value", res.Amount.Value).err(); err != nil {
+		return Refund{}, err
+	}
+
+	r := Refund{
+		ExternalID:        res.ID,
+		PaymentExternalID: paypalLinkID(res.Links, "up"),
+		Amount:            res.Amount.Value.Float(),
+		Currency:          res.Amount.CurrencyCode,
+		Reason:            res.NoteToPayer,
+	}
+
+	switch res.Status {
+	case "COMPLETED":
+		r.Status = RefundSucceeded
+		r.RefundedAt = parseTime(firstNonEmpty(res.CreateTime, res.UpdateTime))
+	case "FAILED":
+		r.Status = RefundFailed
+	case "CANCELLED":
+		r.Status = RefundCanceled
+	default: // PENDING
+		r.Status = RefundPending
+	}
+
+	return r, nil
+}
+
+// parsePaypalDispute lee el recurso Dispute de CUSTOMER.DISPUTE.*. El pago
+// disputado es la transacción del vendedor (el id de la captura).
+func parsePaypalDispute(raw json.RawMessage) (*Dispute, error) {
+	var res paypalDispute
+	if err := decodeObject("paypal dispute", raw, &res); err != nil {
+		return nil, err
+	}
+	if err := require("paypal dispute").str("dispute_id", res.DisputeID).str("status", res.Status).num("dispute_amount.value", res.DisputeAmount.Value).err(); err != nil {
+		return nil, err
+	}
+
+	d := &Dispute{
+		ExternalID: res.DisputeID,
+		Amount:     res.DisputeAmount.Value.Float(),
+		Currency:   res.DisputeAmount.CurrencyCode,
+		Reason:     res.Reason,
+		OpenedAt:   parseTime(res.CreateTime),
+	}
+	if len(res.DisputedTransactions) > 0 {
+		d.PaymentExternalID = res.DisputedTransactions[0].SellerTransactionID
+	}
+
+	switch res.Status {
+	case "RESOLVED":
+		switch res.DisputeOutcome.OutcomeCode {
+		case "RESOLVED_SELLER_FAVOUR", "DENIED":
+			d.Status = DisputeWon
+		case "RESOLVED_BUYER_FAVOUR", "ACCEPTED":
+			d.Status = DisputeLost
+		default: // CANCELED_BY_BUYER, RESOLVED_WITH_PAYOUT, NONE
+			d.Status = DisputeClosed
+		}
+		d.ClosedAt = parseTime(res.UpdateTime)
+	case "OPEN", "WAITING_FOR_SELLER_RESPONSE":
+		d.Status = DisputeNeedsResponse
+	default: // WAITING_FOR_BUYER_RESPONSE, UNDER_REVIEW, OTHER
+		d.Status = DisputeUnderReview
+	}
+
+	return d, nil
+}
+
+// paypalLinkID devuelve el último segmento del href del link con ese rel
+// (p.ej. .../v2/payments/captures/ID para "up").
+func paypalLinkID(links []paypalLink, rel string) string {
+	for _, link := range links {
+		if link.Rel != rel {
+			continue
+		}
+		href := strings.TrimRight(link.Href, "/")
+		return href[strings.LastIndex(href, "/")+1:]
+	}
+	return ""
+}
@@ -0,0 +1,52 @@
+package payments
+
+import "time"
+
+// payuConfirmation son los campos de la confirmación que usamos; todos
+// llegan como strings del formulario.
+type payuConfirmation struct {
+	TransactionID      string     `json:"transaction_id"`
+	ReferencePol       string     `json:"reference_pol"`
+	StatePol           string     `json:"state_pol"`
+	ResponseMessagePol string     `json:"response_message_pol"`
+	ResponseCodePol    string     `json:"response_code_pol"`
+	Value              flexNumber `json:"value"`
+	Currency           string     `json:"currency"`
+	EmailBuyer         string     `json:"email_buyer"`
+	TransactionDate    string     `json:"transaction_date"`
+}
+
+// parsePayUPayload normaliza la confirmación de PayU Latam. Llega como
+// formulario y se procesa convertida a un objeto JSON de strings.
+// state_pol es numérico: 4 aprobada, 6 rechazada, 5 expirada, 7 pendiente.
+func parsePayUPayload(body []byte) (Normalized, error) {
+	var c payuConfirmation
+	if err := decodePayload(body, &c); err != nil {
+		return Normalized{}, err
+	}
+
+	id := firstNonEmpty(c.TransactionID, c.ReferencePol)
+	if err := require("payu confirmation").str("transaction_id", id).str("state_pol", c.StatePol).num("value", c.Value).err(); err != nil {
+		return Normalized{}, err
+	}
+
+	ev := PaymentEvent{
+		Kind:         KindPayment,
+		ExternalID:   id,
+		RawStatus:    c.StatePol,
+		StatusDetail: firstNonEmpty(c.ResponseMessagePol, c.ResponseCodePol),
+		Amount:       c.Value.Float(),
+		Currency:     c.Currency,
+		PayerEmail:   c.EmailBuyer,
+	}
+
+	// transaction_date viene sin zona ("2024-01-10 10:00:00"); lo tomamos
+	// como UTC
+	if ev.RawStatus == "4" {
+		if t, err := time.Parse("2006-01-02 15:04:05", c.TransactionDate); err == nil {
+			ev.ApprovedAt = &t
+		}
+	}
+
+	return Normalized{Payments: []PaymentEvent{ev}}, nil
+}
@@ -0,0 +1,106 @@
+package payments
+
+import "time"
+
+// Estados normalizados de un reembolso.
+const (
+	RefundPending   = "pending"
+	RefundSucceeded = "succeeded"
+	RefundFailed    = "failed"
+	RefundCanceled  = "canceled"
+)
+
+// Ciclo de vida normalizado de una disputa (contracargo, reclamo o
+// mediación, según el provider).
+const (
+	DisputeNeedsResponse = "needs_response" // abierta, falta mandar evidencia
+	DisputeUnderReview   = "under_review"   // evidencia enviada / en mediación
+	DisputeWon           = "won"
+	DisputeLost          = "lost"
+	DisputeClosed        = "closed" // cerrada sin ganador (retirada, aceptada sin cargo, ...)
+)
+
+// Refund es un reembolso, total o parcial, de un pago.
+//
+// Cumulative marca los registros sintéticos de los providers que sólo
+// informan el total reembolsado del pago (sin id por reembolso): su Amount
+// es acumulado y no se suma con los demás.
+type Refund struct {
+	ID                int64      `json:"id"`
+	Provider          string     `json:"provider"`
+	ExternalID        string     `json:"external_id"`
+	PaymentExternalID string     `json:"payment_external_id"`
+	Amount            float64    `json:"amount"`
+	Currency          string     `json:"currency"`
+	Status            string     `json:"status"`
+	Reason            string     `json:"reason,omitempty"`
+	Cumulative        bool       `json:"cumulative"`
+	RefundedAt        *time.Time `json:"refunded_at,omitempty"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// Dispute es una disputa sobre un pago. Cada cambio de estado queda en
+// dispute_events.
+type Dispute struct {
+	ID                int64      `json:"id"`
+	Provider          string     `json:"provider"`
+	ExternalID        string     `json:"external_id"`
+	PaymentExternalID string     `json:"payment_external_id"`
+	Amount            float64    `json:"amount"`
+	Currency          string     `json:"currency"`
+	Status            string     `json:"status"`
+	Reason            string     `json:"reason,omitempty"`
+	OpenedAt          *time.Time `json:"opened_at,omitempty"`
+	ClosedAt          *time.Time `json:"closed_at,omitempty"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+
+	// resolveOnly: el webhook sólo puede cerrar una disputa abierta que ya
+	// conocemos, no crearla (ver parseMercadoPagoDispute)
+	resolveOnly bool
+}
+
+// Closed indica si la disputa ya terminó.
+func (d *Dispute) Closed() bool {
+	switch d.Status {
+	case DisputeWon, DisputeLost, DisputeClosed:
+		return true
+	}
+	return false
+}
+
+// Normalized es lo que se extrae de un webhook: pagos, reembolsos y/o
+// disputas. Un webhook puede traer varias cosas a la vez (el pago de
+// MercadoPago trae sus reembolsos, Adyen manda lotes); si no trae nada se
+// ignora.
+type Normalized struct {
+	Payments []PaymentEvent
+	Refunds  []Refund
+	Disputes []Dispute
+}
+
+func (n Normalized) empty() bool {
+	return len(n.Payments) == 0 && len(n.Refunds) == 0 && len(n.Disputes) == 0
+}
+
+// Balance es el neto de un pago para finanzas:
+// Net = Gross - Refunded - DisputedLost. DisputedOpen es lo que está en
+// disputa y todavía puede perderse.
+type Balance struct {
+	ClientID     *int64    `json:"client_id,omitempty"`
+	Provider     string    `json:"provider"`
+	ExternalID   string    `json:"external_id"`
+	Currency     string    `json:"currency"`
+	Gross        float64   `json:"gross"`
+	Refunded     float64   `json:"refunded"`
+	DisputedLost float64   `json:"disputed_lost"`
+	DisputedOpen float64   `json:"disputed_open"`
+	Net          float64   `json:"net"`
+	Refunds      []Refund  `json:"refunds"`
+	Disputes     []Dispute `json:"disputes"`
+}
+
+// cumulativeRefundID es el external_id del registro acumulado de un pago;
+// el prefijo evita chocar con los ids de reembolsos reales.
+func cumulativeRefundID(paymentRef string) string {
+	return "total:" + paymentRef
+}
@@ -2,33 +2,187 @@ package payments
 
 import (
 	"context"
+	"errors"
 	"log"
+	"time"
 
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Kmicac/Webhook-Relay/internal/apperr"
 	"github.com/Kmicac/Webhook-Relay/internal/storage"
 )
 
 type Repository struct {
-	db *storage.PostgresStore
+	db storage.DBTX
 }
 
 func NewRepository(store *storage.PostgresStore) *Repository {
-	return &Repository{db: store}
-}
-
-func (r *Repository) Save(event PaymentEvent, webhookEventID int64) error {
-	_, err := r.db.DB.Exec(
-		context.Background(),
-		`INSERT INTO payments (
-            external_id,
-            status,
-            status_detail,
-            amount,
-            currency,
-            payer_email,
-            approved_at,
-            provider,
-            webhook_event_id
-        ) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`,
+	return &Repository{db: store.DB}
+}
+
+// WithTx devuelve el repositorio trabajando dentro de tx (ver
+// storage.UnitOfWork).
+func (r *Repository) WithTx(tx pgx.Tx) *Repository {
+	return &Repository{db: tx}
+}
+
+var ErrPaymentNotFound = apperr.NotFound("payment_not_found", "payment not found")
+
+// Save guarda todo lo que trajo un webhook en una transacción: si falla
+// algo el evento queda para reintentar sin registros a medias. clientID
+// es el cliente que recibió el webhook (nil en eventos sin cliente).
+func (r *Repository) Save(ctx context.Context, n Normalized, webhookEventID int64, clientID *int64) error {
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		for _, payment := range n.Payments {
+			if err := insertPayment(ctx, tx, payment, webhookEventID, clientID); err != nil {
+				return err
+			}
+		}
+		return saveRefundsAndDisputes(ctx, tx, n, webhookEventID, clientID)
+	})
+
+	if err != nil {
+		log.Printf("[PaymentRepository] error saving webhook event %d: %v", webhookEventID, err)
+	}
+
+	return err
+}
+
+// SaveItem es lo que trajo un webhook de un lote.
+type SaveItem struct {
+	Normalized     Normalized
+	WebhookEventID int64
+	ClientID       *int64
+}
+
+// SaveBatch guarda un lote de webhooks en una sola transacción: los pagos
+// van todos juntos en un pgx.Batch (un viaje a la base) y los reembolsos y
+// disputas uno por uno. Si falla, no queda nada del lote; el que llama
+// decide si reintenta de a uno (ver Service.ProcessBatch).
+func (r *Repository) SaveBatch(ctx context.Context, items []SaveItem) error {
+	b := &pgx.Batch{}
+	for _, item := range items {
+		for _, payment := range item.Normalized.Payments {
+			b.Queue(savePaymentSQL, paymentRow(payment, item.WebhookEventID, item.ClientID)...)
+		}
+	}
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		if b.Len() > 0 {
+			if err := tx.SendBatch(ctx, b).Close(); err != nil {
+				return err
+			}
+		}
+		for _, item := range items {
+			if err := saveRefundsAndDisputes(ctx, tx, item.Normalized, item.WebhookEventID, item.ClientID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		log.Printf("[PaymentRepository] error saving batch of %d webhook events: %v", len(items), err)
+	}
+
+	return err
+}
+
+// saveRefundsAndDisputes guarda los reembolsos y disputas de un webhook.
+// Son del cliente que lo recibió: los ids los elige el comercio en algunos
+// providers (PayU, genérico) y dos clientes pueden repetirlos.
+func saveRefundsAndDisputes(ctx context.Context, tx pgx.Tx, n Normalized, webhookEventID int64, clientID *int64) error {
+	for _, refund := range n.Refunds {
+		if err := upsertRefund(ctx, tx, refund, webhookEventID, clientID); err != nil {
+			return err
+		}
+	}
+	for _, dispute := range n.Disputes {
+		if err := upsertDispute(ctx, tx, dispute, webhookEventID, clientID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// savePaymentSQL guarda un pago de forma idempotente contra su estado
+// actual en payment_states (por client_id, provider, kind, external_id):
+//
+//   - si el webhook repite el estado (replay, redelivery del provider) no
+//     hace nada;
+//   - si llega tarde y desordenado (un "pending" después del "captured",
+//     ver supersededBy) tampoco: no pisa un estado más avanzado;
+//   - si no, agrega la fila a payments, crea o actualiza payment_states y,
+//     si cambió el status, lo deja en payment_status_changes.
+//
+// El estado previo se lee con FOR UPDATE, así dos webhooks del mismo pago
+// se serializan. Si los dos traen un pago nuevo, el segundo choca con el
+// UNIQUE de payment_states y su evento se reintenta (y ya ve el estado).
+// Los parámetros son los de paymentRow.
+const savePaymentSQL = `
+WITH prev AS (
+    SELECT id, status, raw_status, status_detail, amount, currency
+    FROM payment_states
+    WHERE client_id IS NOT DISTINCT FROM $13::bigint
+      AND provider = $8::text AND kind = $10::text AND external_id = $1::text
+    FOR UPDATE
+),
+ins AS (
+    INSERT INTO payments (
+        external_id, status, status_detail, amount, currency, payer_email, approved_at,
+        provider, webhook_event_id, kind, event_type, raw_status, client_id
+    )
+    SELECT $1, $2::text, $3::text, $4::numeric, $5::text, $6::text, $7::timestamptz,
+           $8, $9::bigint, $10, $11::text, $12::text, $13
+    WHERE NOT EXISTS (
+        SELECT 1 FROM prev
+        WHERE (status, raw_status, status_detail, amount, currency) = ($2, $12, $3, $4, $5)
+           OR status = ANY($14::text[])
+    )
+    RETURNING id
+),
+created AS (
+    INSERT INTO payment_states (
+        client_id, provider, kind, external_id, status, raw_status, status_detail,
+        amount, currency, payment_id, webhook_event_id
+    )
+    SELECT $13, $8, $10, $1, $2, $12, $3, $4, $5, ins.id, $9
+    FROM ins
+    WHERE NOT EXISTS (SELECT 1 FROM prev)
+    RETURNING id
+),
+updated AS (
+    UPDATE payment_states s SET
+        status           = $2,
+        raw_status       = $12,
+        status_detail    = $3,
+        amount           = $4,
+        currency         = $5,
+        payment_id       = ins.id,
+        webhook_event_id = $9,
+        updated_at       = NOW()
+    FROM ins, prev
+    WHERE s.id = prev.id
+    RETURNING s.id
+)
+INSERT INTO payment_status_changes (payment_state_id, from_status, to_status, webhook_event_id)
+SELECT id, (SELECT status FROM prev), $2, $9
+FROM (SELECT id FROM created UNION ALL SELECT id FROM updated) AS saved
+WHERE (SELECT status FROM prev) IS DISTINCT FROM $2`
+
+func insertPayment(ctx context.Context, tx pgx.Tx, event PaymentEvent, webhookEventID int64, clientID *int64) error {
+	_, err := tx.Exec(ctx, savePaymentSQL, paymentRow(event, webhookEventID, clientID)...)
+	return err
+}
+
+// paymentRow son los parámetros de savePaymentSQL para un pago (el último,
+// los estados que el del pago ya no puede pisar).
+func paymentRow(event PaymentEvent, webhookEventID int64, clientID *int64) []any {
+	var eventType *string
+	if event.EventType != "" {
+		eventType = &event.EventType
+	}
+	return []any{
 		event.ExternalID,
 		event.Status,
 		event.StatusDetail,
@@ -38,11 +192,303 @@ func (r *Repository) Save(event PaymentEvent, webhookEventID int64) error {
 		event.ApprovedAt,
 		event.Provider,
 		webhookEventID,
+		event.Kind,
+		eventType,
+		event.RawStatus,
+		clientID,
+		supersededBy(event.Status),
+	}
+}
+
+// upsertRefund crea o actualiza el reembolso. Un webhook viejo que llega
+// tarde no pisa un estado final con "pending", y el total acumulado sólo
+// puede crecer.
+func upsertRefund(ctx context.Context, tx pgx.Tx, refund Refund, webhookEventID int64, clientID *int64) error {
+	_, err := tx.Exec(
+		ctx,
+		`INSERT INTO refunds (
+            provider, external_id, payment_external_id, amount, currency,
+            status, reason, cumulative, refunded_at, webhook_event_id, client_id
+        ) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$12)
+        ON CONFLICT (client_id, provider, external_id) DO UPDATE SET
+            amount = CASE WHEN refunds.cumulative
+                          THEN GREATEST(refunds.amount, EXCLUDED.amount)
+                          ELSE EXCLUDED.amount END,
+            currency         = EXCLUDED.currency,
+            status           = EXCLUDED.status,
+            reason           = COALESCE(NULLIF(EXCLUDED.reason, ''), refunds.reason),
+            refunded_at      = COALESCE(EXCLUDED.refunded_at, refunds.refunded_at),
+            webhook_event_id = EXCLUDED.webhook_event_id,
+            updated_at       = NOW()
+        WHERE refunds.status = $11 OR EXCLUDED.status <> $11`,
+		refund.Provider,
+		refund.ExternalID,
+		refund.PaymentExternalID,
+		refund.Amount,
+		refund.Currency,
+		refund.Status,
+		refund.Reason,
+		refund.Cumulative,
+		refund.RefundedAt,
+		webhookEventID,
+		RefundPending,
+		clientID,
 	)
+	return err
+}
 
-	if err != nil {
-		log.Printf("[PaymentRepository] error saving payment: %v", err)
+// upsertDispute crea o actualiza la disputa y, si cambió de estado, deja
+// el cambio en dispute_events. Una disputa cerrada no se reabre con un
+// webhook viejo.
+func upsertDispute(ctx context.Context, tx pgx.Tx, d Dispute, webhookEventID int64, clientID *int64) error {
+	if d.Closed() && d.ClosedAt == nil {
+		now := time.Now().UTC()
+		d.ClosedAt = &now
 	}
 
+	var (
+		id       int64
+		previous *string
+	)
+	err := tx.QueryRow(
+		ctx,
+		`SELECT id, status FROM disputes
+         WHERE client_id IS NOT DISTINCT FROM $1 AND provider = $2 AND external_id = $3
+         FOR UPDATE`,
+		clientID, d.Provider, d.ExternalID,
+	).Scan(&id, &previous)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	switch {
+	case previous == nil && d.resolveOnly:
+		return nil
+	case previous == nil:
+		err = tx.QueryRow(
+			ctx,
+			`INSERT INTO disputes (
+                provider, external_id, payment_external_id, amount, currency,
+                status, reason, opened_at, closed_at, webhook_event_id, client_id
+            ) VALUES ($1,$2,$3,$4,$5,$6,$7,COALESCE($8, NOW()),$9,$10,$11)
+            RETURNING id`,
+			d.Provider,
+			d.ExternalID,
+			d.PaymentExternalID,
+			d.Amount,
+			d.Currency,
+			d.Status,
+			d.Reason,
+			d.OpenedAt,
+			d.ClosedAt,
+			webhookEventID,
+			clientID,
+		).Scan(&id)
+		if err != nil {
+			return err
+		}
+	case *previous == d.Status:
+		return nil
+	default:
+		tag, err := tx.Exec(
+			ctx,
+			`UPDATE disputes SET
+                status           = $2,
+                amount           = CASE WHEN $3::numeric > 0 THEN $3 ELSE amount END,
+                reason           = COALESCE(NULLIF($4, ''), reason),
+                closed_at        = $5,
+                webhook_event_id = $6,
+                updated_at       = NOW()
+             WHERE id = $1 AND (closed_at IS NULL OR $5::timestamptz IS NOT NULL)`,
+			id,
+			d.Status,
+			d.Amount,
+			d.Reason,
+			d.ClosedAt,
+			webhookEventID,
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return nil
+		}
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`INSERT INTO dispute_events (dispute_id, status, webhook_event_id) VALUES ($1, $2, $3)`,
+		id, d.Status, webhookEventID,
+	)
 	return err
 }
+
+// Payment es un pago ya persistido, asociado al webhook que lo originó.
+type Payment struct {
+	ID             int64 `json:"payment_id"`
+	WebhookEventID int64 `json:"webhook_event_id"`
+	PaymentEvent
+}
+
+// FindByWebhookEventID devuelve el pago generado por un webhook, o nil si
+// el evento todavía no se procesó o no generó fila porque repetía el
+// estado del pago (ver savePaymentSQL).
+func (r *Repository) FindByWebhookEventID(ctx context.Context, webhookEventID int64, receivedAt time.Time) (*Payment, error) {
+	var p Payment
+	err := r.db.QueryRow(
+		ctx,
+		`SELECT id, webhook_event_id, external_id, status, raw_status, status_detail, amount,
+                currency, payer_email, approved_at, provider, kind, COALESCE(event_type, '')
+         FROM payments
+         WHERE webhook_event_id = $1
+           AND created_at >= $2
+         ORDER BY id DESC
+         LIMIT 1`,
+		webhookEventID, receivedAt,
+	).Scan(
+		&p.ID,
+		&p.WebhookEventID,
+		&p.ExternalID,
+		&p.Status,
+		&p.RawStatus,
+		&p.StatusDetail,
+		&p.Amount,
+		&p.Currency,
+		&p.PayerEmail,
+		&p.ApprovedAt,
+		&p.Provider,
+		&p.Kind,
+		&p.EventType,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("[PaymentRepository] error fetching payment (webhook_event_id=%d): %v", webhookEventID, err)
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// ErrAmbiguousPayment: el mismo (provider, external_id) existe en más de un
+// cliente y la consulta no dijo de cuál.
+var ErrAmbiguousPayment = apperr.Conflict("ambiguous_payment", "payment exists for several clients; filter by client")
+
+// BalanceFilter elige el pago de Balance. Un pago es de un cliente: con
+// ClientID (keys de cliente) o ClientUID (filtro de una key global) sólo
+// se ve el de ese cliente.
+type BalanceFilter struct {
+	Provider   string
+	ExternalID string
+	ClientID   *int64
+	ClientUID  string
+}
+
+// Balance lee el neto de un pago (vista payment_balances) con el detalle de
+// reembolsos y disputas del mismo cliente. Si el pago existe en varios
+// clientes y el filtro no elige uno devuelve ErrAmbiguousPayment.
+func (r *Repository) Balance(ctx context.Context, f BalanceFilter) (*Balance, error) {
+	rows, err := r.db.Query(
+		ctx,
+		`SELECT b.client_id, b.provider, b.external_id, b.currency, b.gross, b.refunded,
+                b.disputed_lost, b.disputed_open, b.net
+         FROM payment_balances b
+         WHERE b.provider = $1 AND b.external_id = $2
+           AND ($3::bigint IS NULL OR b.client_id = $3)
+           AND ($4 = '' OR b.client_id = (SELECT id FROM clients WHERE client_uid = $4))
+         LIMIT 2`,
+		f.Provider, f.ExternalID, f.ClientID, f.ClientUID,
+	)
+	if err != nil {
+		return nil, apperr.FromDB(err, nil, nil)
+	}
+	var found []Balance
+	for rows.Next() {
+		b := Balance{Refunds: []Refund{}, Disputes: []Dispute{}}
+		if err := rows.Scan(
+			&b.ClientID,
+			&b.Provider,
+			&b.ExternalID,
+			&b.Currency,
+			&b.Gross,
+			&b.Refunded,
+			&b.DisputedLost,
+			&b.DisputedOpen,
+			&b.Net,
+		); err != nil {
+			rows.Close()
+			return nil, apperr.FromDB(err, nil, nil)
+		}
+		found = append(found, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, apperr.FromDB(err, nil, nil)
+	}
+	switch len(found) {
+	case 0:
+		return nil, ErrPaymentNotFound
+	case 2:
+		return nil, ErrAmbiguousPayment
+	}
+	b := found[0]
+
+	rows, err = r.db.Query(
+		ctx,
+		`SELECT id, provider, external_id, payment_external_id, amount, currency,
+                status, reason, cumulative, refunded_at, updated_at
+         FROM refunds
+         WHERE client_id IS NOT DISTINCT FROM $1 AND provider = $2 AND payment_external_id = $3
+         ORDER BY id`,
+		b.ClientID, b.Provider, b.ExternalID,
+	)
+	if err != nil {
+		return nil, apperr.FromDB(err, nil, nil)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rf Refund
+		if err := rows.Scan(
+			&rf.ID, &rf.Provider, &rf.ExternalID, &rf.PaymentExternalID, &rf.Amount, &rf.Currency,
+			&rf.Status, &rf.Reason, &rf.Cumulative, &rf.RefundedAt, &rf.UpdatedAt,
+		); err != nil {
+			return nil, apperr.FromDB(err, nil, nil)
+		}
+		b.Refunds = append(b.Refunds, rf)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperr.FromDB(err, nil, nil)
+	}
+
+	rows, err = r.db.Query(
+		ctx,
+		`SELECT id, provider, external_id, payment_external_id, amount, currency,
+                status, reason, opened_at, closed_at, updated_at
+         FROM disputes
+         WHERE client_id IS NOT DISTINCT FROM $1 AND provider = $2 AND payment_external_id = $3
+         ORDER BY id`,
+		b.ClientID, b.Provider, b.ExternalID,
+	)
+	if err != nil {
+		return nil, apperr.FromDB(err, nil, nil)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d Dispute
+		if err := rows.Scan(
+			&d.ID, &d.Provider, &d.ExternalID, &d.PaymentExternalID, &d.Amount, &d.Currency,
+			&d.Status, &d.Reason, &d.OpenedAt, &d.ClosedAt, &d.UpdatedAt,
+		); err != nil {
+			return nil, apperr.FromDB(err, nil, nil)
+		}
+		b.Disputes = append(b.Disputes, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperr.FromDB(err, nil, nil)
+	}
+
+	return &b, nil
+}
@@ -1,16 +1,26 @@
 package payments
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"log"
-	"strconv"
 	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Kmicac/Webhook-Relay/internal/mercadopago"
 )
 
+// PaymentEvent es un evento de pago normalizado, independiente del provider.
+// Kind distingue pagos, checkouts y facturas; EventType es el tipo original
+// del provider (p.ej. "payment_intent.succeeded"), si lo informa. Status es
+// el estado canónico (ver Statuses) y RawStatus el que mandó el provider.
 type PaymentEvent struct {
 	ExternalID   string     `json:"id"`
+	Kind         string     `json:"kind"`
+	EventType    string     `json:"event_type,omitempty"`
 	Status       string     `json:"status"`
+	RawStatus    string     `json:"raw_status"`
 	StatusDetail string     `json:"status_detail"`
 	Amount       float64    `json:"amount"`
 	Currency     string     `json:"currency"`
@@ -19,195 +29,193 @@ type PaymentEvent struct {
 	Provider     string     `json:"provider"`
 }
 
+// Outcome es el resultado de procesar un webhook.
+type Outcome string
+
+const (
+	OutcomeSaved   Outcome = "saved"
+	OutcomeIgnored Outcome = "ignored" // tipo de evento que no nos interesa
+)
+
 type Service struct {
-	repo *Repository
+	repo          *Repository
+	genericConfig GenericConfigFunc
 }
 
-func NewService(repo *Repository) *Service {
-	return &Service{repo: repo}
+// NewService crea el servicio; genericConfig puede ser nil si no se
+// procesan eventos (sólo lo usa el worker).
+func NewService(repo *Repository, genericConfig GenericConfigFunc) *Service {
+	return &Service{repo: repo, genericConfig: genericConfig}
 }
 
-func (s *Service) Process(rawBody []byte, webhookEventID int64, provider string) error {
-	var payload map[string]interface{}
-
-	if err := json.Unmarshal(rawBody, &payload); err != nil {
-		return fmt.Errorf("invalid json: %w", err)
-	}
-
-	var event PaymentEvent
-	event.Provider = provider
-
-	switch provider {
-	case "mercadopago":
-		event = parseMercadoPagoPayload(payload)
-		event.Provider = provider
+// WithTx devuelve el servicio guardando dentro de tx: lo que escriba se
+// confirma o se deshace junto con el resto de la transacción.
+func (s *Service) WithTx(tx pgx.Tx) *Service {
+	return &Service{repo: s.repo.WithTx(tx), genericConfig: s.genericConfig}
+}
 
-	case "stripe":
-		event = parseStripePayload(payload)
-		event.Provider = provider
+// Event es un webhook a procesar en un lote.
+type Event struct {
+	ID       int64
+	ClientID *int64
+	Provider string
+	Body     []byte
+}
 
-	case "paypal":
-		event = parsePaypalPayload(payload)
-		event.Provider = provider
+// Result es cómo terminó un evento del lote: Outcome o Err.
+type Result struct {
+	Outcome Outcome
+	Err     error
+}
 
-	default:
-		event = PaymentEvent{
-			ExternalID: getString(payload, "id"),
-			Status:     getString(payload, "status"),
-			Amount:     getFloat(payload, "amount"),
-			Provider:   provider,
+// ProcessBatch normaliza un lote de webhooks y guarda lo que traiga cada
+// uno (pago, reembolsos, disputa); los que no traen nada de eso (tipos
+// desconocidos) no se guardan y terminan en OutcomeIgnored. Devuelve un
+// resultado por evento, en el mismo orden.
+//
+// Lo que normaliza bien se guarda todo junto (ver Repository.SaveBatch);
+// si esa escritura falla se reintenta evento por evento, así un registro
+// que la base rechaza no arrastra al resto.
+func (s *Service) ProcessBatch(ctx context.Context, events []Event) []Result {
+	results := make([]Result, len(events))
+	var (
+		saves []SaveItem
+		index []int // posición en events de cada saves[i]
+	)
+
+	for i, ev := range events {
+		n, err := s.normalize(ctx, ev.Body, ev.ID, ev.ClientID, ev.Provider)
+		switch {
+		case err != nil:
+			results[i].Err = err
+		case n.empty():
+			results[i].Outcome = OutcomeIgnored
+		default:
+			saves = append(saves, SaveItem{Normalized: n, WebhookEventID: ev.ID, ClientID: ev.ClientID})
+			index = append(index, i)
 		}
 	}
 
-	log.Printf("[PaymentService] Parsed PaymentEvent (%s): %+v\n", provider, event)
-
-	if err := s.repo.Save(event, webhookEventID); err != nil {
-		return err
+	if len(saves) == 0 {
+		return results
 	}
 
-	return nil
-}
-
-func parseMercadoPagoPayload(payload map[string]interface{}) PaymentEvent {
-	ev := PaymentEvent{
-		ExternalID:   getString(payload, "id"),
-		Status:       getString(payload, "status"),
-		StatusDetail: getString(payload, "status_detail"),
-		Amount:       getFloat(payload, "transaction_amount"),
-		Currency:     getString(payload, "currency_id"),
-	}
-
-	if payerRaw, ok := payload["payer"]; ok {
-		if payerMap, ok := payerRaw.(map[string]interface{}); ok {
-			ev.PayerEmail = getStringFromMap(payerMap, "email")
+	if err := s.repo.SaveBatch(ctx, saves); err == nil {
+		for _, i := range index {
+			results[i].Outcome = OutcomeSaved
 		}
+		return results
 	}
 
-	dateApprovedStr := getString(payload, "date_approved")
-	if dateApprovedStr != "" {
-		if t, err := time.Parse(time.RFC3339, dateApprovedStr); err == nil {
-			ev.ApprovedAt = &t
+	for k, item := range saves {
+		i := index[k]
+		if err := s.repo.Save(ctx, item.Normalized, item.WebhookEventID, item.ClientID); err != nil {
+			results[i].Err = err
+			continue
 		}
+		results[i].Outcome = OutcomeSaved
 	}
+	return results
+}
 
-	if ev.Amount == 0 {
-		ev.Amount = getFloat(payload, "amount")
-	}
+// normalize parsea el webhook según el provider. Un Normalized vacío es un
+// evento que no hay que guardar. clientID es el cliente que recibió el
+// webhook; el provider generic lo necesita para leer su configuración.
+func (s *Service) normalize(ctx context.Context, rawBody []byte, webhookEventID int64, clientID *int64, provider string) (Normalized, error) {
+	var (
+		n   Normalized
+		err error
+	)
 
-	return ev
-}
+	switch provider {
+	case "mercadopago":
+		// las notificaciones thin tienen que llegar ya reemplazadas por el
+		// pago (ver mercadopago.Enricher); las de otros recursos no son pagos
+		if notif, ok := mercadopago.ParseNotification(rawBody); ok {
+			if notif.Type != "payment" {
+				log.Printf("[PaymentService] ignoring mercadopago %s notification %s\n", notif.Type, notif.ID)
+				return Normalized{}, nil
+			}
+			return n, fmt.Errorf("mercadopago payment notification %s was not fetched back", notif.ID)
+		}
+		n, err = parseMercadoPagoPayload(rawBody)
 
-func parseStripePayload(payload map[string]interface{}) PaymentEvent {
-	ev := PaymentEvent{}
+	case "stripe":
+		n, err = parseStripePayload(rawBody)
 
-	dataObj, ok := payload["data"].(map[string]interface{})
-	if !ok {
-		ev.ExternalID = getString(payload, "id")
-		ev.Status = getString(payload, "type")
-		return ev
-	}
+	case "paypal":
+		n, err = parsePaypalPayload(rawBody)
 
-	object, ok := dataObj["object"].(map[string]interface{})
-	if !ok {
-		ev.ExternalID = getString(payload, "id")
-		ev.Status = getString(payload, "type")
-		return ev
-	}
+	case "adyen":
+		n, err = parseAdyenPayload(rawBody)
 
-	ev.ExternalID = getStringFromMap(object, "id")
-	ev.Status = getStringFromMap(object, "status")
+	case "dlocal":
+		n, err = parseDLocalPayload(rawBody)
 
-	// amount_received viene en centavos
-	amountCents := getFloat(object, "amount_received")
-	if amountCents != 0 {
-		ev.Amount = amountCents / 100.0
-	}
+	case "payu":
+		n, err = parsePayUPayload(rawBody)
 
-	ev.Currency = getStringFromMap(object, "currency")
-
-	// payer email: charges.data[0].billing_details.email
-	if chargesRaw, ok := object["charges"]; ok {
-		if chargesMap, ok := chargesRaw.(map[string]interface{}); ok {
-			if dataSliceRaw, ok := chargesMap["data"]; ok {
-				if dataSlice, ok := dataSliceRaw.([]interface{}); ok && len(dataSlice) > 0 {
-					if firstCharge, ok := dataSlice[0].(map[string]interface{}); ok {
-						if billingRaw, ok := firstCharge["billing_details"]; ok {
-							if billing, ok := billingRaw.(map[string]interface{}); ok {
-								ev.PayerEmail = getStringFromMap(billing, "email")
-							}
-						}
-					}
-				}
-			}
+	case "generic":
+		if s.genericConfig == nil || clientID == nil {
+			return n, fmt.Errorf("generic event %d has no client configuration", webhookEventID)
 		}
-	}
+		cfg, cfgErr := s.genericConfig(ctx, *clientID)
+		if cfgErr != nil {
+			return n, fmt.Errorf("loading generic config: %w", cfgErr)
+		}
+		n, err = parseGenericPayload(cfg, rawBody)
 
-	return ev
-}
+	default:
+		return n, fmt.Errorf("unsupported provider %q", provider)
+	}
+	if err != nil {
+		return n, err
+	}
 
-func parsePaypalPayload(payload map[string]interface{}) PaymentEvent {
-	ev := PaymentEvent{}
-
-	ev.ExternalID = getString(payload, "id")
-	ev.Status = getString(payload, "status")
-	ev.StatusDetail = getString(payload, "status_detail")
-
-	// amount.value + amount.currency_code
-	if amountRaw, ok := payload["amount"]; ok {
-		if amountMap, ok := amountRaw.(map[string]interface{}); ok {
-			// value viene como string
-			valStr := getStringFromMap(amountMap, "value")
-			if valStr != "" {
-				if f, err := strconv.ParseFloat(valStr, 64); err == nil {
-					ev.Amount = f
-				}
-			}
-			ev.Currency = getStringFromMap(amountMap, "currency_code")
-		}
+	if n.empty() {
+		log.Printf("[PaymentService] ignoring %s event %d: nothing to record\n", provider, webhookEventID)
+		return n, nil
 	}
 
-	if payerRaw, ok := payload["payer"]; ok {
-		if payerMap, ok := payerRaw.(map[string]interface{}); ok {
-			ev.PayerEmail = getStringFromMap(payerMap, "email_address")
+	for i := range n.Payments {
+		ev := &n.Payments[i]
+		ev.Provider = provider
+		if ev.Kind == "" {
+			ev.Kind = KindPayment
+		}
+		if ev.Status == "" {
+			ev.Status = canonicalStatus(provider, ev.RawStatus)
 		}
+		log.Printf("[PaymentService] Parsed PaymentEvent (%s): %+v\n", provider, *ev)
 	}
-
-	updateTime := getString(payload, "update_time")
-	if updateTime != "" {
-		if t, err := time.Parse(time.RFC3339, updateTime); err == nil {
-			ev.ApprovedAt = &t
+	for i := range n.Refunds {
+		r := &n.Refunds[i]
+		r.Provider = provider
+		if r.PaymentExternalID == "" {
+			return n, fmt.Errorf("%s refund %s has no payment reference", provider, r.ExternalID)
 		}
+		log.Printf("[PaymentService] Parsed Refund (%s): %+v\n", provider, *r)
 	}
-
-	return ev
-}
-
-func getString(m map[string]interface{}, key string) string {
-	if v, ok := m[key]; ok {
-		if s, ok := v.(string); ok {
-			return s
+	for i := range n.Disputes {
+		d := &n.Disputes[i]
+		d.Provider = provider
+		if d.PaymentExternalID == "" {
+			return n, fmt.Errorf("%s dispute %s has no payment reference", provider, d.ExternalID)
 		}
+		log.Printf("[PaymentService] Parsed Dispute (%s): %+v\n", provider, *d)
 	}
-	return ""
+
+	return n, nil
 }
 
-func getFloat(m map[string]interface{}, key string) float64 {
-	if v, ok := m[key]; ok {
-		switch t := v.(type) {
-		case float64:
-			return t
-		case int:
-			return float64(t)
-		}
-	}
-	return 0
+// FindByWebhookEventID devuelve el pago asociado a un webhook (nil si no
+// hay). receivedAt es el del evento: el pago no puede ser anterior.
+func (s *Service) FindByWebhookEventID(ctx context.Context, webhookEventID int64, receivedAt time.Time) (*Payment, error) {
+	return s.repo.FindByWebhookEventID(ctx, webhookEventID, receivedAt)
 }
 
-func getStringFromMap(m map[string]interface{}, key string) string {
-	if v, ok := m[key]; ok {
-		if s, ok := v.(string); ok {
-			return s
-		}
-	}
-	return ""
+// Balance devuelve el neto de un pago con sus reembolsos y disputas (ver
+// BalanceFilter).
+func (s *Service) Balance(ctx context.Context, f BalanceFilter) (*Balance, error) {
+	return s.repo.Balance(ctx, f)
 }
@@ -0,0 +1,178 @@
+package payments
+
+import (
+	"expvar"
+	"log"
+	"slices"
+	"strings"
+)
+
+// Estados canónicos de un pago, iguales para todos los providers. El
+// estado original queda en PaymentEvent.RawStatus.
+const (
+	StatusPending           = "pending"
+	StatusAuthorized        = "authorized"
+	StatusCaptured          = "captured"
+	StatusFailed            = "failed"
+	StatusCanceled          = "canceled"
+	StatusRefunded          = "refunded"
+	StatusPartiallyRefunded = "partially_refunded"
+	StatusDisputed          = "disputed"
+	StatusChargedBack       = "charged_back"
+	StatusUnknown           = "unknown" // el provider mandó algo que no mapeamos
+)
+
+// Statuses son los estados canónicos válidos.
+var Statuses = []string{
+	StatusPending, StatusAuthorized, StatusCaptured, StatusFailed, StatusCanceled,
+	StatusRefunded, StatusPartiallyRefunded, StatusDisputed, StatusChargedBack, StatusUnknown,
+}
+
+// supersededBy devuelve los estados que ya dejaron atrás a status: un
+// webhook con status que llega cuando el pago está en uno de ellos es
+// viejo y no se aplica. Sólo ordena el camino hasta que el pago se
+// resuelve (pending -> authorized -> el resto); de ahí en más los estados
+// pueden ir y venir (una disputa ganada vuelve a captured).
+func supersededBy(status string) []string {
+	var earlier []string
+	switch status {
+	case StatusPending, StatusUnknown:
+		earlier = []string{StatusPending, StatusUnknown}
+	case StatusAuthorized:
+		earlier = []string{StatusPending, StatusUnknown, StatusAuthorized}
+	default:
+		return []string{}
+	}
+
+	var later []string
+	for _, s := range Statuses {
+		if !slices.Contains(earlier, s) {
+			later = append(later, s)
+		}
+	}
+	return later
+}
+
+// unmappedStatuses cuenta estados sin mapeo por provider, para detectar
+// valores nuevos de un provider antes de que alguien pregunte por qué hay
+// pagos "unknown". El valor va al log, no a la clave: viene del body y
+// cualquiera que mande webhooks podría crear claves sin límite.
+var unmappedStatuses = expvar.NewMap("payments_unmapped_status")
+
+// statusMaps traduce el estado de cada provider al canónico. Los estados
+// que dependen del tipo de evento o del detalle (p.ej. reembolsos
+// parciales) los resuelve el parser.
+var statusMaps = map[string]map[string]string{
+	// https://www.mercadopago.com/developers/es/reference/payments/_payments_id/get
+	"mercadopago": {
+		"pending":      StatusPending,
+		"in_process":   StatusPending,
+		"authorized":   StatusAuthorized,
+		"approved":     StatusCaptured,
+		"rejected":     StatusFailed,
+		"cancelled":    StatusCanceled,
+		"refunded":     StatusRefunded,
+		"in_mediation": StatusDisputed,
+		"charged_back": StatusChargedBack,
+	},
+	// PaymentIntent, Charge, Checkout Session e Invoice
+	"stripe": {
+		"requires_payment_method": StatusPending,
+		"requires_confirmation":   StatusPending,
+		"requires_action":         StatusPending,
+		"processing":              StatusPending,
+		"pending":                 StatusPending,
+		"unpaid":                  StatusPending,
+		"open":                    StatusPending,
+		"draft":                   StatusPending,
+		"requires_capture":        StatusAuthorized,
+		"succeeded":               StatusCaptured,
+		"paid":                    StatusCaptured,
+		"no_payment_required":     StatusCaptured,
+		"failed":                  StatusFailed,
+		"uncollectible":           StatusFailed,
+		"canceled":                StatusCanceled,
+		"void":                    StatusCanceled,
+	},
+	// eventCode de las notificaciones; una autorización con
+	// success=false es StatusFailed (lo resuelve el parser)
+	"adyen": {
+		"PENDING":                  StatusPending,
+		"AUTHORISATION":            StatusAuthorized,
+		"AUTHORISATION_ADJUSTMENT": StatusAuthorized,
+		"CAPTURE":                  StatusCaptured,
+		"CAPTURE_FAILED":           StatusFailed,
+		"CANCELLATION":             StatusCanceled,
+		"CANCEL_OR_REFUND":         StatusCanceled,
+		"TECHNICAL_CANCEL":         StatusCanceled,
+		"OFFER_CLOSED":             StatusCanceled,
+		"EXPIRE":                   StatusCanceled,
+	},
+	// status de los pagos de dLocal
+	"dlocal": {
+		"PENDING":            StatusPending,
+		"AUTHORIZED":         StatusAuthorized,
+		"VERIFIED":           StatusAuthorized,
+		"PAID":               StatusCaptured,
+		"REJECTED":           StatusFailed,
+		"CANCELLED":          StatusCanceled,
+		"EXPIRED":            StatusCanceled,
+		"REFUNDED":           StatusRefunded,
+		"PARTIALLY_REFUNDED": StatusPartiallyRefunded,
+		"CHARGEBACK":         StatusChargedBack,
+	},
+	// state_pol de la confirmación de PayU Latam
+	"payu": {
+		"4": StatusCaptured,
+		"5": StatusCanceled,
+		"6": StatusFailed,
+		"7": StatusPending,
+	},
+	// Captures, Authorizations y Orders
+	"paypal": {
+		"CREATED":               StatusPending,
+		"SAVED":                 StatusPending,
+		"PENDING":               StatusPending,
+		"PAYER_ACTION_REQUIRED": StatusPending,
+		"APPROVED":              StatusAuthorized,
+		"CAPTURED":              StatusCaptured,
+		"COMPLETED":             StatusCaptured,
+		"DECLINED":              StatusFailed,
+		"DENIED":                StatusFailed,
+		"FAILED":                StatusFailed,
+		"VOIDED":                StatusCanceled,
+		"EXPIRED":               StatusCanceled,
+		"REFUNDED":              StatusRefunded,
+		"PARTIALLY_REFUNDED":    StatusPartiallyRefunded,
+	},
+}
+
+// canonicalStatus traduce raw al estado canónico. Un valor que ya es
+// canónico (providers sin tabla propia) se acepta tal cual; lo demás es
+// StatusUnknown y se cuenta en la métrica.
+func canonicalStatus(provider, raw string) string {
+	if s, ok := statusMaps[provider][raw]; ok {
+		return s
+	}
+	for _, s := range Statuses {
+		if s == raw && s != StatusUnknown {
+			return s
+		}
+	}
+
+	unmappedStatuses.Add(provider, 1)
+	log.Printf("[PaymentService] unmapped %s status %q\n", provider, truncateStatus(raw))
+	return StatusUnknown
+}
+
+// truncateStatus acota el estado que se loguea: viene del body.
+func truncateStatus(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "(empty)"
+	}
+	if len(raw) > 64 {
+		return raw[:64]
+	}
+	return raw
+}
@@ -0,0 +1,29 @@
+package payments
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSupersededBy(t *testing.T) {
+	cases := []struct {
+		late, current string
+		stale         bool
+	}{
+		{StatusPending, StatusCaptured, true},
+		{StatusPending, StatusFailed, true},
+		{StatusPending, StatusAuthorized, true},
+		{StatusAuthorized, StatusCaptured, true},
+		{StatusUnknown, StatusRefunded, true},
+		{StatusPending, StatusPending, false},
+		{StatusAuthorized, StatusPending, false},
+		{StatusCaptured, StatusAuthorized, false},
+		{StatusRefunded, StatusCaptured, false},
+		{StatusCaptured, StatusDisputed, false}, // disputa ganada
+	}
+	for _, tc := range cases {
+		if got := slices.Contains(supersededBy(tc.late), tc.current); got != tc.stale {
+			t.Errorf("%s after %s: stale = %v, want %v", tc.late, tc.current, got, tc.stale)
+		}
+	}
+}
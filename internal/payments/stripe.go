@@ -0,0 +1,458 @@
+package payments
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Tipos normalizados de evento de pago. Los reembolsos y las disputas no
+// son pagos: van a Refund y Dispute.
+const (
+	KindPayment  = "payment"
+	KindCheckout = "checkout"
+	KindInvoice  = "invoice"
+)
+
+// monedas sin decimales: Stripe manda el monto tal cual, no en centavos
+// https://docs.stripe.com/currencies#zero-decimal
+var stripeZeroDecimal = map[string]bool{
+	"bif": true, "clp": true, "djf": true, "gnf": true, "jpy": true,
+	"kmf": true, "krw": true, "mga": true, "pyg": true, "rwf": true,
+	"ugx": true, "vnd": true, "vuv": true, "xaf": true, "xof": true,
+	"xpf": true,
+}
+
+type stripeEvent struct {
+	Type    string     `json:"type"`
+	Created flexNumber `json:"created"`
+	Data    struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+type stripePaymentIntent struct {
+	ID                 string     `json:"id"`
+	Status             string     `json:"status"`
+	Amount             flexNumber `json:"amount"`
+	AmountReceived     flexNumber `json:"amount_received"`
+	Currency           string     `json:"currency"`
+	ReceiptEmail       string     `json:"receipt_email"`
+	CancellationReason string     `json:"cancellation_reason"`
+	LastPaymentError   *struct {
+		Code        string `json:"code"`
+		DeclineCode string `json:"decline_code"`
+	} `json:"last_payment_error"`
+	// id del charge, o el objeto si el endpoint lo expande
+	LatestCharge json.RawMessage `json:"latest_charge"`
+	// sólo en versiones de API anteriores a 2022-11-15
+	Charges struct {
+		Data []stripeCharge `json:"data"`
+	} `json:"charges"`
+}
+
+type stripeCharge struct {
+	ID             string     `json:"id"`
+	PaymentIntent  string     `json:"payment_intent"`
+	Status         string     `json:"status"`
+	Amount         flexNumber `json:"amount"`
+	AmountRefunded flexNumber `json:"amount_refunded"`
+	Currency       string     `json:"currency"`
+	Captured       *bool      `json:"captured"`
+	ReceiptEmail   string     `json:"receipt_email"`
+	BillingDetails struct {
+		Email string `json:"email"`
+	} `json:"billing_details"`
+	Outcome struct {
+		SellerMessage string `json:"seller_message"`
+	} `json:"outcome"`
+	Refunds struct {
+		Data []stripeRefund `json:"data"`
+	} `json:"refunds"`
+}
+
+type stripeRefund struct {
+	ID            string     `json:"id"`
+	PaymentIntent string     `json:"payment_intent"`
+	Charge        string     `json:"charge"`
+	Status        string     `json:"status"`
+	Amount        flexNumber `json:"amount"`
+	Currency      string     `json:"currency"`
+	Reason        string     `json:"reason"`
+	Created       flexNumber `json:"created"`
+}
+
+type stripeDispute struct {
+	ID            string     `json:"id"`
+	PaymentIntent string     `json:"payment_intent"`
+	Charge        string     `json:"charge"`
+	Status        string     `json:"status"`
+	Amount        flexNumber `json:"amount"`
+	Currency      string     `json:"currency"`
+	Reason        string     `json:"reason"`
+	Created       flexNumber `json:"created"`
+}
+
+type stripeCheckoutSession struct {
+	ID              string     `json:"id"`
+	PaymentIntent   string     `json:"payment_intent"`
+	PaymentStatus   string     `json:"payment_status"`
+	AmountTotal     flexNumber `json:"amount_total"`
+	Currency        string     `json:"currency"`
+	CustomerEmail   string     `json:"customer_email"`
+	CustomerDetails struct {
+		Email string `json:"email"`
+	} `json:"customer_details"`
+}
+
+type stripeInvoice struct {
+	ID                string     `json:"id"`
+	PaymentIntent     string     `json:"payment_intent"`
+	Status            string     `json:"status"`
+	AmountPaid        flexNumber `json:"amount_paid"`
+	Currency          string     `json:"currency"`
+	CustomerEmail     string     `json:"customer_email"`
+	StatusTransitions struct {
+		PaidAt flexNumber `json:"paid_at"`
+	} `json:"status_transitions"`
+}
+
+// parseStripePayload normaliza un evento de Stripe según su "type".
+// data.object cambia de forma según el tipo (PaymentIntent, Charge,
+// Refund, Dispute, Checkout Session, Invoice). Los tipos que no nos
+// interesan devuelven un Normalized vacío.
+func parseStripePayload(body []byte) (Normalized, error) {
+	var event stripeEvent
+	if err := decodePayload(body, &event); err != nil {
+		return Normalized{}, err
+	}
+	eventType := event.Type
+	object := event.Data.Object
+
+	var (
+		n       Normalized
+		payment *PaymentEvent
+		dispute *Dispute
+		err     error
+	)
+	switch {
+	case strings.HasPrefix(eventType, "payment_intent."):
+		payment, err = parseStripePaymentIntent(object)
+		// después de un intento fallido el PaymentIntent vuelve a
+		// requires_payment_method: el tipo de evento es lo que dice que falló
+		if err == nil && eventType == "payment_intent.payment_failed" {
+			payment.Status = StatusFailed
+		}
+	case eventType == "charge.succeeded":
+		payment, err = parseStripeCharge(object)
+	case eventType == "charge.refunded":
+		n.Refunds, err = parseStripeChargeRefunds(object)
+	case eventType == "refund.created", eventType == "refund.updated", eventType == "charge.refund.updated":
+		var r stripeRefund
+		if err = decodeObject("stripe refund", object, &r); err == nil {
+			var refund Refund
+			refund, err = parseStripeRefund(r)
+			n.Refunds = []Refund{refund}
+		}
+	case strings.HasPrefix(eventType, "charge.dispute."):
+		dispute, err = parseStripeDispute(object)
+	case eventType == "checkout.session.completed":
+		payment, err = parseStripeCheckoutSession(object)
+	case eventType == "invoice.paid":
+		payment, err = parseStripeInvoice(object)
+	default:
+		return Normalized{}, nil
+	}
+	if err != nil {
+		return Normalized{}, err
+	}
+
+	// Stripe no manda fechas de aprobación ni de cierre: usamos la del evento
+	created := unixTime(event.Created.Float())
+
+	if ev := payment; ev != nil {
+		ev.EventType = eventType
+		ev.Currency = strings.ToUpper(ev.Currency)
+		if ev.ApprovedAt == nil && stripeSucceeded(*ev) {
+			ev.ApprovedAt = created
+		}
+		n.Payments = []PaymentEvent{*ev}
+	}
+	for i := range n.Refunds {
+		r := &n.Refunds[i]
+		r.Currency = strings.ToUpper(r.Currency)
+		if r.RefundedAt == nil && r.Status == RefundSucceeded {
+			r.RefundedAt = created
+		}
+	}
+	if d := dispute; d != nil {
+		d.Currency = strings.ToUpper(d.Currency)
+		if d.Closed() {
+			d.ClosedAt = created
+		}
+		n.Disputes = []Dispute{*d}
+	}
+
+	return n, nil
+}
+
+func parseStripePaymentIntent(object json.RawMessage) (*PaymentEvent, error) {
+	var pi stripePaymentIntent
+	if err := decodeObject("stripe payment_intent", object, &pi); err != nil {
+		return nil, err
+	}
+	if err := require("stripe payment_intent").str("id", pi.ID).str("status", pi.Status).num("amount", pi.Amount).err(); err != nil {
+		return nil, err
+	}
+
+	ev := &PaymentEvent{
+		Kind:       KindPayment,
+		ExternalID: pi.ID,
+		RawStatus:  pi.Status,
+		Currency:   pi.Currency,
+		PayerEmail: pi.ReceiptEmail,
+	}
+
+	amount := pi.AmountReceived.Float()
+	if amount == 0 {
+		amount = pi.Amount.Float()
+	}
+	ev.Amount = stripeAmount(amount, ev.Currency)
+
+	if lastErr := pi.LastPaymentError; lastErr != nil {
+		ev.StatusDetail = firstNonEmpty(lastErr.DeclineCode, lastErr.Code)
+	} else {
+		ev.StatusDetail = pi.CancellationReason
+	}
+
+	// latest_charge viene expandido sólo si así se configuró el endpoint;
+	// charges.data sólo existe en versiones de API anteriores a 2022-11-15
+	if ev.PayerEmail == "" {
+		var charge *stripeCharge
+		if len(pi.LatestCharge) > 0 && pi.LatestCharge[0] == '{' {
+			charge = &stripeCharge{}
+			if err := decodeJSON(pi.LatestCharge, charge); err != nil {
+				charge = nil
+			}
+		}
+		if charge == nil && len(pi.Charges.Data) > 0 {
+			charge = &pi.Charges.Data[0]
+		}
+		if charge != nil {
+			ev.PayerEmail = charge.BillingDetails.Email
+		}
+	}
+
+	return ev, nil
+}
+
+func parseStripeCharge(object json.RawMessage) (*PaymentEvent, error) {
+	var charge stripeCharge
+	if err := decodeObject("stripe charge", object, &charge); err != nil {
+		return nil, err
+	}
+	if err := require("stripe charge").str("id", charge.ID).str("status", charge.Status).num("amount", charge.Amount).err(); err != nil {
+		return nil, err
+	}
+
+	ev := &PaymentEvent{
+		Kind:         KindPayment,
+		ExternalID:   firstNonEmpty(charge.PaymentIntent, charge.ID),
+		RawStatus:    charge.Status,
+		StatusDetail: charge.Outcome.SellerMessage,
+		Currency:     charge.Currency,
+		PayerEmail:   firstNonEmpty(charge.BillingDetails.Email, charge.ReceiptEmail),
+	}
+
+	ev.Amount = stripeAmount(charge.Amount.Float(), ev.Currency)
+
+	// un charge con captura manual está "succeeded" pero sin capturar
+	if charge.Captured != nil && !*charge.Captured && ev.RawStatus == "succeeded" {
+		ev.Status = StatusAuthorized
+	}
+
+	return ev, nil
+}
+
+// parseStripeChargeRefunds arma los reembolsos de un charge.refunded. Las
+// versiones de API viejas traen la lista en refunds.data; las nuevas no,
+// y ahí sólo queda amount_refunded (acumulado). Los reembolsos
+// individuales llegan igual por refund.created/updated.
+func parseStripeChargeRefunds(object json.RawMessage) ([]Refund, error) {
+	var charge stripeCharge
+	if err := decodeObject("stripe charge", object, &charge); err != nil {
+		return nil, err
+	}
+
+	var refunds []Refund
+	for _, item := range charge.Refunds.Data {
+		r, err := parseStripeRefund(item)
+		if err != nil {
+			return nil, err
+		}
+		refunds = append(refunds, r)
+	}
+	if len(refunds) > 0 {
+		return refunds, nil
+	}
+
+	if err := require("stripe charge").str("id", charge.ID).num("amount_refunded", charge.AmountRefunded).err(); err != nil {
+		return nil, err
+	}
+	return []Refund{{
+		ExternalID:        cumulativeRefundID(charge.ID),
+		PaymentExternalID: firstNonEmpty(charge.PaymentIntent, charge.ID),
+		Amount:            stripeAmount(charge.AmountRefunded.Float(), charge.Currency),
+		Currency:          charge.Currency,
+		Status:            RefundSucceeded,
+		Cumulative:        true,
+	}}, nil
+}
+
+func parseStripeRefund(refund stripeRefund) (Refund, error) {
+	if err := require("stripe refund").str("id", refund.ID).str("status", refund.Status).num("amount", refund.Amount).err(); err != nil {
+		return Refund{}, err
+	}
+
+	r := Refund{
+		ExternalID:        refund.ID,
+		PaymentExternalID: stripePaymentRef(refund.PaymentIntent, refund.Charge),
+		Currency:          refund.Currency,
+		Reason:            refund.Reason,
+		RefundedAt:        unixTime(refund.Created.Float()),
+	}
+	r.Amount = stripeAmount(refund.Amount.Float(), r.Currency)
+
+	switch refund.Status {
+	case "succeeded":
+		r.Status = RefundSucceeded
+	case "failed":
+		r.Status = RefundFailed
+	case "canceled":
+		r.Status = RefundCanceled
+	default: // pending, requires_action
+		r.Status = RefundPending
+	}
+
+	if r.Status != RefundSucceeded {
+		r.RefundedAt = nil
+	}
+	return r, nil
+}
+
+func parseStripeDispute(object json.RawMessage) (*Dispute, error) {
+	var dispute stripeDispute
+	if err := decodeObject("stripe dispute", object, &dispute); err != nil {
+		return nil, err
+	}
+	if err := require("stripe dispute").str("id", dispute.ID).str("status", dispute.Status).num("amount", dispute.Amount).err(); err != nil {
+		return nil, err
+	}
+
+	d := &Dispute{
+		ExternalID:        dispute.ID,
+		PaymentExternalID: stripePaymentRef(dispute.PaymentIntent, dispute.Charge),
+		Currency:          dispute.Currency,
+		Reason:            dispute.Reason,
+		OpenedAt:          unixTime(dispute.Created.Float()),
+	}
+	d.Amount = stripeAmount(dispute.Amount.Float(), d.Currency)
+
+	switch dispute.Status {
+	case "won":
+		d.Status = DisputeWon
+	case "lost":
+		d.Status = DisputeLost
+	case "warning_closed":
+		d.Status = DisputeClosed
+	case "under_review", "warning_under_review":
+		d.Status = DisputeUnderReview
+	default: // needs_response, warning_needs_response
+		d.Status = DisputeNeedsResponse
+	}
+
+	return d, nil
+}
+
+// stripePaymentRef es el id del pago al que apunta un Refund o Dispute:
+// el PaymentIntent si hay, si no el Charge (igual que el ExternalID de los
+// pagos).
+func stripePaymentRef(paymentIntent, charge string) string {
+	return firstNonEmpty(paymentIntent, charge)
+}
+
+func parseStripeCheckoutSession(object json.RawMessage) (*PaymentEvent, error) {
+	var session stripeCheckoutSession
+	if err := decodeObject("stripe checkout.session", object, &session); err != nil {
+		return nil, err
+	}
+	if err := require("stripe checkout.session").str("id", session.ID).str("payment_status", session.PaymentStatus).num("amount_total", session.AmountTotal).err(); err != nil {
+		return nil, err
+	}
+
+	ev := &PaymentEvent{
+		Kind:       KindCheckout,
+		ExternalID: firstNonEmpty(session.PaymentIntent, session.ID),
+		RawStatus:  session.PaymentStatus,
+		Currency:   session.Currency,
+		PayerEmail: firstNonEmpty(session.CustomerDetails.Email, session.CustomerEmail),
+	}
+	ev.Amount = stripeAmount(session.AmountTotal.Float(), ev.Currency)
+	return ev, nil
+}
+
+func parseStripeInvoice(object json.RawMessage) (*PaymentEvent, error) {
+	var invoice stripeInvoice
+	if err := decodeObject("stripe invoice", object, &invoice); err != nil {
+		return nil, err
+	}
+	if err := require("stripe invoice").str("id", invoice.ID).str("status", invoice.Status).num("amount_paid", invoice.AmountPaid).err(); err != nil {
+		return nil, err
+	}
+
+	ev := &PaymentEvent{
+		Kind:       KindInvoice,
+		ExternalID: firstNonEmpty(invoice.PaymentIntent, invoice.ID),
+		RawStatus:  invoice.Status,
+		Currency:   invoice.Currency,
+		PayerEmail: invoice.CustomerEmail,
+	}
+	ev.Amount = stripeAmount(invoice.AmountPaid.Float(), ev.Currency)
+	ev.ApprovedAt = unixTime(invoice.StatusTransitions.PaidAt.Float())
+	return ev, nil
+}
+
+func stripeSucceeded(ev PaymentEvent) bool {
+	switch ev.Kind {
+	case KindPayment:
+		return ev.RawStatus == "succeeded"
+	case KindCheckout, KindInvoice:
+		return ev.RawStatus == "paid"
+	}
+	return false
+}
+
+// stripeAmount pasa de la unidad mínima de la moneda (centavos) a unidades.
+func stripeAmount(minor float64, currency string) float64 {
+	if stripeZeroDecimal[strings.ToLower(currency)] {
+		return minor
+	}
+	return minor / 100.0
+}
+
+func unixTime(secs float64) *time.Time {
+	if secs <= 0 {
+		return nil
+	}
+	t := time.Unix(int64(secs), 0).UTC()
+	return &t
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
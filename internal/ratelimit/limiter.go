@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit es un token bucket: Rate tokens por segundo, hasta Burst acumulados.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Decision es el resultado de pedir un token.
+type Decision struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// Limiter consume un token del bucket identificado por key.
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Decision, error)
+}
+
+// retryAfter es cuánto falta para que el bucket tenga un token entero.
+func retryAfter(tokens float64, limit Limit) time.Duration {
+	if limit.Rate <= 0 {
+		return time.Minute
+	}
+	missing := 1 - tokens
+	if missing <= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(missing / limit.Rate * float64(time.Second)))
+}
+
+// MemoryLimiter guarda los buckets en memoria; sirve para un solo nodo.
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// idleTTL: buckets sin uso por más de esto se descartan (ya estarían llenos).
+const idleTTL = 10 * time.Minute
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+func (m *MemoryLimiter) Allow(_ context.Context, key string, limit Limit) (Decision, error) {
+	now := m.now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.lastSweep) > idleTTL {
+		m.sweep(now)
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		m.buckets[key] = b
+	}
+
+	elapsed := now.Sub(b.updated).Seconds()
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed*limit.Rate)
+	b.updated = now
+
+	if b.tokens < 1 {
+		return Decision{RetryAfter: retryAfter(b.tokens, limit)}, nil
+	}
+
+	b.tokens--
+	return Decision{Allowed: true, Remaining: int(b.tokens)}, nil
+}
+
+func (m *MemoryLimiter) sweep(now time.Time) {
+	for k, b := range m.buckets {
+		if now.Sub(b.updated) > idleTTL {
+			delete(m.buckets, k)
+		}
+	}
+	m.lastSweep = now
+}
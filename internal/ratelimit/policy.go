@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"expvar"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Kmicac/Webhook-Relay/internal/apperr"
+	"github.com/Kmicac/Webhook-Relay/internal/storage"
+)
+
+// rejected cuenta requests rechazadas por scope ("ip", "client").
+var rejected = expvar.NewMap("ratelimit_rejected")
+
+var ErrRateLimited = apperr.New(apperr.KindRateLimited, "rate_limited", "rate limit exceeded")
+
+// Policy aplica los límites de ingestión por IP y por cliente.
+type Policy struct {
+	Limiter   Limiter
+	PerIP     Limit
+	PerClient Limit
+}
+
+// PolicyFromEnv arma la política desde variables de entorno:
+//
+//	RATE_LIMIT_BACKEND     memory (default), postgres u off
+//	RATE_LIMIT_IP_RPS      / RATE_LIMIT_IP_BURST      (default 20 / 40)
+//	RATE_LIMIT_CLIENT_RPS  / RATE_LIMIT_CLIENT_BURST  (default 50 / 100)
+//
+// Con backend "off" devuelve nil (sin límites).
+func PolicyFromEnv(store *storage.PostgresStore) (*Policy, error) {
+	p := &Policy{
+		PerIP:     Limit{Rate: 20, Burst: 40},
+		PerClient: Limit{Rate: 50, Burst: 100},
+	}
+
+	switch backend := os.Getenv("RATE_LIMIT_BACKEND"); backend {
+	case "", "memory":
+		p.Limiter = NewMemoryLimiter()
+	case "postgres":
+		p.Limiter = NewPostgresLimiter(store)
+	case "off":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("invalid RATE_LIMIT_BACKEND %q", backend)
+	}
+
+	var err error
+	if p.PerIP, err = limitFromEnv("RATE_LIMIT_IP", p.PerIP); err != nil {
+		return nil, err
+	}
+	if p.PerClient, err = limitFromEnv("RATE_LIMIT_CLIENT", p.PerClient); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// LimitIP es un middleware que limita por IP de origen. Va antes de
+// cualquier lookup en la base, así un UID inventado no cuesta una query.
+func (p *Policy) LimitIP(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if p == nil {
+			return next(c)
+		}
+		if err := p.check(c, "ip", "ip:"+c.RealIP(), p.PerIP); err != nil {
+			return err
+		}
+		return next(c)
+	}
+}
+
+// CheckClient aplica el límite del cliente; rps/burst no nil pisan el
+// default. Si se excede devuelve ErrRateLimited (con Retry-After ya
+// seteado en la respuesta).
+func (p *Policy) CheckClient(c echo.Context, clientUID string, rps *float64, burst *int) error {
+	if p == nil {
+		return nil
+	}
+
+	limit := p.PerClient
+	if rps != nil {
+		limit.Rate = *rps
+	}
+	if burst != nil {
+		limit.Burst = *burst
+	}
+	return p.check(c, "client", "client:"+clientUID, limit)
+}
+
+func (p *Policy) check(c echo.Context, scope, key string, limit Limit) error {
+	d, err := p.Limiter.Allow(c.Request().Context(), key, limit)
+	if err != nil {
+		// si el backend falla preferimos aceptar antes que perder webhooks
+		log.Printf("[RateLimit] limiter error (key=%s): %v\n", key, err)
+		return nil
+	}
+
+	c.Response().Header().Set("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+	c.Response().Header().Set("X-RateLimit-Remaining", strconv.Itoa(d.Remaining))
+
+	if d.Allowed {
+		return nil
+	}
+
+	rejected.Add(scope, 1)
+
+	secs := int(math.Ceil(d.RetryAfter.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	c.Response().Header().Set("Retry-After", strconv.Itoa(secs))
+
+	return ErrRateLimited
+}
+
+func limitFromEnv(prefix string, def Limit) (Limit, error) {
+	l := def
+	if v := os.Getenv(prefix + "_RPS"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 {
+			return l, fmt.Errorf("invalid %s_RPS %q", prefix, v)
+		}
+		l.Rate = f
+	}
+	if v := os.Getenv(prefix + "_BURST"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return l, fmt.Errorf("invalid %s_BURST %q", prefix, v)
+		}
+		l.Burst = n
+	}
+	return l, nil
+}
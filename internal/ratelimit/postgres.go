@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Kmicac/Webhook-Relay/internal/storage"
+)
+
+// PostgresLimiter guarda los buckets en rate_limit_buckets para que varias
+// réplicas de la API compartan el mismo límite. El refill y el consumo se
+// hacen en un único UPSERT, así que es atómico por key.
+type PostgresLimiter struct {
+	db *storage.PostgresStore
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+func NewPostgresLimiter(store *storage.PostgresStore) *PostgresLimiter {
+	return &PostgresLimiter{db: store}
+}
+
+// refilled son los tokens del bucket después de recargar por el tiempo
+// transcurrido ($2 = rate, $3 = burst).
+const refilled = `LEAST($3::float8, b.tokens + EXTRACT(EPOCH FROM clock_timestamp() - b.updated_at)::float8 * $2::float8)`
+
+func (p *PostgresLimiter) Allow(ctx context.Context, key string, limit Limit) (Decision, error) {
+	p.maybeSweep()
+
+	var (
+		tokens  float64
+		allowed bool
+	)
+	err := p.db.DB.QueryRow(
+		ctx,
+		`INSERT INTO rate_limit_buckets AS b (key, tokens, allowed, updated_at)
+         VALUES ($1, $3::float8 - 1, $3::float8 >= 1, clock_timestamp())
+         ON CONFLICT (key) DO UPDATE SET
+             tokens     = CASE WHEN `+refilled+` >= 1 THEN `+refilled+` - 1 ELSE `+refilled+` END,
+             allowed    = `+refilled+` >= 1,
+             updated_at = clock_timestamp()
+         RETURNING tokens, allowed`,
+		key, limit.Rate, float64(limit.Burst),
+	).Scan(&tokens, &allowed)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	if !allowed {
+		return Decision{RetryAfter: retryAfter(tokens, limit)}, nil
+	}
+	return Decision{Allowed: true, Remaining: int(tokens)}, nil
+}
+
+// maybeSweep borra en background los buckets que no se usan hace rato.
+func (p *PostgresLimiter) maybeSweep() {
+	p.mu.Lock()
+	if time.Since(p.lastSweep) < idleTTL {
+		p.mu.Unlock()
+		return
+	}
+	p.lastSweep = time.Now()
+	p.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		_, err := p.db.DB.Exec(
+			ctx,
+			`DELETE FROM rate_limit_buckets WHERE updated_at < NOW() - make_interval(secs => $1)`,
+			idleTTL.Seconds(),
+		)
+		if err != nil {
+			log.Printf("[RateLimit] error sweeping buckets: %v\n", err)
+		}
+	}()
+}
@@ -0,0 +1,116 @@
+package replay
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"expvar"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Kmicac/Webhook-Relay/internal/apperr"
+	"github.com/Kmicac/Webhook-Relay/internal/storage"
+)
+
+// rejected cuenta los rechazos por motivo: "missing_timestamp",
+// "stale_timestamp" y "replayed".
+var rejected = expvar.NewMap("replay_rejected")
+
+var (
+	ErrMissingTimestamp = apperr.Unauthorized("missing_timestamp", "missing signature timestamp")
+	ErrStaleTimestamp   = apperr.Unauthorized("stale_timestamp", "signature timestamp outside tolerance")
+	ErrReplayed         = apperr.Unauthorized("replayed_request", "request already received")
+)
+
+// Store recuerda nonces durante ttl. MarkSeen devuelve true si el nonce ya
+// estaba registrado (es un replay); Forget lo borra.
+type Store interface {
+	MarkSeen(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	Forget(ctx context.Context, key string) error
+}
+
+// Guard rechaza requests firmados con timestamps viejos o ya vistos.
+type Guard struct {
+	Store     Store
+	Tolerance time.Duration
+	now       func() time.Time
+}
+
+const defaultTolerance = 5 * time.Minute
+
+// GuardFromEnv arma el guard desde variables de entorno:
+//
+//	WEBHOOK_TIMESTAMP_TOLERANCE  ventana aceptada (default 5m)
+//	REPLAY_CACHE_BACKEND         memory (default) o postgres
+func GuardFromEnv(store *storage.PostgresStore) (*Guard, error) {
+	g := &Guard{Tolerance: defaultTolerance, now: time.Now}
+
+	if v := os.Getenv("WEBHOOK_TIMESTAMP_TOLERANCE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid WEBHOOK_TIMESTAMP_TOLERANCE %q", v)
+		}
+		g.Tolerance = d
+	}
+
+	switch backend := os.Getenv("REPLAY_CACHE_BACKEND"); backend {
+	case "", "memory":
+		g.Store = NewMemoryStore()
+	case "postgres":
+		g.Store = NewPostgresStore(store)
+	default:
+		return nil, fmt.Errorf("invalid REPLAY_CACHE_BACKEND %q", backend)
+	}
+
+	return g, nil
+}
+
+// Check valida la frescura de ts y que nonce no se haya usado antes dentro
+// de la ventana. scope separa los nonces por cliente/provider.
+//
+// El nonce queda registrado (así dos entregas simultáneas no pasan las
+// dos): si después el request no se puede guardar, el que llama tiene que
+// liberarlo con Release para que el reintento del provider no sea un
+// replay.
+func (g *Guard) Check(ctx context.Context, scope string, ts time.Time, nonce string) error {
+	if ts.IsZero() || nonce == "" {
+		rejected.Add("missing_timestamp", 1)
+		return ErrMissingTimestamp
+	}
+
+	now := g.now()
+	if ts.Before(now.Add(-g.Tolerance)) || ts.After(now.Add(g.Tolerance)) {
+		rejected.Add("stale_timestamp", 1)
+		return ErrStaleTimestamp
+	}
+
+	// el nonce se guarda el doble de la tolerancia: cubre timestamps del
+	// futuro que todavía serían aceptados
+	seen, err := g.Store.MarkSeen(ctx, key(scope, nonce), 2*g.Tolerance)
+	if err != nil {
+		// sin cache la ventana de timestamp sigue protegiendo
+		log.Printf("[Replay] nonce store error: %v\n", err)
+		return nil
+	}
+	if seen {
+		rejected.Add("replayed", 1)
+		return ErrReplayed
+	}
+
+	return nil
+}
+
+// Release olvida un nonce registrado por Check cuyo request no se llegó a
+// guardar.
+func (g *Guard) Release(ctx context.Context, scope, nonce string) {
+	if err := g.Store.Forget(ctx, key(scope, nonce)); err != nil {
+		log.Printf("[Replay] error releasing nonce: %v\n", err)
+	}
+}
+
+func key(scope, nonce string) string {
+	sum := sha256.Sum256([]byte(scope + "\x00" + nonce))
+	return hex.EncodeToString(sum[:])
+}
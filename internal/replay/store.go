@@ -0,0 +1,109 @@
+package replay
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Kmicac/Webhook-Relay/internal/storage"
+)
+
+// MemoryStore guarda los nonces en memoria; sirve para un solo nodo.
+type MemoryStore struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time // key -> expiración
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{seen: map[string]time.Time{}}
+}
+
+func (m *MemoryStore) MarkSeen(_ context.Context, key string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.lastSweep) > time.Minute {
+		for k, exp := range m.seen {
+			if now.After(exp) {
+				delete(m.seen, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	if exp, ok := m.seen[key]; ok && now.Before(exp) {
+		return true, nil
+	}
+
+	m.seen[key] = now.Add(ttl)
+	return false, nil
+}
+
+func (m *MemoryStore) Forget(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.seen, key)
+	return nil
+}
+
+// PostgresStore guarda los nonces en webhook_nonces para compartirlos
+// entre réplicas.
+type PostgresStore struct {
+	db *storage.PostgresStore
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+func NewPostgresStore(store *storage.PostgresStore) *PostgresStore {
+	return &PostgresStore{db: store}
+}
+
+func (p *PostgresStore) MarkSeen(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	p.maybeSweep()
+
+	// si la key existe pero ya expiró se pisa y cuenta como nueva
+	tag, err := p.db.DB.Exec(
+		ctx,
+		`INSERT INTO webhook_nonces (nonce_key, expires_at)
+         VALUES ($1, NOW() + make_interval(secs => $2))
+         ON CONFLICT (nonce_key) DO UPDATE
+             SET expires_at = EXCLUDED.expires_at
+             WHERE webhook_nonces.expires_at < NOW()`,
+		key, ttl.Seconds(),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 0, nil
+}
+
+func (p *PostgresStore) Forget(ctx context.Context, key string) error {
+	_, err := p.db.DB.Exec(ctx, `DELETE FROM webhook_nonces WHERE nonce_key = $1`, key)
+	return err
+}
+
+func (p *PostgresStore) maybeSweep() {
+	p.mu.Lock()
+	if time.Since(p.lastSweep) < 5*time.Minute {
+		p.mu.Unlock()
+		return
+	}
+	p.lastSweep = time.Now()
+	p.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if _, err := p.db.DB.Exec(ctx, `DELETE FROM webhook_nonces WHERE expires_at < NOW()`); err != nil {
+			log.Printf("[Replay] error sweeping nonces: %v\n", err)
+		}
+	}()
+}
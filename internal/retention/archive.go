@@ -0,0 +1,181 @@
+package retention
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Store guarda los archivos. DirStore es la implementación local; un
+// object store (S3, GCS) tiene que implementar lo mismo con name como key.
+type Store interface {
+	Put(ctx context.Context, name string, r io.Reader) error
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// Record es un webhook_event archivado; una línea del NDJSON. RawBody va
+// en base64 (encoding/json de []byte) para conservar los bytes exactos.
+type Record struct {
+	ID           int64       `json:"id"`
+	ClientID     *int64      `json:"client_id"`
+	ClientUID    string      `json:"client_uid,omitempty"`
+	Provider     string      `json:"provider"`
+	RawBody      []byte      `json:"raw_body"`
+	Headers      http.Header `json:"headers"`
+	SourceIP     *string     `json:"source_ip"`
+	QueryString  string      `json:"query_string"`
+	ReceivedAt   time.Time   `json:"received_at"`
+	Processed    bool        `json:"processed"`
+	ProcessedAt  *time.Time  `json:"processed_at"`
+	Attempts     int         `json:"attempts"`
+	ErrorMessage *string     `json:"error_message"`
+	Outcome      *string     `json:"outcome"`
+	DeadAt       *time.Time  `json:"dead_at,omitempty"`
+}
+
+// archiveName arma webhook_events/AAAA/MM/DD/<hora>-<primer id>-<último id>.ndjson.gz;
+// el prefijo por fecha permite listar y restaurar un día entero.
+func archiveName(now time.Time, records []Record) string {
+	return fmt.Sprintf("webhook_events/%s/%s-%d-%d.ndjson.gz",
+		now.UTC().Format("2006/01/02"), now.UTC().Format("150405.000000000"),
+		records[0].ID, records[len(records)-1].ID)
+}
+
+// writeArchive escribe los registros como NDJSON comprimido.
+func writeArchive(ctx context.Context, store Store, name string, records []Record) error {
+	pr, pw := io.Pipe()
+	go func() {
+		gz := gzip.NewWriter(pw)
+		enc := json.NewEncoder(gz)
+		for _, rec := range records {
+			if err := enc.Encode(rec); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.CloseWithError(gz.Close())
+	}()
+
+	err := store.Put(ctx, name, pr)
+	pr.CloseWithError(err) // si Put falló antes de leer todo, libera al writer
+	return err
+}
+
+// readArchive decodifica un archivo y llama a fn por cada registro.
+func readArchive(r io.Reader, fn func(Record) error) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("open archive: %w", err)
+	}
+	defer gz.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(gz))
+	for line := 1; ; line++ {
+		var rec Record
+		if err := dec.Decode(&rec); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("archive record %d: %w", line, err)
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+}
+
+// DirStore guarda los archivos en un directorio local.
+type DirStore struct {
+	Dir string
+}
+
+// NewDirStore no toca el disco: los subdirectorios se crean en Put.
+func NewDirStore(dir string) *DirStore {
+	return &DirStore{Dir: dir}
+}
+
+// Put escribe a un temporal y lo renombra: un archivo a medio escribir
+// nunca queda con el nombre final.
+func (s *DirStore) Put(_ context.Context, name string, r io.Reader) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *DirStore) Get(_ context.Context, name string) (io.ReadCloser, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// List devuelve los archivos cuyo nombre empieza con prefix, ordenados.
+func (s *DirStore) List(_ context.Context, prefix string) ([]string, error) {
+	var names []string
+	if _, err := os.Stat(s.Dir); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	err := filepath.WalkDir(s.Dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".ndjson.gz") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.Dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	sort.Strings(names)
+	return names, err
+}
+
+// path resuelve name dentro de Dir sin dejar salir con "..".
+func (s *DirStore) path(name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || clean == "." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) || clean == ".." {
+		return "", fmt.Errorf("invalid archive name %q", name)
+	}
+	return filepath.Join(s.Dir, clean), nil
+}
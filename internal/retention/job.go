@@ -0,0 +1,257 @@
+package retention
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Kmicac/Webhook-Relay/internal/storage"
+)
+
+var stats = expvar.NewMap("retention")
+
+const (
+	defaultInterval     = time.Hour
+	defaultBatchSize    = 1000
+	defaultDir          = "archive"
+	defaultRestoreGrace = 7 * 24 * time.Hour
+)
+
+// Job archiva y borra los eventos vencidos según Config.
+type Job struct {
+	Repo      *Repository
+	Store     Store
+	Config    *Config
+	Interval  time.Duration
+	BatchSize int
+	// RestoreGrace es cuánto se salvan de la purga los eventos restaurados
+	// (conservan received_at, así que ya están vencidos)
+	RestoreGrace time.Duration
+	now          func() time.Time
+}
+
+// Result es lo que hizo una pasada.
+type Result struct {
+	Archived int
+	Deleted  int64
+	Files    []string
+}
+
+// JobFromEnv arma el job desde variables de entorno:
+//
+//	RETENTION_FILE           archivo de políticas; sin él Config queda nil
+//	                         y no se purga nada (restore funciona igual)
+//	ARCHIVE_DIR              directorio de los archivos (default ./archive)
+//	RETENTION_INTERVAL       cada cuánto corre (default 1h)
+//	RETENTION_BATCH_SIZE     eventos por lote/archivo (default 1000)
+//	RETENTION_RESTORE_GRACE  cuánto no se purgan los eventos restaurados
+//	                         (default 168h)
+func JobFromEnv(store *storage.PostgresStore) (*Job, error) {
+	var cfg *Config
+	if path := os.Getenv("RETENTION_FILE"); path != "" {
+		var err error
+		if cfg, err = LoadConfig(path); err != nil {
+			return nil, err
+		}
+	}
+
+	j := &Job{
+		Repo:         NewRepository(store),
+		Store:        NewDirStore(envOr("ARCHIVE_DIR", defaultDir)),
+		Config:       cfg,
+		Interval:     defaultInterval,
+		BatchSize:    defaultBatchSize,
+		RestoreGrace: defaultRestoreGrace,
+		now:          time.Now,
+	}
+
+	if v := os.Getenv("RETENTION_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid RETENTION_INTERVAL %q", v)
+		}
+		j.Interval = d
+	}
+	if v := os.Getenv("RETENTION_BATCH_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid RETENTION_BATCH_SIZE %q", v)
+		}
+		j.BatchSize = n
+	}
+	if v := os.Getenv("RETENTION_RESTORE_GRACE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid RETENTION_RESTORE_GRACE %q", v)
+		}
+		j.RestoreGrace = d
+	}
+
+	return j, nil
+}
+
+// Run corre una pasada cada Interval hasta que se cancele ctx.
+func (j *Job) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := j.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("[Retention] %v\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce hace una pasada si ningún otro proceso la está haciendo.
+func (j *Job) RunOnce(ctx context.Context) (Result, error) {
+	var res Result
+	ran, err := j.Repo.db.WithTryLock(ctx, lockKey, func() error {
+		var err error
+		res, err = j.purge(ctx)
+		return err
+	})
+	if err != nil {
+		stats.Add("errors", 1)
+		return res, err
+	}
+	if !ran {
+		log.Println("[Retention] another process holds the lock, skipping")
+		return res, nil
+	}
+
+	stats.Add("runs", 1)
+	if res.Archived > 0 {
+		log.Printf("[Retention] archived %d events in %d files, deleted %d\n", res.Archived, len(res.Files), res.Deleted)
+	}
+	return res, nil
+}
+
+// purge recorre los candidatos en lotes. Cada lote se archiva y después
+// se borra en su propia sentencia: si algo falla a mitad, lo borrado ya
+// está archivado y lo que queda se retoma en la próxima pasada.
+func (j *Job) purge(ctx context.Context) (Result, error) {
+	var res Result
+	if j.Config == nil {
+		return res, nil
+	}
+
+	minDays := j.Config.minDays()
+	if minDays == 0 {
+		return res, nil
+	}
+	now := j.now()
+	olderThan := now.AddDate(0, 0, -minDays)
+	restoredBefore := now.Add(-j.RestoreGrace)
+
+	var afterID int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+
+		batch, err := j.Repo.candidates(ctx, afterID, olderThan, restoredBefore, j.BatchSize)
+		if err != nil {
+			return res, fmt.Errorf("select expired events: %w", err)
+		}
+		if len(batch) == 0 {
+			return res, nil
+		}
+		afterID = batch[len(batch)-1].ID
+
+		expired := j.expired(now, batch)
+		if len(expired) == 0 {
+			continue
+		}
+
+		name := archiveName(now, expired)
+		if err := writeArchive(ctx, j.Store, name, expired); err != nil {
+			return res, fmt.Errorf("write archive %s: %w", name, err)
+		}
+		res.Files = append(res.Files, name)
+		res.Archived += len(expired)
+		stats.Add("archived", int64(len(expired)))
+
+		deleted, err := j.Repo.deleteEvents(ctx, expired)
+		if err != nil {
+			return res, fmt.Errorf("delete archived events: %w", err)
+		}
+		res.Deleted += deleted
+		stats.Add("deleted", deleted)
+	}
+}
+
+// expired filtra los registros cuya política ya venció: processed_days
+// para los procesados, dead_days para los muertos.
+func (j *Job) expired(now time.Time, batch []Record) []Record {
+	var out []Record
+	for _, rec := range batch {
+		processedDays, deadDays := j.Config.For(rec.ClientUID, rec.Provider)
+		days := deadDays
+		if rec.Processed {
+			days = processedDays
+		}
+		if days > 0 && rec.ReceivedAt.Before(now.AddDate(0, 0, -days)) {
+			out = append(out, rec)
+		}
+	}
+	return out
+}
+
+// Restore vuelve a importar un archivo. Los eventos conservan su id; los
+// que ya están en la tabla se saltean, así que restaurar dos veces no
+// duplica nada. Los restaurados quedan fuera de la purga durante
+// RestoreGrace; después vuelven a vencer según la política. El mes de cada evento tiene que tener partición: si se
+// desancló (ver internal/partitions) hay que volver a anclarla antes.
+// Devuelve cuántos se insertaron.
+func (j *Job) Restore(ctx context.Context, name string) (int64, error) {
+	rc, err := j.Store.Get(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	var (
+		inserted int64
+		batch    []Record
+	)
+	flush := func() error {
+		n, err := j.Repo.insertRecords(ctx, batch)
+		inserted += n
+		batch = batch[:0]
+		return err
+	}
+
+	err = readArchive(rc, func(rec Record) error {
+		batch = append(batch, rec)
+		if len(batch) < j.BatchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil && len(batch) > 0 {
+		err = flush()
+	}
+	if err != nil {
+		return inserted, fmt.Errorf("restore %s: %w", name, err)
+	}
+
+	stats.Add("restored", inserted)
+	return inserted, nil
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,123 @@
+// Package retention archiva y purga webhook_events vencidos. Un job del
+// worker recorre los eventos viejos, los escribe como NDJSON comprimido en
+// un Store (directorio local u object store) y recién entonces los borra,
+// en lotes cortos para no tomar locks largos. Restore vuelve a importar un
+// archivo.
+package retention
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Policy dice cuántos días se guardan los eventos procesados y los
+// muertos (los que el worker dejó de reintentar). nil hereda del nivel
+// anterior; 0 es "no purgar nunca". Los pendientes y los que esperan un
+// reintento no se purgan.
+type Policy struct {
+	ProcessedDays *int `json:"processed_days"`
+	DeadDays      *int `json:"dead_days"`
+
+	// LegacyFailedDays es la clave vieja: se rechaza para que un archivo
+	// sin migrar no deje de purgar en silencio
+	LegacyFailedDays *int `json:"failed_days"`
+}
+
+// Config es el archivo de políticas (RETENTION_FILE). Gana la del cliente
+// (por client_uid), después la del provider y por último default.
+//
+//	{
+//	  "default":   {"processed_days": 30, "dead_days": 90},
+//	  "providers": {"stripe": {"processed_days": 60}},
+//	  "clients":   {"acme": {"processed_days": 365, "dead_days": 0}}
+//	}
+type Config struct {
+	Default   Policy            `json:"default"`
+	Providers map[string]Policy `json:"providers"`
+	Clients   map[string]Policy `json:"clients"`
+}
+
+// LoadConfig lee y valida el archivo de políticas.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read retention file: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse retention file: %w", err)
+	}
+
+	if err := cfg.Default.validate("default"); err != nil {
+		return nil, err
+	}
+	for name, p := range cfg.Providers {
+		if err := p.validate("providers." + name); err != nil {
+			return nil, err
+		}
+	}
+	for name, p := range cfg.Clients {
+		if err := p.validate("clients." + name); err != nil {
+			return nil, err
+		}
+	}
+	return &cfg, nil
+}
+
+func (p Policy) validate(where string) error {
+	if p.ProcessedDays != nil && *p.ProcessedDays < 0 {
+		return fmt.Errorf("%s.processed_days must be >= 0", where)
+	}
+	if p.DeadDays != nil && *p.DeadDays < 0 {
+		return fmt.Errorf("%s.dead_days must be >= 0", where)
+	}
+	if p.LegacyFailedDays != nil {
+		return fmt.Errorf("%s.failed_days was replaced by dead_days", where)
+	}
+	return nil
+}
+
+// For resuelve los días de retención de un evento. clientUID vacío
+// (eventos sin cliente) usa la del provider o la default.
+func (c *Config) For(clientUID, provider string) (processedDays, deadDays int) {
+	levels := []Policy{c.Default, c.Providers[provider]}
+	if clientUID != "" {
+		levels = append(levels, c.Clients[clientUID])
+	}
+
+	for _, p := range levels {
+		if p.ProcessedDays != nil {
+			processedDays = *p.ProcessedDays
+		}
+		if p.DeadDays != nil {
+			deadDays = *p.DeadDays
+		}
+	}
+	return processedDays, deadDays
+}
+
+// minDays es la retención más corta configurada (sin contar los 0): nada
+// más nuevo que eso puede vencer. 0 si no hay ninguna.
+func (c *Config) minDays() int {
+	min := 0
+	consider := func(d *int) {
+		if d != nil && *d > 0 && (min == 0 || *d < min) {
+			min = *d
+		}
+	}
+
+	all := []Policy{c.Default}
+	for _, p := range c.Providers {
+		all = append(all, p)
+	}
+	for _, p := range c.Clients {
+		all = append(all, p)
+	}
+	for _, p := range all {
+		consider(p.ProcessedDays)
+		consider(p.DeadDays)
+	}
+	return min
+}
@@ -0,0 +1,119 @@
+package retention
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Kmicac/Webhook-Relay/internal/storage"
+)
+
+// lockKey es el advisory lock que evita dos pasadas a la vez cuando hay
+// varios workers.
+const lockKey int64 = 0x7265_7465_6e74 // "retent"
+
+type Repository struct {
+	db *storage.PostgresStore
+}
+
+func NewRepository(store *storage.PostgresStore) *Repository {
+	return &Repository{db: store}
+}
+
+// terminal son los eventos que el worker ya no va a tocar: procesados o
+// muertos, y sin un lease vigente. Uno fallido que espera su reintento no
+// lo es.
+const terminal = `(processed OR dead_at IS NOT NULL)
+           AND (claimed_until IS NULL OR claimed_until <= NOW())`
+
+// candidates devuelve, en orden de id, los eventos terminados recibidos
+// antes de olderThan, salvo los restaurados después de restoredBefore.
+// Cuáles vencen lo decide la política de cada uno.
+func (r *Repository) candidates(ctx context.Context, afterID int64, olderThan, restoredBefore time.Time, limit int) ([]Record, error) {
+	rows, err := r.db.DB.Query(
+		ctx,
+		`SELECT e.id, e.client_id, COALESCE(c.client_uid, ''), e.provider, e.raw_body,
+                e.headers, host(e.source_ip), e.query_string, e.received_at, e.processed,
+                e.processed_at, e.attempts, e.error_message, e.outcome, e.dead_at
+         FROM webhook_events e
+         LEFT JOIN clients c ON c.id = e.client_id
+         WHERE e.id > $1
+           AND e.received_at < $2
+           AND `+terminal+`
+           AND (e.restored_at IS NULL OR e.restored_at < $4)
+         ORDER BY e.id
+         LIMIT $3`,
+		afterID, olderThan, limit, restoredBefore,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []Record
+	for rows.Next() {
+		var rec Record
+		if err := rows.Scan(
+			&rec.ID, &rec.ClientID, &rec.ClientUID, &rec.Provider, &rec.RawBody,
+			&rec.Headers, &rec.SourceIP, &rec.QueryString, &rec.ReceivedAt, &rec.Processed,
+			&rec.ProcessedAt, &rec.Attempts, &rec.ErrorMessage, &rec.Outcome, &rec.DeadAt,
+		); err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	return records, rows.Err()
+}
+
+// deleteEvents borra los eventos ya archivados, por PK (id, received_at)
+// para que cada uno se busque sólo en su partición. Se vuelve a chequear
+// que sigan terminados: uno reencolado o reclamado mientras tanto se
+// queda (el archivo lo tiene igual y restaurarlo no lo duplica).
+func (r *Repository) deleteEvents(ctx context.Context, records []Record) (int64, error) {
+	ids := make([]int64, len(records))
+	receivedAt := make([]time.Time, len(records))
+	for i, rec := range records {
+		ids[i], receivedAt[i] = rec.ID, rec.ReceivedAt
+	}
+
+	tag, err := r.db.DB.Exec(
+		ctx,
+		`DELETE FROM webhook_events
+         WHERE (id, received_at) IN (SELECT * FROM unnest($1::bigint[], $2::timestamptz[]))
+           AND `+terminal,
+		ids, receivedAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// insertRecords restaura eventos con su id original, marcados con
+// restored_at; los que ya existen se saltean. Devuelve cuántos se
+// insertaron.
+func (r *Repository) insertRecords(ctx context.Context, records []Record) (int64, error) {
+	var inserted int64
+	err := pgx.BeginFunc(ctx, r.db.DB, func(tx pgx.Tx) error {
+		for _, rec := range records {
+			tag, err := tx.Exec(
+				ctx,
+				`INSERT INTO webhook_events (
+                    id, client_id, provider, raw_body, headers, source_ip, query_string,
+                    received_at, processed, processed_at, attempts, error_message, outcome, dead_at,
+                    restored_at
+                ) VALUES ($1, $2, $3, $4, $5, $6::inet, $7, $8, $9, $10, $11, $12, $13, $14, NOW())
+                ON CONFLICT (id, received_at) DO NOTHING`,
+				rec.ID, rec.ClientID, rec.Provider, rec.RawBody, rec.Headers, rec.SourceIP, rec.QueryString,
+				rec.ReceivedAt, rec.Processed, rec.ProcessedAt, rec.Attempts, rec.ErrorMessage, rec.Outcome, rec.DeadAt,
+			)
+			if err != nil {
+				return err
+			}
+			inserted += tag.RowsAffected()
+		}
+		return nil
+	})
+	return inserted, err
+}
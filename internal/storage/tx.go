@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DBTX es con lo que hablan los repositorios: el pool o una transacción
+// abierta. Un repositorio armado sobre una transacción (WithTx) escribe
+// dentro de ella, y sus propios Begin pasan a ser savepoints: si fallan
+// deshacen sólo lo suyo y la transacción de afuera sigue usable.
+type DBTX interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+var (
+	_ DBTX = (*pgxpool.Pool)(nil)
+	_ DBTX = (pgx.Tx)(nil)
+)
+
+// UnitOfWork agrupa las escrituras de varios repositorios en una sola
+// transacción: o quedan todas o ninguna.
+type UnitOfWork interface {
+	InTx(ctx context.Context, fn func(tx pgx.Tx) error) error
+}
+
+// InTx corre fn en una transacción; commit si fn devuelve nil, rollback si
+// devuelve error.
+func (s *PostgresStore) InTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	return pgx.BeginFunc(ctx, s.DB, fn)
+}
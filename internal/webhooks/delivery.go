@@ -0,0 +1,76 @@
+package webhooks
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const (
+	maxStoredHeaders     = 50
+	maxStoredHeaderBytes = 1024
+)
+
+// droppedHeaders no se guardan: hop-by-hop o credenciales del emisor que
+// no hacen falta para verificar la firma.
+var droppedHeaders = map[string]bool{
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Proxy-Connection":    true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// filterHeaders arma la copia de headers que se guarda con el evento. Se
+// quedan los de firma (X-Signature, Stripe-Signature, Paypal-Transmission-*,
+// X-Date/X-Login/Authorization de dLocal, ...), request-id y user-agent.
+// Authorization se guarda salvo que sea Basic/Bearer: en dLocal es la
+// firma, en cualquier otro caso sería una credencial. Los valores largos
+// se truncan.
+func filterHeaders(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for name, values := range h {
+		name = http.CanonicalHeaderKey(name)
+		if droppedHeaders[name] || len(out) >= maxStoredHeaders {
+			continue
+		}
+		for _, v := range values {
+			if name == "Authorization" {
+				v = redactCredentials(v)
+			}
+			if len(v) > maxStoredHeaderBytes {
+				v = v[:maxStoredHeaderBytes]
+			}
+			out[name] = append(out[name], v)
+		}
+	}
+	return out
+}
+
+func redactCredentials(v string) string {
+	scheme, _, _ := strings.Cut(v, " ")
+	switch strings.ToLower(scheme) {
+	case "basic", "bearer":
+		return scheme + " [redacted]"
+	}
+	return v
+}
+
+// payload devuelve el body como JSON para procesarlo: los formularios
+// (PayU) se guardan crudos y se convierten acá. Los eventos anteriores a
+// guardar headers no tienen Content-Type y ya son JSON.
+func (ev *WebhookEvent) payload() ([]byte, error) {
+	if ev.Delivery != nil {
+		mediaType, _, _ := mime.ParseMediaType(ev.Delivery.Headers.Get("Content-Type"))
+		if mediaType == "application/x-www-form-urlencoded" {
+			return formToJSON(ev.RawBody)
+		}
+	}
+	return ev.RawBody, nil
+}
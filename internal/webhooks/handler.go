@@ -1,75 +1,233 @@
 package webhooks
 
 import (
-	"io"
+	"context"
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/labstack/echo/v4"
 
+	"github.com/Kmicac/Webhook-Relay/internal/allowlist"
+	"github.com/Kmicac/Webhook-Relay/internal/apperr"
+	"github.com/Kmicac/Webhook-Relay/internal/audit"
+	"github.com/Kmicac/Webhook-Relay/internal/auth"
 	"github.com/Kmicac/Webhook-Relay/internal/clients"
+	"github.com/Kmicac/Webhook-Relay/internal/generic"
+	"github.com/Kmicac/Webhook-Relay/internal/ratelimit"
+	"github.com/Kmicac/Webhook-Relay/internal/replay"
 )
 
 // Handler es el controlador de webhooks de pagos.
 type Handler struct {
 	service    *Service
 	clientRepo *clients.Repository
+	limits     *ratelimit.Policy
+	ingest     IngestLimits
+	allow      *allowlist.Store
+	replay     *replay.Guard
+	paypal     *PayPalVerifier
 }
 
-func NewHandler(service *Service, clientRepo *clients.Repository) *Handler {
+// NewHandler crea el handler; limits puede ser nil (sin rate limit).
+func NewHandler(
+	service *Service,
+	clientRepo *clients.Repository,
+	limits *ratelimit.Policy,
+	ingest IngestLimits,
+	allow *allowlist.Store,
+	replayGuard *replay.Guard,
+) *Handler {
 	return &Handler{
 		service:    service,
 		clientRepo: clientRepo,
+		limits:     limits,
+		ingest:     ingest,
+		allow:      allow,
+		replay:     replayGuard,
+		paypal:     NewPayPalVerifier(nil),
 	}
 }
 
+var (
+	errUnsupportedProvider  = apperr.Validation("unsupported_provider", "unsupported provider")
+	errInvalidClient        = apperr.Unauthorized("invalid_client", "invalid client")
+	errProviderNotEnabled   = apperr.Forbidden("provider_not_enabled", "provider not enabled for client")
+	errInvalidSignature     = apperr.Unauthorized("invalid_signature", "invalid signature")
+	errIPNotAllowed         = apperr.Forbidden("ip_not_allowed", "source ip not allowed")
+	errInvalidEventID       = apperr.Validation("invalid_event_id", "invalid event id")
+	errSigningKeyMissing    = apperr.Forbidden("signing_key_not_configured", "provider signing key not configured for client")
+	errLoginMismatch        = apperr.Unauthorized("invalid_login", "X-Login does not match the client configuration")
+	errGenericNotConfigured = apperr.Forbidden("provider_not_configured", "generic provider has no valid signature/mapping settings")
+)
+
 // HandlePayment recibe y encola webhooks de pago.
 func (h *Handler) HandlePayment(c echo.Context) error {
-	body, err := io.ReadAll(c.Request().Body)
-	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "invalid body",
-		})
-	}
-
 	clientID := c.Param("client_id")
 	provider := c.Param("provider")
 
+	if !clients.IsSupportedProvider(provider) {
+		return errUnsupportedProvider
+	}
+
+	// allowlists de IP: defensa extra, antes de cualquier verificación de firma
+	sourceIP := c.RealIP()
+	if !h.allow.ProviderAllowed(provider, sourceIP) {
+		return errIPNotAllowed
+	}
+
+	// tamaño, content-type y JSON se validan acá para no encolar algo que
+	// el worker después no va a poder procesar
+	raw, body, err := readWebhookBody(c.Response(), c.Request(), provider, h.ingest)
+	if err != nil {
+		return err
+	}
+
+	// un cliente inexistente es un 401; si la base no responde el emisor
+	// tiene que reintentar, así que ese error se propaga tal cual (503)
 	client, err := h.clientRepo.FindByUID(clientID)
+	if apperr.IsNotFound(err) {
+		return errInvalidClient
+	}
+	if err != nil {
+		return err
+	}
+
+	if client.Deleted() {
+		return clients.ErrClientDeleted
+	}
+
+	if client.Disabled() {
+		return clients.ErrClientDisabled
+	}
+
+	if !allowlist.ClientAllowed(client.AllowedCIDRs, sourceIP) {
+		return errIPNotAllowed
+	}
+
+	if err := h.limits.CheckClient(c, client.UID, client.RateLimitRPS, client.RateLimitBurst); err != nil {
+		return err
+	}
+
+	// el provider de la URL tiene que estar configurado y habilitado
+	// para este cliente; cada uno tiene su propio secret
+	providerCfg, err := h.clientRepo.FindProvider(client.ID, provider)
+	if errors.Is(err, clients.ErrProviderNotFound) || (err == nil && !providerCfg.Enabled) {
+		return errProviderNotEnabled
+	}
 	if err != nil {
-		return c.JSON(http.StatusUnauthorized, map[string]string{
-			"error": "invalid client",
-		})
+		return err
 	}
 
 	signature := c.Request().Header.Get("X-Signature")
 
+	// firma declarativa del provider generic; también define el replay
+	var genericSig *generic.Signature
+
 	switch provider {
 	case "mercadopago":
-		if !VerifyMPSignature([]byte(client.Secret), signature, body) {
-			return c.JSON(http.StatusUnauthorized, map[string]string{
-				"error": "invalid signature",
-			})
+		if !VerifyMPSignature([]byte(providerCfg.Secret), signature, body) {
+			return errInvalidSignature
 		}
+	// las claves de Stripe, PayPal, Adyen, dLocal y PayU las genera el
+	// provider, no nosotros: van en settings
 	case "stripe":
-		// TODO: implementar verificación real de Stripe más adelante
-		// Por ahora podrías aceptar sin firma o loguear:
-		// log.Println("[WARN] Stripe signature verification not implemented yet")
+		key, _ := providerCfg.Settings["signing_secret"].(string)
+		if key == "" {
+			return errSigningKeyMissing
+		}
+		if !VerifyStripeSignature(key, c.Request().Header.Get("Stripe-Signature"), body) {
+			return errInvalidSignature
+		}
 	case "paypal":
-		// TODO: implementar verificación real de PayPal más adelante
+		webhookID, _ := providerCfg.Settings["webhook_id"].(string)
+		if webhookID == "" {
+			return errSigningKeyMissing
+		}
+		if err := h.paypal.Verify(c.Request().Context(), webhookID, c.Request().Header, body); err != nil {
+			return err
+		}
+	case "adyen":
+		key, _ := providerCfg.Settings["hmac_key"].(string)
+		if key == "" {
+			return errSigningKeyMissing
+		}
+		if !VerifyAdyenSignature(key, body) {
+			return errInvalidSignature
+		}
+	case "dlocal":
+		key, _ := providerCfg.Settings["secret_key"].(string)
+		if key == "" {
+			return errSigningKeyMissing
+		}
+		if login, _ := providerCfg.Settings["x_login"].(string); login != "" && login != c.Request().Header.Get("X-Login") {
+			return errLoginMismatch
+		}
+		if !VerifyDLocalSignature(key, c.Request().Header, body) {
+			return errInvalidSignature
+		}
+	case "payu":
+		key, _ := providerCfg.Settings["api_key"].(string)
+		if key == "" {
+			return errSigningKeyMissing
+		}
+		if !VerifyPayUSignature(key, body) {
+			return errInvalidSignature
+		}
+	case "generic":
+		cfg, err := generic.ParseConfig(providerCfg.Settings)
+		if err != nil {
+			return errGenericNotConfigured
+		}
+		if !cfg.Signature.Verify(providerCfg.Secret, c.Request().Header, body) {
+			return errInvalidSignature
+		}
+		genericSig = &cfg.Signature
 	default:
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "unsupported provider",
-		})
+		return errUnsupportedProvider
+	}
+
+	// la firma puede ser válida y aun así ser un request capturado y
+	// reenviado: exigimos timestamp fresco y nonce no visto (salvo los
+	// providers que no firman timestamp, ver replayProtected; el generic
+	// sólo si su config declara timestamp_header)
+	checkReplay := replayProtected(provider)
+	ts, nonce := replayToken(provider, c.Request().Header)
+	if genericSig != nil {
+		ts, nonce, checkReplay = genericSig.ReplayToken(c.Request().Header)
+	}
+	scope := client.UID + "/" + provider
+	if checkReplay {
+		if err := h.replay.Check(c.Request().Context(), scope, ts, nonce); err != nil {
+			return err
+		}
 	}
 
-	ev, err := h.service.EnqueueEvent(provider, string(body))
+	ev, err := h.service.EnqueueEvent(client.ID, provider, raw, Delivery{
+		Headers:     filterHeaders(c.Request().Header),
+		SourceIP:    &sourceIP,
+		QueryString: c.Request().URL.RawQuery,
+	})
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to enqueue event",
-		})
+		// el webhook no quedó guardado: el provider lo va a reintentar con
+		// la misma firma y no tiene que contar como replay
+		if checkReplay {
+			h.replay.Release(context.WithoutCancel(c.Request().Context()), scope, nonce)
+		}
+		return err
+	}
+
+	// Adyen sólo da por entregado el lote si la respuesta es exactamente
+	// "[accepted]" y PayU si es un 200; cualquier otra cosa la reintentan
+	status := http.StatusCreated
+	switch provider {
+	case "adyen":
+		return c.String(http.StatusOK, "[accepted]")
+	case "payu":
+		status = http.StatusOK
 	}
 
-	return c.JSON(http.StatusCreated, map[string]interface{}{
+	return c.JSON(status, map[string]interface{}{
 		"status":   "enqueued",
 		"event_id": ev.ID,
 		"provider": ev.Provider,
@@ -77,7 +235,120 @@ func (h *Handler) HandlePayment(c echo.Context) error {
 	})
 }
 
-func (h *Handler) ListEvents(c echo.Context) error {
-	events := h.service.ListEvents()
+// GET /admin/events?client=&provider=&status=&after_id=&before_id=&limit=
+func (h *Handler) AdminListEvents(c echo.Context) error {
+	f := EventFilter{
+		ClientUID: c.QueryParam("client"),
+		Provider:  c.QueryParam("provider"),
+		Status:    c.QueryParam("status"),
+	}
+
+	if f.Status != "" && !validStatus(f.Status) {
+		return apperr.Validation("invalid_status", "invalid status")
+	}
+
+	var err error
+	if f.AfterID, err = queryInt64(c, "after_id"); err != nil {
+		return apperr.Validation("invalid_after_id", "invalid after_id")
+	}
+	if f.BeforeID, err = queryInt64(c, "before_id"); err != nil {
+		return apperr.Validation("invalid_before_id", "invalid before_id")
+	}
+	limit, err := queryInt64(c, "limit")
+	if err != nil {
+		return apperr.Validation("invalid_limit", "invalid limit")
+	}
+	f.Limit = int(limit)
+
+	// las keys de un tenant sólo ven sus propios eventos
+	if p := auth.PrincipalFrom(c); p != nil && p.ClientID != nil {
+		f.ClientID = p.ClientID
+	}
+
+	events, err := h.service.ListEventsFiltered(c.Request().Context(), f)
+	if err != nil {
+		return err
+	}
+
 	return c.JSON(http.StatusOK, events)
 }
+
+// GET /admin/events/:id
+func (h *Handler) GetEvent(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return errInvalidEventID
+	}
+
+	detail, err := h.accessibleEvent(c, id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, detail)
+}
+
+// POST /admin/events/:id/replay
+func (h *Handler) ReplayEvent(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return errInvalidEventID
+	}
+
+	detail, err := h.accessibleEvent(c, id)
+	if err != nil {
+		return err
+	}
+
+	if err := h.service.ReplayEvent(c.Request().Context(), id, detail.Event.ReceivedAt); err != nil {
+		return err
+	}
+
+	audit.Record(c, "event.replay", "event", strconv.FormatInt(id, 10), detail.Event, map[string]interface{}{
+		"status": StatusPending,
+	})
+
+	return c.JSON(http.StatusAccepted, map[string]interface{}{
+		"status":   "requeued",
+		"event_id": id,
+	})
+}
+
+// accessibleEvent carga el evento; los de otro tenant cuentan como
+// inexistentes para no revelar que existen.
+func (h *Handler) accessibleEvent(c echo.Context, id int64) (*EventDetail, error) {
+	detail, err := h.service.GetEvent(c.Request().Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if !canAccessEvent(c, detail.Event) {
+		return nil, ErrEventNotFound
+	}
+	return detail, nil
+}
+
+// canAccessEvent verifica el scoping por tenant de la API key.
+func canAccessEvent(c echo.Context, ev *WebhookEvent) bool {
+	p := auth.PrincipalFrom(c)
+	if p == nil || p.ClientID == nil {
+		return true
+	}
+	return ev.ClientID != nil && *ev.ClientID == *p.ClientID
+}
+
+func validStatus(status string) bool {
+	for _, s := range Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func queryInt64(c echo.Context, name string) (int64, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
@@ -0,0 +1,163 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Kmicac/Webhook-Relay/internal/apperr"
+)
+
+const defaultMaxBodyBytes int64 = 1 << 20 // 1 MiB
+
+// IngestLimits son las validaciones que se hacen al recibir un webhook,
+// antes de encolarlo.
+type IngestLimits struct {
+	MaxBodyBytes int64
+	// override por provider
+	ProviderMaxBodyBytes map[string]int64
+}
+
+// IngestLimitsFromEnv lee WEBHOOK_MAX_BODY_BYTES y, por provider,
+// WEBHOOK_MAX_BODY_BYTES_<PROVIDER> (p.ej. WEBHOOK_MAX_BODY_BYTES_STRIPE).
+func IngestLimitsFromEnv(providers []string) (IngestLimits, error) {
+	l := IngestLimits{
+		MaxBodyBytes:         defaultMaxBodyBytes,
+		ProviderMaxBodyBytes: map[string]int64{},
+	}
+
+	if v := os.Getenv("WEBHOOK_MAX_BODY_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return l, fmt.Errorf("invalid WEBHOOK_MAX_BODY_BYTES %q", v)
+		}
+		l.MaxBodyBytes = n
+	}
+
+	for _, p := range providers {
+		key := "WEBHOOK_MAX_BODY_BYTES_" + strings.ToUpper(p)
+		if v := os.Getenv(key); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n <= 0 {
+				return l, fmt.Errorf("invalid %s %q", key, v)
+			}
+			l.ProviderMaxBodyBytes[p] = n
+		}
+	}
+
+	return l, nil
+}
+
+func (l IngestLimits) maxBodyFor(provider string) int64 {
+	if n, ok := l.ProviderMaxBodyBytes[provider]; ok {
+		return n
+	}
+	if l.MaxBodyBytes > 0 {
+		return l.MaxBodyBytes
+	}
+	return defaultMaxBodyBytes
+}
+
+// Rechazos de la ingestión, con un código estable para que el emisor
+// sepa qué corregir.
+var (
+	errUnsupportedMediaType = apperr.New(apperr.KindUnsupportedMedia, "unsupported_media_type", "content type must be application/json")
+	errInvalidForm          = apperr.Validation("invalid_form", "request body is not a valid form")
+	errEmptyBody            = apperr.Validation("empty_body", "request body is empty")
+	errInvalidJSON          = apperr.Validation("invalid_json", "request body is not valid JSON")
+	errUnreadableBody       = apperr.Validation("invalid_body", "could not read request body")
+)
+
+// formProviders mandan el webhook como application/x-www-form-urlencoded
+// (la página de confirmación de PayU). Se guarda crudo y se procesa como
+// JSON.
+var formProviders = map[string]bool{"payu": true}
+
+// readWebhookBody valida Content-Type, tamaño y que el body sea JSON.
+// Devuelve los bytes tal cual llegaron (lo que se guarda) y el payload
+// JSON (lo que se verifica y se procesa); son lo mismo salvo en los
+// formularios de formProviders, que se convierten a un objeto JSON con un
+// string por campo.
+func readWebhookBody(w http.ResponseWriter, r *http.Request, provider string, limits IngestLimits) (raw, payload []byte, err error) {
+	isForm, err := checkContentType(r.Header.Get("Content-Type"), formProviders[provider])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	max := limits.maxBodyFor(provider)
+	if r.ContentLength > max {
+		return nil, nil, tooLarge(max)
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, max))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return nil, nil, tooLarge(max)
+		}
+		return nil, nil, errUnreadableBody.Wrap(err)
+	}
+
+	if len(strings.TrimSpace(string(body))) == 0 {
+		return nil, nil, errEmptyBody
+	}
+
+	if isForm {
+		payload, err := formToJSON(body)
+		if err != nil {
+			return nil, nil, err
+		}
+		return body, payload, nil
+	}
+
+	if !json.Valid(body) {
+		return nil, nil, errInvalidJSON
+	}
+
+	return body, body, nil
+}
+
+// checkContentType acepta JSON y, si allowForm, formularios; devuelve si
+// el body es un formulario.
+func checkContentType(header string, allowForm bool) (bool, error) {
+	if header == "" {
+		return false, errUnsupportedMediaType
+	}
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return false, errUnsupportedMediaType
+	}
+	if allowForm && mediaType == "application/x-www-form-urlencoded" {
+		return true, nil
+	}
+	if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+		return false, errUnsupportedMediaType
+	}
+	return false, nil
+}
+
+// formToJSON pasa el formulario a {"campo": "valor"}; de un campo repetido
+// queda el primer valor.
+func formToJSON(body []byte) ([]byte, error) {
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, errInvalidForm.Wrap(err)
+	}
+
+	fields := make(map[string]string, len(values))
+	for k, v := range values {
+		fields[k] = v[0]
+	}
+	return json.Marshal(fields)
+}
+
+func tooLarge(max int64) *apperr.Error {
+	return apperr.New(apperr.KindTooLarge, "body_too_large", fmt.Sprintf("request body exceeds %d bytes", max))
+}
@@ -1,14 +1,98 @@
 package webhooks
 
-import "time"
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Kmicac/Webhook-Relay/internal/payments"
+)
+
+// Estados derivados de un evento en la cola.
+const (
+	StatusPending   = "pending"
+	StatusProcessed = "processed"
+	StatusFailed    = "failed"  // falló y espera el próximo intento
+	StatusDead      = "dead"    // falló y no se reintenta más (sólo con replay)
+	StatusIgnored   = "ignored" // procesado, pero el tipo de evento no genera un pago
+)
+
+// Statuses son los estados válidos para filtrar.
+var Statuses = []string{StatusPending, StatusProcessed, StatusFailed, StatusDead, StatusIgnored}
 
 type WebhookEvent struct {
 	ID           int64      `db:"id" json:"id"`
+	ClientID     *int64     `db:"client_id" json:"client_id,omitempty"`
 	Provider     string     `db:"provider" json:"provider"`
-	RawBody      string     `db:"raw_body" json:"raw_body"`
+	RawBody      RawBody    `db:"raw_body" json:"raw_body"`
 	ReceivedAt   time.Time  `db:"received_at" json:"received_at"`
 	Processed    bool       `db:"processed" json:"processed"`
 	ProcessedAt  *time.Time `db:"processed_at" json:"processed_at,omitempty"`
 	Attempts     int        `db:"attempts" json:"attempts"`
 	ErrorMessage *string    `db:"error_message" json:"error_message,omitempty"`
+	Outcome      *string    `db:"outcome" json:"outcome,omitempty"`
+	// NextAttemptAt es cuándo se reintenta un evento fallido; DeadAt,
+	// cuándo se dejó de reintentar
+	NextAttemptAt *time.Time `db:"next_attempt_at" json:"next_attempt_at,omitempty"`
+	DeadAt        *time.Time `db:"dead_at" json:"dead_at,omitempty"`
+	// ClaimedUntil es el lease del worker que lo está procesando
+	ClaimedUntil *time.Time `db:"claimed_until" json:"-"`
+	Status       string     `db:"-" json:"status"`
+
+	// Delivery se muestra en el detalle (EventDetail), no en los listados
+	Delivery *Delivery `db:"-" json:"-"`
+}
+
+// RawBody son los bytes del body tal cual llegaron. En la API va como
+// texto: los webhooks que aceptamos son JSON o formularios.
+type RawBody []byte
+
+func (b RawBody) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(b))
+}
+
+func (b *RawBody) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*b = RawBody(s)
+	return nil
+}
+
+// Delivery es cómo llegó el webhook: los headers del request (sin
+// credenciales ni hop-by-hop, ver filterHeaders), la IP de origen y el
+// query string.
+type Delivery struct {
+	Headers     http.Header `json:"headers"`
+	SourceIP    *string     `json:"source_ip"`
+	QueryString string      `json:"query_string"`
+}
+
+// computeStatus deriva el estado a partir de processed/dead_at/error_message.
+func (ev *WebhookEvent) computeStatus() string {
+	switch {
+	case ev.Processed && ev.Outcome != nil && *ev.Outcome == string(payments.OutcomeIgnored):
+		return StatusIgnored
+	case ev.Processed:
+		return StatusProcessed
+	case ev.DeadAt != nil:
+		return StatusDead
+	case ev.ErrorMessage != nil:
+		return StatusFailed
+	default:
+		return StatusPending
+	}
+}
+
+// EventFilter son los filtros del listado de eventos del admin.
+// AfterID sirve para "tail" (eventos nuevos), BeforeID para paginar hacia atrás.
+type EventFilter struct {
+	ClientID  *int64
+	ClientUID string
+	Provider  string
+	Status    string
+	AfterID   int64
+	BeforeID  int64
+	Limit     int
 }
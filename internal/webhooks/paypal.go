@@ -0,0 +1,221 @@
+package webhooks
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Kmicac/Webhook-Relay/internal/apperr"
+)
+
+// paypalCertHosts son los únicos hosts de los que se acepta bajar el
+// certificado: Paypal-Cert-Url viene en el request y no está firmado.
+var paypalCertHosts = map[string]bool{
+	"api.paypal.com":           true,
+	"api-m.paypal.com":         true,
+	"api.sandbox.paypal.com":   true,
+	"api-m.sandbox.paypal.com": true,
+}
+
+const (
+	paypalCertTimeout  = 5 * time.Second
+	paypalCertMaxBytes = 64 << 10
+	paypalCertCacheMax = 32
+)
+
+var errPayPalCertUnavailable = apperr.Unavailable("paypal_cert_unavailable", "could not fetch PayPal signing certificate")
+
+// PayPalVerifier verifica la firma de transmisión de PayPal (la
+// verificación "offline" de su documentación):
+//
+//	Paypal-Transmission-Sig = base64(RSA-SHA256(cert,
+//	    transmission_id|transmission_time|webhook_id|crc32(body)))
+//
+// con el certificado que indica Paypal-Cert-Url. Los certificados se
+// cachean por URL hasta que vencen.
+type PayPalVerifier struct {
+	client *http.Client
+	roots  *x509.CertPool // nil: los del sistema
+
+	mu    sync.Mutex
+	certs map[string]*x509.Certificate
+}
+
+// NewPayPalVerifier crea el verificador; client puede ser nil.
+func NewPayPalVerifier(client *http.Client) *PayPalVerifier {
+	if client == nil {
+		client = &http.Client{Timeout: paypalCertTimeout}
+	}
+	return &PayPalVerifier{
+		client: client,
+		certs:  map[string]*x509.Certificate{},
+	}
+}
+
+// Verify devuelve errInvalidSignature si la firma no corresponde y un
+// error 503 si no se pudo bajar el certificado (PayPal reintenta).
+// webhookID es el id del webhook en la cuenta de PayPal del cliente.
+func (v *PayPalVerifier) Verify(ctx context.Context, webhookID string, h http.Header, body []byte) error {
+	transmissionID := h.Get("Paypal-Transmission-Id")
+	transmissionTime := h.Get("Paypal-Transmission-Time")
+	sig, err := base64.StdEncoding.DecodeString(h.Get("Paypal-Transmission-Sig"))
+	if transmissionID == "" || transmissionTime == "" || err != nil || len(sig) == 0 {
+		return errInvalidSignature
+	}
+	if algo := h.Get("Paypal-Auth-Algo"); algo != "" && algo != "SHA256withRSA" {
+		return errInvalidSignature
+	}
+
+	certURL, err := paypalCertURL(h.Get("Paypal-Cert-Url"))
+	if err != nil {
+		return errInvalidSignature
+	}
+	cert, err := v.cert(ctx, certURL)
+	if errors.Is(err, errInvalidSignature) {
+		return err
+	}
+	if err != nil {
+		log.Printf("[PayPal] error fetching cert %s: %v\n", certURL, err)
+		return errPayPalCertUnavailable.Wrap(err)
+	}
+
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return errInvalidSignature
+	}
+
+	signed := strings.Join([]string{
+		transmissionID,
+		transmissionTime,
+		webhookID,
+		strconv.FormatUint(uint64(crc32.ChecksumIEEE(body)), 10),
+	}, "|")
+	digest := sha256.Sum256([]byte(signed))
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig); err != nil {
+		return errInvalidSignature
+	}
+	return nil
+}
+
+// paypalCertURL sólo acepta https a los hosts de PayPal.
+func paypalCertURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.User != nil || !paypalCertHosts[strings.ToLower(u.Hostname())] {
+		return "", fmt.Errorf("cert url not allowed: %q", raw)
+	}
+	if p := u.Port(); p != "" && p != "443" {
+		return "", fmt.Errorf("cert url not allowed: %q", raw)
+	}
+	return u.String(), nil
+}
+
+func (v *PayPalVerifier) cert(ctx context.Context, certURL string) (*x509.Certificate, error) {
+	now := time.Now()
+
+	v.mu.Lock()
+	cert, ok := v.certs[certURL]
+	v.mu.Unlock()
+	if ok && now.Before(cert.NotAfter) {
+		return cert, nil
+	}
+
+	cert, err := v.fetchCert(ctx, certURL, now)
+	if err != nil {
+		return nil, err
+	}
+
+	v.mu.Lock()
+	if len(v.certs) >= paypalCertCacheMax {
+		v.certs = map[string]*x509.Certificate{}
+	}
+	v.certs[certURL] = cert
+	v.mu.Unlock()
+	return cert, nil
+}
+
+// fetchCert baja la cadena PEM y la valida contra las raíces: el primero
+// es el de firma y tiene que ser un certificado de PayPal.
+func (v *PayPalVerifier) fetchCert(ctx context.Context, certURL string, now time.Time) (*x509.Certificate, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, certURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, paypalCertMaxBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	var chain []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errInvalidSignature
+		}
+		chain = append(chain, c)
+	}
+	if len(chain) == 0 {
+		return nil, errInvalidSignature
+	}
+
+	leaf := chain[0]
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         v.roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return nil, errInvalidSignature
+	}
+	if !isPayPalCert(leaf) {
+		return nil, errInvalidSignature
+	}
+	return leaf, nil
+}
+
+// isPayPalCert exige que el certificado sea de PayPal: cualquiera con un
+// certificado válido de otro dominio podría firmar si no.
+func isPayPalCert(c *x509.Certificate) bool {
+	names := append([]string{c.Subject.CommonName}, c.DNSNames...)
+	for _, n := range names {
+		n = strings.ToLower(n)
+		if n == "paypal.com" || strings.HasSuffix(n, ".paypal.com") {
+			return true
+		}
+	}
+	return false
+}
@@ -3,28 +3,53 @@ package webhooks
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 
+	"github.com/Kmicac/Webhook-Relay/internal/apperr"
 	"github.com/Kmicac/Webhook-Relay/internal/storage"
 )
 
+var ErrEventNotFound = apperr.NotFound("event_not_found", "event not found")
+
+const eventColumns = `id, client_id, provider, raw_body, received_at, processed, processed_at, attempts, error_message, outcome,
+       next_attempt_at, dead_at, claimed_until, headers, host(source_ip), query_string`
+
 type Repository struct {
-	db *storage.PostgresStore
+	db storage.DBTX
 }
 
 func NewRepository(store *storage.PostgresStore) *Repository {
-	return &Repository{db: store}
+	return &Repository{db: store.DB}
+}
+
+// WithTx devuelve el repositorio trabajando dentro de tx (ver
+// storage.UnitOfWork).
+func (r *Repository) WithTx(tx pgx.Tx) *Repository {
+	return &Repository{db: tx}
 }
 
 func (r *Repository) CreateEvent(ev *WebhookEvent) error {
-	err := r.db.DB.QueryRow(
+	d := ev.Delivery
+	if d == nil {
+		d = &Delivery{}
+	}
+	if d.Headers == nil {
+		d.Headers = http.Header{}
+	}
+
+	err := r.db.QueryRow(
 		context.Background(),
-		`INSERT INTO webhook_events (provider, raw_body, processed, attempts)
-         VALUES ($1, $2, FALSE, 0)
+		`INSERT INTO webhook_events (client_id, provider, raw_body, headers, source_ip, query_string, processed, attempts)
+         VALUES ($1, $2, $3, $4, NULLIF($5, '')::inet, $6, FALSE, 0)
          RETURNING id, received_at`,
-		ev.Provider, ev.RawBody,
+		ev.ClientID, ev.Provider, []byte(ev.RawBody), d.Headers, d.SourceIP, d.QueryString,
 	).Scan(&ev.ID, &ev.ReceivedAt)
 	if err != nil {
 		log.Printf("[WebhooksRepository] error creating webhook event: %v\n", err)
@@ -39,115 +64,280 @@ func (r *Repository) CreateEvent(ev *WebhookEvent) error {
 	return nil
 }
 
-func (r *Repository) FetchNextPending(ctx context.Context) (*WebhookEvent, error) {
-	tx, err := r.db.DB.Begin(ctx)
+// ClaimPending reclama hasta limit eventos pendientes, en orden de id,
+// por lease: hasta que venza ningún otro worker los toma. Los que fallaron
+// esperan a su next_attempt_at y los muertos no se toman. Un solo viaje
+// a la base para todo el lote.
+func (r *Repository) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]WebhookEvent, error) {
+	rows, err := r.db.Query(
+		ctx,
+		`UPDATE webhook_events
+         SET claimed_until = NOW() + make_interval(secs => $2)
+         FROM (
+             SELECT id AS claim_id, received_at AS claim_received_at
+             FROM webhook_events
+             WHERE processed = FALSE
+               AND dead_at IS NULL
+               AND (next_attempt_at IS NULL OR next_attempt_at <= NOW())
+               AND (claimed_until IS NULL OR claimed_until < NOW())
+             ORDER BY id
+             LIMIT $1
+             FOR UPDATE SKIP LOCKED
+         ) c
+         WHERE id = c.claim_id AND received_at = c.claim_received_at
+         RETURNING `+eventColumns,
+		limit,
+		lease.Seconds(),
+	)
 	if err != nil {
-		log.Printf("[WebhooksRepository] error starting transaction: %v\n", err)
+		log.Printf("[WebhooksRepository] error claiming pending events: %v\n", err)
 		return nil, err
 	}
+	defer rows.Close()
 
-	var ev WebhookEvent
-	err = tx.QueryRow(
-		ctx,
-		`SELECT id, provider, raw_body, received_at, processed, processed_at, attempts, error_message
-         FROM webhook_events
-         WHERE processed = FALSE
-         ORDER BY id
-         FOR UPDATE SKIP LOCKED
-         LIMIT 1`,
-	).Scan(
-		&ev.ID,
-		&ev.Provider,
-		&ev.RawBody,
-		&ev.ReceivedAt,
-		&ev.Processed,
-		&ev.ProcessedAt,
-		&ev.Attempts,
-		&ev.ErrorMessage,
-	)
-	if errors.Is(err, pgx.ErrNoRows) {
-		_ = tx.Rollback(ctx)
-		return nil, nil
-	}
+	events, err := collectEvents(rows)
 	if err != nil {
-		_ = tx.Rollback(ctx)
-		log.Printf("[WebhooksRepository] error fetching pending event: %v\n", err)
+		log.Printf("[WebhooksRepository] error claiming pending events: %v\n", err)
 		return nil, err
 	}
 
-	if err := tx.Commit(ctx); err != nil {
-		log.Printf("[WebhooksRepository] error committing pending fetch: %v\n", err)
-		return nil, err
+	// RETURNING no respeta el ORDER BY del subquery
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, nil
+}
+
+// Completion es el resultado de procesar un evento reclamado: Outcome si
+// se procesó, Err si falló. Un fallido se reintenta dentro de RetryIn o,
+// si Dead, no se reintenta más. ClaimedUntil es el lease que dio
+// ClaimPending y funciona como token del claim.
+type Completion struct {
+	ID           int64
+	ReceivedAt   time.Time
+	ClaimedUntil time.Time
+	Outcome      string
+	Err          string
+	RetryIn      time.Duration
+	Dead         bool
+}
+
+// Complete guarda el resultado de un lote de eventos en un solo viaje
+// (pgx.Batch) y libera sus leases. Los fallidos quedan con el error y la
+// hora del próximo intento, o muertos.
+//
+// Sólo se escribe si el evento sigue con el lease de este claim: si venció
+// y otro worker lo reclamó, el resultado es de ese otro worker y éste se
+// descarta (los pagos que haya guardado no se duplican, ver
+// payments.savePaymentSQL).
+func (r *Repository) Complete(ctx context.Context, done []Completion) error {
+	if len(done) == 0 {
+		return nil
 	}
 
-	return &ev, nil
+	batch := &pgx.Batch{}
+	for _, c := range done {
+		if c.Err != "" {
+			batch.Queue(
+				`UPDATE webhook_events
+                 SET processed = FALSE,
+                     processed_at = NULL,
+                     attempts = attempts + 1,
+                     error_message = SUBSTRING($3 FOR 500),
+                     claimed_until = NULL,
+                     next_attempt_at = CASE WHEN $4 THEN NULL ELSE NOW() + make_interval(secs => $5) END,
+                     dead_at = CASE WHEN $4 THEN NOW() END
+                 WHERE id = $1 AND received_at = $2
+                   AND claimed_until IS NOT NULL AND claimed_until = $6`,
+				c.ID, c.ReceivedAt, c.Err, c.Dead, c.RetryIn.Seconds(), c.ClaimedUntil,
+			)
+			continue
+		}
+		batch.Queue(
+			`UPDATE webhook_events
+             SET processed = TRUE,
+                 processed_at = NOW(),
+                 attempts = attempts + 1,
+                 error_message = NULL,
+                 outcome = $3,
+                 claimed_until = NULL,
+                 next_attempt_at = NULL
+             WHERE id = $1 AND received_at = $2
+               AND claimed_until IS NOT NULL AND claimed_until = $4`,
+			c.ID, c.ReceivedAt, c.Outcome, c.ClaimedUntil,
+		)
+	}
+
+	results := r.db.SendBatch(ctx, batch)
+	for _, c := range done {
+		tag, err := results.Exec()
+		if err != nil {
+			results.Close()
+			log.Printf("[WebhooksRepository] error completing %d events: %v\n", len(done), err)
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			log.Printf("[WebhooksRepository] lease lost for event id=%d, discarding its result\n", c.ID)
+		}
+	}
+	if err := results.Close(); err != nil {
+		log.Printf("[WebhooksRepository] error completing %d events: %v\n", len(done), err)
+		return err
+	}
+	return nil
 }
 
-func (r *Repository) MarkProcessed(ctx context.Context, id int64) error {
-	_, err := r.db.DB.Exec(
+// List devuelve eventos aplicando los filtros del admin.
+func (r *Repository) List(ctx context.Context, f EventFilter) ([]WebhookEvent, error) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if f.ClientID != nil {
+		conds = append(conds, "client_id = "+arg(*f.ClientID))
+	}
+	if f.ClientUID != "" {
+		conds = append(conds, "client_id = (SELECT id FROM clients WHERE client_uid = "+arg(f.ClientUID)+")")
+	}
+	if f.Provider != "" {
+		conds = append(conds, "provider = "+arg(f.Provider))
+	}
+	switch f.Status {
+	case StatusPending:
+		conds = append(conds, "processed = FALSE AND error_message IS NULL")
+	case StatusProcessed:
+		conds = append(conds, "processed = TRUE AND outcome IS DISTINCT FROM 'ignored'")
+	case StatusIgnored:
+		conds = append(conds, "processed = TRUE AND outcome = 'ignored'")
+	case StatusFailed:
+		conds = append(conds, "processed = FALSE AND error_message IS NOT NULL AND dead_at IS NULL")
+	case StatusDead:
+		conds = append(conds, "dead_at IS NOT NULL")
+	}
+	if f.AfterID > 0 {
+		conds = append(conds, "id > "+arg(f.AfterID))
+	}
+	if f.BeforeID > 0 {
+		conds = append(conds, "id < "+arg(f.BeforeID))
+	}
+
+	query := `SELECT ` + eventColumns + ` FROM webhook_events`
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	// al hacer tail queremos los más viejos primero
+	if f.AfterID > 0 {
+		query += " ORDER BY id ASC"
+	} else {
+		query += " ORDER BY id DESC"
+	}
+	query += " LIMIT " + arg(f.Limit)
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		log.Printf("[WebhooksRepository] error listing events: %v\n", err)
+		return nil, apperr.FromDB(err, nil, nil)
+	}
+	defer rows.Close()
+
+	events, err := collectEvents(rows)
+	return events, apperr.FromDB(err, nil, nil)
+}
+
+// FindByID devuelve el evento o ErrEventNotFound. Sólo se tiene el id
+// (viene de la URL), así que se busca en el índice de la PK de cada
+// partición; donde se conoce received_at conviene filtrar también por él.
+func (r *Repository) FindByID(ctx context.Context, id int64) (*WebhookEvent, error) {
+	ev, err := scanEvent(r.db.QueryRow(
 		ctx,
-		`UPDATE webhook_events
-         SET processed = TRUE,
-             processed_at = NOW(),
-             attempts = attempts + 1,
-             error_message = NULL
-         WHERE id = $1`,
+		`SELECT `+eventColumns+` FROM webhook_events WHERE id = $1`,
 		id,
-	)
+	))
 	if err != nil {
-		log.Printf("[WebhooksRepository] error marking processed (id=%d): %v\n", id, err)
+		if !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("[WebhooksRepository] error fetching event (id=%d): %v\n", id, err)
+		}
+		return nil, apperr.FromDB(err, ErrEventNotFound, nil)
 	}
-	return err
+	return ev, nil
 }
 
-func (r *Repository) MarkFailed(ctx context.Context, id int64, errMsg string) error {
-	_, err := r.db.DB.Exec(
+// Requeue vuelve a dejar el evento como pendiente para que el worker lo
+// procese de nuevo, con los intentos en cero (también si estaba muerto).
+// Devuelve ErrEventNotFound si el evento no existe.
+// receivedAt completa la PK (id, received_at) y limita el UPDATE a una
+// partición.
+func (r *Repository) Requeue(ctx context.Context, id int64, receivedAt time.Time) error {
+	tag, err := r.db.Exec(
 		ctx,
 		`UPDATE webhook_events
          SET processed = FALSE,
              processed_at = NULL,
-             attempts = attempts + 1,
-             error_message = SUBSTRING($2 FOR 500)
-         WHERE id = $1`,
-		id,
-		errMsg,
+             error_message = NULL,
+             outcome = NULL,
+             claimed_until = NULL,
+             attempts = 0,
+             next_attempt_at = NULL,
+             dead_at = NULL
+         WHERE id = $1 AND received_at = $2`,
+		id, receivedAt,
 	)
 	if err != nil {
-		log.Printf("[WebhooksRepository] error marking failed (id=%d): %v\n", id, err)
+		log.Printf("[WebhooksRepository] error requeueing event (id=%d): %v\n", id, err)
+		return apperr.FromDB(err, nil, nil)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrEventNotFound
 	}
-	return err
+	return nil
 }
 
-// ListAll devuelve todos los eventos guardados en la tabla webhook_events.
-func (r *Repository) ListAll() ([]WebhookEvent, error) {
-	rows, err := r.db.DB.Query(
-		context.Background(),
-		`SELECT id, provider, raw_body, received_at, processed, processed_at, attempts, error_message
-         FROM webhook_events
-         ORDER BY id DESC`,
+func scanEvent(row pgx.Row) (*WebhookEvent, error) {
+	var (
+		ev  WebhookEvent
+		d   Delivery
+		raw []byte
 	)
-	if err != nil {
+	if err := row.Scan(
+		&ev.ID,
+		&ev.ClientID,
+		&ev.Provider,
+		&raw,
+		&ev.ReceivedAt,
+		&ev.Processed,
+		&ev.ProcessedAt,
+		&ev.Attempts,
+		&ev.ErrorMessage,
+		&ev.Outcome,
+		&ev.NextAttemptAt,
+		&ev.DeadAt,
+		&ev.ClaimedUntil,
+		&d.Headers,
+		&d.SourceIP,
+		&d.QueryString,
+	); err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	ev.RawBody = raw
+	ev.Delivery = &d
+	ev.Status = ev.computeStatus()
+	return &ev, nil
+}
 
+func collectEvents(rows pgx.Rows) ([]WebhookEvent, error) {
 	var events []WebhookEvent
 
 	for rows.Next() {
-		var ev WebhookEvent
-		if err := rows.Scan(
-			&ev.ID,
-			&ev.Provider,
-			&ev.RawBody,
-			&ev.ReceivedAt,
-			&ev.Processed,
-			&ev.ProcessedAt,
-			&ev.Attempts,
-			&ev.ErrorMessage,
-		); err != nil {
+		ev, err := scanEvent(rows)
+		if err != nil {
 			return nil, err
 		}
-		events = append(events, ev)
+		events = append(events, *ev)
 	}
 
 	return events, rows.Err()
@@ -3,71 +3,112 @@ package webhooks
 import (
 	"context"
 	"log"
+	"time"
 
+	"github.com/Kmicac/Webhook-Relay/internal/apperr"
 	"github.com/Kmicac/Webhook-Relay/internal/payments"
+	"github.com/Kmicac/Webhook-Relay/internal/storage"
 )
 
+// Enricher completa el body de un evento antes de procesarlo, p.ej. las
+// notificaciones de MercadoPago que sólo traen el id del pago.
+type Enricher interface {
+	Enrich(ctx context.Context, clientID int64, provider string, body []byte) ([]byte, error)
+}
+
 type Service struct {
 	repo           *Repository
 	paymentService *payments.Service
+	enricher       Enricher
+	uow            storage.UnitOfWork
 }
 
-func NewService(repo *Repository, paymentService *payments.Service) *Service {
+// NewService crea el servicio; enricher puede ser nil (sólo lo usa el
+// worker). uow es la transacción en la que el worker guarda los pagos y
+// el resultado de los eventos.
+func NewService(repo *Repository, paymentService *payments.Service, enricher Enricher, uow storage.UnitOfWork) *Service {
 	return &Service{
 		repo:           repo,
 		paymentService: paymentService,
+		enricher:       enricher,
+		uow:            uow,
 	}
 }
 
-func (s *Service) EnqueueEvent(provider string, rawBody string) (*WebhookEvent, error) {
+// EnqueueEvent guarda el webhook con el body tal cual llegó y los datos
+// de la entrega.
+func (s *Service) EnqueueEvent(clientID int64, provider string, rawBody []byte, d Delivery) (*WebhookEvent, error) {
 	ev := &WebhookEvent{
+		ClientID:  &clientID,
 		Provider:  provider,
 		RawBody:   rawBody,
 		Processed: false,
 		Attempts:  0,
+		Delivery:  &d,
 	}
 
 	if err := s.repo.CreateEvent(ev); err != nil {
 		log.Printf("[WebhookService] error enqueuing webhook event: %v\n", err)
-		return nil, err
+		return nil, apperr.FromDB(err, nil, nil)
 	}
 
 	return ev, nil
 }
 
-func (s *Service) ProcessNextPending(ctx context.Context) (bool, error) {
-	ev, err := s.repo.FetchNextPending(ctx)
-	if err != nil {
-		return false, err
-	}
+// EventDetail es un evento junto con los datos de la entrega y el pago que
+// generó (si ya se procesó).
+type EventDetail struct {
+	Event    *WebhookEvent     `json:"event"`
+	Delivery *Delivery         `json:"delivery"`
+	Payment  *payments.Payment `json:"payment"`
+}
 
-	if ev == nil {
-		return false, nil
-	}
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
 
-	log.Printf("[Worker] processing event id=%d provider=%s\n", ev.ID, ev.Provider)
+// ListEventsFiltered lista eventos para el admin con filtros y límite acotado.
+func (s *Service) ListEventsFiltered(ctx context.Context, f EventFilter) ([]WebhookEvent, error) {
+	if f.Limit <= 0 {
+		f.Limit = defaultListLimit
+	}
+	if f.Limit > maxListLimit {
+		f.Limit = maxListLimit
+	}
 
-	if err := s.paymentService.Process([]byte(ev.RawBody), ev.ID, ev.Provider); err != nil {
-		log.Printf("[WebhookService] error processing event id=%d: %v\n", ev.ID, err)
-		_ = s.repo.MarkFailed(ctx, ev.ID, err.Error())
-		return true, err
+	events, err := s.repo.List(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	if events == nil {
+		events = []WebhookEvent{}
 	}
+	return events, nil
+}
 
-	if err := s.repo.MarkProcessed(ctx, ev.ID); err != nil {
-		return true, err
+// GetEvent devuelve el detalle de un evento, o ErrEventNotFound.
+func (s *Service) GetEvent(ctx context.Context, id int64) (*EventDetail, error) {
+	ev, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
 	}
 
-	log.Printf("[Worker] processed event id=%d\n", ev.ID)
+	// el pago se crea después de recibir el evento: con received_at el
+	// lookup sólo recorre las particiones de payments desde ese mes
+	payment, err := s.paymentService.FindByWebhookEventID(ctx, id, ev.ReceivedAt)
+	if err != nil {
+		return nil, apperr.FromDB(err, nil, nil)
+	}
 
-	return true, nil
+	return &EventDetail{Event: ev, Delivery: ev.Delivery, Payment: payment}, nil
 }
 
-// ListEvents returns the events saved from the repository.
-func (s *Service) ListEvents() []WebhookEvent {
-	events, err := s.repo.ListAll()
-	if err != nil {
-		log.Printf("[WebhookService] Error listando eventos: %v\n", err)
-		return []WebhookEvent{}
+// ReplayEvent reencola un evento. Devuelve ErrEventNotFound si no existe.
+func (s *Service) ReplayEvent(ctx context.Context, id int64, receivedAt time.Time) error {
+	if err := s.repo.Requeue(ctx, id, receivedAt); err != nil {
+		return err
 	}
-	return events
+	log.Printf("[WebhookService] event id=%d requeued for replay\n", id)
+	return nil
 }
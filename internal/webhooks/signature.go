@@ -2,25 +2,53 @@ package webhooks
 
 import (
 	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func VerifyMPSignature(secret []byte, signatureHeader string, body []byte) bool {
-	if signatureHeader == "" {
+	ts, v1, ok := parseMPSignature(signatureHeader)
+	if !ok {
 		return false
 	}
 
-	// Esperamos: "ts=1702000000, v1=7cb2..."
+	// 1) Calcular SHA-256 del body
+	bodyHash := sha256.Sum256(body)
+	digest := hex.EncodeToString(bodyHash[:])
+
+	// 2) Armar el string base SEGÚN MP:
+	// ts=<ts>:digest=<body_sha256>
+	signBase := "ts=" + ts + ":digest=" + digest
+
+	// 3) HMAC-SHA256(secret, signBase)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signBase))
+	expectedMAC := mac.Sum(nil)
+	expectedHex := hex.EncodeToString(expectedMAC)
+
+	// 4) Comparar en constante time
+	return hmac.Equal([]byte(expectedHex), []byte(v1))
+}
+
+// parseMPSignature separa el header "ts=1702000000, v1=7cb2...".
+func parseMPSignature(signatureHeader string) (ts, v1 string, ok bool) {
+	if signatureHeader == "" {
+		return "", "", false
+	}
+
 	parts := strings.Split(signatureHeader, ",")
 	if len(parts) != 2 {
-		return false
+		return "", "", false
 	}
 
-	var ts string
-	var v1 string
-
 	for _, p := range parts {
 		p = strings.TrimSpace(p)
 		if strings.HasPrefix(p, "ts=") {
@@ -31,24 +59,266 @@ func VerifyMPSignature(secret []byte, signatureHeader string, body []byte) bool
 		}
 	}
 
-	if ts == "" || v1 == "" {
+	return ts, v1, ts != "" && v1 != ""
+}
+
+// VerifyStripeSignature verifica el header de Stripe:
+//
+//	Stripe-Signature: t=1492774577,v1=5257a8...[,v1=...]
+//
+// con v1 = hex(HMAC-SHA256(signingSecret, t + "." + body)). Durante una
+// rotación Stripe manda varios v1: alcanza con que uno coincida. Los v0
+// (firmas de test) se ignoran.
+func VerifyStripeSignature(signingSecret, header string, body []byte) bool {
+	ts, signatures := parseStripeSignature(header)
+	if ts == "" || len(signatures) == 0 || signingSecret == "" {
 		return false
 	}
 
-	// 1) Calcular SHA-256 del body
-	bodyHash := sha256.Sum256(body)
-	digest := hex.EncodeToString(bodyHash[:])
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
 
-	// 2) Armar el string base SEGÚN MP:
-	// ts=<ts>:digest=<body_sha256>
-	signBase := "ts=" + ts + ":digest=" + digest
+	for _, sig := range signatures {
+		if hmac.Equal([]byte(expected), []byte(sig)) {
+			return true
+		}
+	}
+	return false
+}
 
-	// 3) HMAC-SHA256(secret, signBase)
-	mac := hmac.New(sha256.New, secret)
-	mac.Write([]byte(signBase))
-	expectedMAC := mac.Sum(nil)
-	expectedHex := hex.EncodeToString(expectedMAC)
+// parseStripeSignature separa el timestamp y las firmas v1.
+func parseStripeSignature(header string) (ts string, v1 []string) {
+	for _, p := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			if v != "" {
+				v1 = append(v1, v)
+			}
+		}
+	}
+	return ts, v1
+}
 
-	// 4) Comparar en constante time
-	return hmac.Equal([]byte(expectedHex), []byte(v1))
+// adyenNotification es el lote que manda Adyen; sólo lo necesario para
+// verificar las firmas.
+type adyenNotification struct {
+	NotificationItems []struct {
+		Item adyenItem `json:"NotificationRequestItem"`
+	} `json:"notificationItems"`
+}
+
+type adyenItem struct {
+	PspReference        string `json:"pspReference"`
+	OriginalReference   string `json:"originalReference"`
+	MerchantAccountCode string `json:"merchantAccountCode"`
+	MerchantReference   string `json:"merchantReference"`
+	Amount              struct {
+		Value    json.Number `json:"value"`
+		Currency string      `json:"currency"`
+	} `json:"amount"`
+	EventCode      string `json:"eventCode"`
+	Success        string `json:"success"`
+	AdditionalData struct {
+		HMACSignature string `json:"hmacSignature"`
+	} `json:"additionalData"`
+}
+
+// VerifyAdyenSignature verifica la firma de cada NotificationRequestItem del
+// lote. Adyen no firma el request sino cada item, con la HMAC key (hex) del
+// Customer Area:
+//
+//	base64(HMAC-SHA256(key, pspReference:originalReference:merchantAccountCode:
+//	    merchantReference:value:currency:eventCode:success))
+//
+// Un lote vacío o con un solo item sin firma válida se rechaza entero.
+func VerifyAdyenSignature(hexKey string, body []byte) bool {
+	key, err := hex.DecodeString(hexKey)
+	if err != nil || len(key) == 0 {
+		return false
+	}
+
+	var n adyenNotification
+	if err := json.Unmarshal(body, &n); err != nil || len(n.NotificationItems) == 0 {
+		return false
+	}
+
+	for _, wrapper := range n.NotificationItems {
+		item := wrapper.Item
+		signBase := strings.Join([]string{
+			item.PspReference,
+			item.OriginalReference,
+			item.MerchantAccountCode,
+			item.MerchantReference,
+			item.Amount.Value.String(),
+			item.Amount.Currency,
+			item.EventCode,
+			item.Success,
+		}, ":")
+
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signBase))
+		expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+		if !hmac.Equal([]byte(expected), []byte(item.AdditionalData.HMACSignature)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// VerifyDLocalSignature verifica el header de dLocal:
+//
+//	Authorization: V2-HMAC-SHA256, Signature: <hex>
+//
+// con Signature = HMAC-SHA256(secretKey, X-Login + X-Date + body).
+func VerifyDLocalSignature(secretKey string, h http.Header, body []byte) bool {
+	signature, ok := parseDLocalAuthorization(h.Get("Authorization"))
+	if !ok || secretKey == "" {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secretKey))
+	mac.Write([]byte(h.Get("X-Login")))
+	mac.Write([]byte(h.Get("X-Date")))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(expected), []byte(strings.ToLower(signature)))
+}
+
+func parseDLocalAuthorization(header string) (string, bool) {
+	scheme, rest, ok := strings.Cut(header, ",")
+	if !ok || strings.TrimSpace(scheme) != "V2-HMAC-SHA256" {
+		return "", false
+	}
+	k, v, ok := strings.Cut(strings.TrimSpace(rest), ":")
+	if !ok || strings.TrimSpace(k) != "Signature" {
+		return "", false
+	}
+	v = strings.TrimSpace(v)
+	return v, v != ""
+}
+
+// VerifyPayUSignature verifica el campo "sign" de la confirmación de PayU
+// (el formulario ya convertido a JSON por readWebhookBody):
+//
+//	sign = hash(ApiKey~merchant_id~reference_sale~new_value~currency~state_pol)
+//
+// El hash es MD5, SHA1 o SHA256 según la configuración de la cuenta; se
+// reconoce por el largo de la firma.
+func VerifyPayUSignature(apiKey string, body []byte) bool {
+	var f map[string]string
+	if err := json.Unmarshal(body, &f); err != nil || apiKey == "" {
+		return false
+	}
+
+	value, ok := payuSignValue(f["value"])
+	if !ok {
+		return false
+	}
+	signBase := strings.Join([]string{
+		apiKey, f["merchant_id"], f["reference_sale"], value, f["currency"], f["state_pol"],
+	}, "~")
+
+	var sum []byte
+	sign := strings.ToLower(f["sign"])
+	switch len(sign) {
+	case md5.Size * 2:
+		h := md5.Sum([]byte(signBase))
+		sum = h[:]
+	case sha1.Size * 2:
+		h := sha1.Sum([]byte(signBase))
+		sum = h[:]
+	case sha256.Size * 2:
+		h := sha256.Sum256([]byte(signBase))
+		sum = h[:]
+	default:
+		return false
+	}
+
+	return hmac.Equal([]byte(hex.EncodeToString(sum)), []byte(sign))
+}
+
+// payuSignValue arma new_value: si el segundo decimal es cero va con un
+// solo decimal (150.00 -> 150.0), si no con dos (150.26).
+func payuSignValue(value string) (string, bool) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return "", false
+	}
+	s := strconv.FormatFloat(f, 'f', 2, 64)
+	if strings.HasSuffix(s, "0") {
+		s = s[:len(s)-1]
+	}
+	return s, true
+}
+
+// replayProtected indica si el provider firma un timestamp. Adyen y PayU
+// no lo hacen y reintentan el mismo webhook (durante días) hasta recibir
+// la respuesta esperada, así que ahí el guard rechazaría los reintentos
+// legítimos: los duplicados se resuelven al guardar.
+func replayProtected(provider string) bool {
+	switch provider {
+	case "adyen", "payu":
+		return false
+	}
+	return true
+}
+
+// replayToken devuelve el timestamp firmado y un valor único del request
+// (la firma o el id de transmisión) para la protección contra replays.
+// Sólo se llama después de verificar la firma, que cubre estos headers.
+// Si el provider no mandó los headers devuelve valores vacíos.
+func replayToken(provider string, h http.Header) (time.Time, string) {
+	switch provider {
+	case "mercadopago":
+		ts, v1, ok := parseMPSignature(h.Get("X-Signature"))
+		if !ok {
+			return time.Time{}, ""
+		}
+		return parseUnix(ts), v1
+
+	case "stripe":
+		ts, v1 := parseStripeSignature(h.Get("Stripe-Signature"))
+		if len(v1) == 0 {
+			return time.Time{}, ""
+		}
+		return parseUnix(ts), v1[0]
+
+	case "paypal":
+		ts, err := time.Parse(time.RFC3339, h.Get("Paypal-Transmission-Time"))
+		if err != nil {
+			return time.Time{}, ""
+		}
+		return ts, h.Get("Paypal-Transmission-Id")
+
+	case "dlocal":
+		ts, err := time.Parse(time.RFC3339, h.Get("X-Date"))
+		if err != nil {
+			return time.Time{}, ""
+		}
+		signature, _ := parseDLocalAuthorization(h.Get("Authorization"))
+		return ts, signature
+	}
+
+	return time.Time{}, ""
+}
+
+// parseUnix acepta segundos o milisegundos desde epoch.
+func parseUnix(v string) time.Time {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n <= 0 {
+		return time.Time{}
+	}
+	if n > 1e12 {
+		return time.UnixMilli(n)
+	}
+	return time.Unix(n, 0)
 }
@@ -0,0 +1,153 @@
+package webhooks
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// update reescribe los payloads de testdata/*.json (go test -update).
+var update = flag.Bool("update", false, "rewrite testdata/*.json payloads")
+
+// fixture es un request de testdata/*.http: una línea "# settings: {...}"
+// con la config del provider, la request line, headers, línea en blanco y
+// el body tal cual lo firma el provider.
+type fixture struct {
+	provider string
+	settings map[string]string
+	req      *http.Request
+}
+
+func loadFixture(t *testing.T, name string) fixture {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	head, body, ok := bytes.Cut(data, []byte("\n\n"))
+	if !ok {
+		t.Fatalf("%s: no blank line between headers and body", name)
+	}
+	body = bytes.TrimRight(body, "\n")
+
+	var f fixture
+	sc := bufio.NewScanner(bytes.NewReader(head))
+	var method, target string
+	headers := http.Header{}
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "# settings:"):
+			// el JSON puede venir seguido de un comentario
+			dec := json.NewDecoder(strings.NewReader(strings.TrimPrefix(line, "# settings:")))
+			if err := dec.Decode(&f.settings); err != nil {
+				t.Fatalf("%s: settings: %v", name, err)
+			}
+		case strings.HasPrefix(line, "#"):
+		case method == "":
+			method, target, _ = strings.Cut(line, " ")
+		default:
+			k, v, _ := strings.Cut(line, ":")
+			headers.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+		}
+	}
+
+	// /webhooks/{client_uid}/<provider>/payments
+	parts := strings.Split(target, "/")
+	if len(parts) != 5 {
+		t.Fatalf("%s: unexpected target %q", name, target)
+	}
+	f.provider = parts[3]
+
+	f.req = httptest.NewRequest(method, "/webhooks/fixture/"+f.provider+"/payments", bytes.NewReader(body))
+	f.req.Header = headers
+	return f
+}
+
+func TestFixtureSignatures(t *testing.T) {
+	cases := []string{
+		"dlocal_payment_paid.http",
+		"dlocal_refund_success.http",
+		"dlocal_chargeback_completed.http",
+		"payu_confirmation_approved.http",
+		"payu_confirmation_declined_sha256.http",
+	}
+
+	verify := func(f fixture, key string, body []byte) bool {
+		switch f.provider {
+		case "dlocal":
+			return VerifyDLocalSignature(key, f.req.Header, body)
+		case "payu":
+			return VerifyPayUSignature(key, body)
+		}
+		t.Fatalf("unexpected provider %s", f.provider)
+		return false
+	}
+
+	for _, name := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := loadFixture(t, name)
+			key := f.settings["secret_key"]
+			if f.provider == "payu" {
+				key = f.settings["api_key"]
+			}
+
+			// el mismo camino que HandlePayment: lo que se verifica es el
+			// payload (en PayU, el formulario pasado a JSON)
+			_, payload, err := readWebhookBody(httptest.NewRecorder(), f.req, f.provider, IngestLimits{})
+			if err != nil {
+				t.Fatalf("readWebhookBody: %v", err)
+			}
+			checkPayload(t, name, payload)
+
+			if !verify(f, key, payload) {
+				t.Fatal("valid signature rejected")
+			}
+			if verify(f, key+"x", payload) {
+				t.Error("signature accepted with the wrong key")
+			}
+
+			tampered := bytes.Replace(payload, []byte(`"BRL"`), []byte(`"USD"`), 1)
+			if f.provider == "payu" {
+				tampered = bytes.Replace(payload, []byte(`"COP"`), []byte(`"USD"`), 1)
+			}
+			if bytes.Equal(tampered, payload) {
+				t.Fatal("fixture has nothing to tamper with")
+			}
+			if verify(f, key, tampered) {
+				t.Error("signature accepted for a tampered body")
+			}
+		})
+	}
+}
+
+// checkPayload compara el payload con testdata/<fixture>.json, que es lo
+// que usan los tests de internal/payments (no pueden importar este
+// paquete): así el parseo del .http y el pasaje de formularios a JSON
+// están en un solo lugar.
+func checkPayload(t *testing.T, name string, payload []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", strings.TrimSuffix(name, ".http")+".json")
+	if *update {
+		if err := os.WriteFile(path, append(payload, '\n'), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(bytes.TrimRight(want, "\n"), payload) {
+		t.Errorf("payload differs from %s (run go test -update if the change is expected):\n%s", path, payload)
+	}
+}
@@ -0,0 +1,213 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Kmicac/Webhook-Relay/internal/apperr"
+	"github.com/Kmicac/Webhook-Relay/internal/payments"
+)
+
+const (
+	defaultBatchSize   = 100
+	defaultClaimLease  = 5 * time.Minute
+	defaultMaxAttempts = 10
+	defaultRetryBase   = 30 * time.Second
+	defaultRetryMax    = time.Hour
+)
+
+// BatchConfig es cuántos eventos reclama el worker por vuelta y por
+// cuánto tiempo. El lease tiene que cubrir el procesamiento de un lote
+// entero (incluidas las llamadas del enricher); si vence antes, otro
+// worker puede tomar los mismos eventos.
+type BatchConfig struct {
+	Size  int
+	Lease time.Duration
+	Retry RetryPolicy
+}
+
+// RetryPolicy es cuándo se reintenta un evento que falló: con backoff
+// exponencial desde Base hasta Max, y como mucho MaxAttempts veces. Después
+// (o si el error no se arregla reintentando) el evento queda muerto hasta
+// que alguien haga un replay.
+type RetryPolicy struct {
+	MaxAttempts int
+	Base        time.Duration
+	Max         time.Duration
+}
+
+// delay es la espera antes del intento siguiente al número attempt
+// (1 = el primero que falló): Base, 2*Base, 4*Base... hasta Max.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.Base
+	for i := 1; i < attempt && d < p.Max; i++ {
+		d *= 2
+	}
+	return min(d, p.Max)
+}
+
+// fail marca c como fallido en su intento número attempt: lo programa para
+// reintentarse o lo deja muerto. Un error de validación (payload inválido,
+// formulario corrupto) da lo mismo en cada intento, así que muere de una.
+func (p RetryPolicy) fail(c *Completion, attempt int, err error) {
+	c.Outcome = ""
+	c.Err = err.Error()
+	c.Dead = attempt >= p.MaxAttempts || apperr.KindOf(err) == apperr.KindValidation
+	c.RetryIn = 0
+	if !c.Dead {
+		c.RetryIn = p.delay(attempt)
+	}
+}
+
+// BatchConfigFromEnv lee WORKER_BATCH_SIZE (default 100),
+// WORKER_CLAIM_LEASE (default 5m), WORKER_MAX_ATTEMPTS (default 10),
+// WORKER_RETRY_BASE (default 30s) y WORKER_RETRY_MAX (default 1h).
+func BatchConfigFromEnv() (BatchConfig, error) {
+	c := BatchConfig{
+		Size:  defaultBatchSize,
+		Lease: defaultClaimLease,
+		Retry: RetryPolicy{MaxAttempts: defaultMaxAttempts, Base: defaultRetryBase, Max: defaultRetryMax},
+	}
+
+	if v := os.Getenv("WORKER_BATCH_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return c, fmt.Errorf("invalid WORKER_BATCH_SIZE %q", v)
+		}
+		c.Size = n
+	}
+	if v := os.Getenv("WORKER_CLAIM_LEASE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return c, fmt.Errorf("invalid WORKER_CLAIM_LEASE %q", v)
+		}
+		c.Lease = d
+	}
+	if v := os.Getenv("WORKER_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return c, fmt.Errorf("invalid WORKER_MAX_ATTEMPTS %q", v)
+		}
+		c.Retry.MaxAttempts = n
+	}
+	if v := os.Getenv("WORKER_RETRY_BASE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return c, fmt.Errorf("invalid WORKER_RETRY_BASE %q", v)
+		}
+		c.Retry.Base = d
+	}
+	if v := os.Getenv("WORKER_RETRY_MAX"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < c.Retry.Base {
+			return c, fmt.Errorf("invalid WORKER_RETRY_MAX %q (must be >= WORKER_RETRY_BASE)", v)
+		}
+		c.Retry.Max = d
+	}
+	return c, nil
+}
+
+// ProcessPendingBatch reclama un lote de eventos pendientes, los procesa y
+// guarda los pagos y el resultado de todos en una transacción. Cada
+// evento termina por su lado: uno que falla se reprograma según
+// cfg.Retry (o queda muerto) sin afectar al resto (sus escrituras se
+// deshacen con un savepoint).
+// Devuelve cuántos eventos reclamó (0 = cola vacía).
+func (s *Service) ProcessPendingBatch(ctx context.Context, cfg BatchConfig) (int, error) {
+	events, err := s.repo.ClaimPending(ctx, cfg.Size, cfg.Lease)
+	if err != nil {
+		return 0, err
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	log.Printf("[Worker] claimed %d events (ids %d..%d)\n", len(events), events[0].ID, events[len(events)-1].ID)
+
+	done := make([]Completion, len(events))
+	var (
+		batch []payments.Event
+		index []int // posición en events de cada batch[i]
+	)
+
+	for i := range events {
+		ev := &events[i]
+		done[i] = Completion{ID: ev.ID, ReceivedAt: ev.ReceivedAt}
+		if ev.ClaimedUntil != nil {
+			done[i].ClaimedUntil = *ev.ClaimedUntil
+		}
+
+		body, err := s.prepare(ctx, ev)
+		if err != nil {
+			cfg.Retry.fail(&done[i], ev.Attempts+1, err)
+			continue
+		}
+		batch = append(batch, payments.Event{ID: ev.ID, ClientID: ev.ClientID, Provider: ev.Provider, Body: body})
+		index = append(index, i)
+	}
+
+	// los pagos y el resultado de los eventos se confirman juntos: si algo
+	// falla no queda un pago guardado con su evento todavía pendiente (que
+	// se reprocesaría y lo guardaría dos veces)
+	err = s.uow.InTx(ctx, func(tx pgx.Tx) error {
+		for k, res := range s.paymentService.WithTx(tx).ProcessBatch(ctx, batch) {
+			i := index[k]
+			if res.Err != nil {
+				cfg.Retry.fail(&done[i], events[i].Attempts+1, res.Err)
+				continue
+			}
+			done[i].Outcome = string(res.Outcome)
+		}
+		return s.repo.WithTx(tx).Complete(ctx, done)
+	})
+	if err != nil {
+		// no se guardó nada del lote: los eventos se reprograman con el
+		// error en vez de esperar a que venza el lease
+		log.Printf("[WebhookService] error committing batch: %v\n", err)
+		for i := range done {
+			if done[i].Err == "" {
+				cfg.Retry.fail(&done[i], events[i].Attempts+1, err)
+			}
+		}
+		if cerr := s.repo.Complete(ctx, done); cerr != nil {
+			log.Printf("[WebhookService] error releasing batch: %v\n", cerr)
+		}
+		return len(events), err
+	}
+
+	for _, c := range done {
+		if c.Dead {
+			log.Printf("[WebhookService] event id=%d is dead, not retrying: %s\n", c.ID, c.Err)
+			continue
+		}
+		if c.Err != "" {
+			log.Printf("[WebhookService] error processing event id=%d (retry in %s): %s\n", c.ID, c.RetryIn, c.Err)
+			continue
+		}
+		log.Printf("[Worker] processed event id=%d (%s)\n", c.ID, c.Outcome)
+	}
+	return len(events), nil
+}
+
+// prepare devuelve el body a procesar: el payload JSON del evento y, si
+// hay enricher, completado (p.ej. el pago de MercadoPago).
+func (s *Service) prepare(ctx context.Context, ev *WebhookEvent) ([]byte, error) {
+	body, err := ev.payload()
+	if err != nil {
+		log.Printf("[WebhookService] error decoding event id=%d: %v\n", ev.ID, err)
+		return nil, err
+	}
+	if s.enricher != nil && ev.ClientID != nil {
+		if body, err = s.enricher.Enrich(ctx, *ev.ClientID, ev.Provider, body); err != nil {
+			log.Printf("[WebhookService] error enriching event id=%d: %v\n", ev.ID, err)
+			return nil, err
+		}
+	}
+	return body, nil
+}
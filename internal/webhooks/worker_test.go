@@ -0,0 +1,54 @@
+package webhooks
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Kmicac/Webhook-Relay/internal/payments"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, Base: 30 * time.Second, Max: 3 * time.Minute}
+
+	for attempt, want := range map[int]time.Duration{
+		1: 30 * time.Second,
+		2: time.Minute,
+		3: 2 * time.Minute,
+		4: 3 * time.Minute, // tope
+		9: 3 * time.Minute,
+	} {
+		if got := p.delay(attempt); got != want {
+			t.Errorf("delay(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+
+	cases := []struct {
+		name    string
+		attempt int
+		err     error
+		dead    bool
+	}{
+		{"transient", 1, errors.New("connection reset"), false},
+		{"last attempt", 5, errors.New("connection reset"), true},
+		{"invalid payload", 1, fmt.Errorf("stripe: %w", payments.ErrInvalidPayload), true},
+		{"invalid form", 1, errInvalidForm, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := Completion{Outcome: "saved"}
+			p.fail(&c, tc.attempt, tc.err)
+
+			if c.Dead != tc.dead {
+				t.Errorf("Dead = %v, want %v", c.Dead, tc.dead)
+			}
+			if c.Outcome != "" || c.Err != tc.err.Error() {
+				t.Errorf("Outcome = %q, Err = %q", c.Outcome, c.Err)
+			}
+			if wantRetry := !tc.dead; (c.RetryIn > 0) != wantRetry {
+				t.Errorf("RetryIn = %s", c.RetryIn)
+			}
+		})
+	}
+}
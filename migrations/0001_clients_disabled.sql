@@ -0,0 +1,3 @@
+-- Permite deshabilitar un cliente sin borrarlo.
+ALTER TABLE clients
+    ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMPTZ;
@@ -0,0 +1,13 @@
+-- Ciclo de vida de clientes: metadata editable y soft delete.
+ALTER TABLE clients
+    ADD COLUMN IF NOT EXISTS metadata   JSONB NOT NULL DEFAULT '{}'::jsonb,
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+-- Los eventos quedan asociados al cliente que los envió, así siguen
+-- siendo consultables aunque el cliente se dé de baja.
+ALTER TABLE webhook_events
+    ADD COLUMN IF NOT EXISTS client_id BIGINT REFERENCES clients (id);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_events_client_id
+    ON webhook_events (client_id, id);
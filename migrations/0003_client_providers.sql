@@ -0,0 +1,23 @@
+-- Un cliente puede tener varios providers, cada uno con su secret y settings.
+CREATE TABLE IF NOT EXISTS client_providers (
+    id         BIGSERIAL PRIMARY KEY,
+    client_id  BIGINT      NOT NULL REFERENCES clients (id),
+    provider   TEXT        NOT NULL,
+    secret     TEXT        NOT NULL,
+    settings   JSONB       NOT NULL DEFAULT '{}'::jsonb,
+    enabled    BOOLEAN     NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ,
+    UNIQUE (client_id, provider)
+);
+
+-- Migramos el provider/secret único que tenía cada cliente.
+INSERT INTO client_providers (client_id, provider, secret)
+SELECT id, provider, secret
+FROM clients
+WHERE provider IS NOT NULL AND provider <> ''
+ON CONFLICT (client_id, provider) DO NOTHING;
+
+ALTER TABLE clients
+    DROP COLUMN IF EXISTS provider,
+    DROP COLUMN IF EXISTS secret;
@@ -0,0 +1,32 @@
+-- Registro append-only de acciones del admin.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id           BIGSERIAL PRIMARY KEY,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    actor_key_id BIGINT REFERENCES api_keys (id),
+    actor_name   TEXT        NOT NULL,
+    action       TEXT        NOT NULL,
+    target_type  TEXT,
+    target_id    TEXT,
+    before       JSONB,
+    after        JSONB,
+    diff         JSONB,
+    status_code  INT         NOT NULL,
+    source_ip    TEXT,
+    method       TEXT        NOT NULL,
+    path         TEXT        NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log (created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log (target_type, target_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log (actor_key_id);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_no_update ON audit_log;
+CREATE TRIGGER audit_log_no_update
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
@@ -0,0 +1,12 @@
+-- Overrides de rate limit por cliente (NULL = default global).
+ALTER TABLE clients
+    ADD COLUMN IF NOT EXISTS rate_limit_rps   DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS rate_limit_burst INT;
+
+-- Token buckets compartidos entre réplicas de la API.
+CREATE UNLOGGED TABLE IF NOT EXISTS rate_limit_buckets (
+    key        TEXT PRIMARY KEY,
+    tokens     DOUBLE PRECISION NOT NULL,
+    allowed    BOOLEAN          NOT NULL,
+    updated_at TIMESTAMPTZ      NOT NULL
+);
@@ -0,0 +1,3 @@
+-- Allowlist de IPs/CIDRs propia de cada cliente (vacía = sin restricción).
+ALTER TABLE clients
+    ADD COLUMN IF NOT EXISTS allowed_cidrs TEXT[] NOT NULL DEFAULT '{}';
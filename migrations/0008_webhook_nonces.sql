@@ -0,0 +1,8 @@
+-- Nonces/firmas ya vistas, para rechazar replays dentro de la ventana
+-- de tolerancia del timestamp.
+CREATE UNLOGGED TABLE IF NOT EXISTS webhook_nonces (
+    nonce_key  TEXT PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_nonces_expires_at ON webhook_nonces (expires_at);
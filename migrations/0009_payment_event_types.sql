@@ -0,0 +1,11 @@
+-- Eventos normalizados: qué tipo de evento es cada fila de payments
+-- (pago, reembolso, disputa, checkout, factura) y el tipo original del
+-- provider. Las filas existentes son todas pagos.
+ALTER TABLE payments
+    ADD COLUMN IF NOT EXISTS kind       TEXT NOT NULL DEFAULT 'payment',
+    ADD COLUMN IF NOT EXISTS event_type TEXT;
+
+-- Resultado del procesamiento: 'saved' o 'ignored' (tipo de evento que no
+-- genera un pago). NULL en eventos procesados antes de esta migración.
+ALTER TABLE webhook_events
+    ADD COLUMN IF NOT EXISTS outcome TEXT;
@@ -0,0 +1,99 @@
+-- Reembolsos y disputas como registros propios, vinculados al pago
+-- original por (provider, payment_external_id). Los webhooks de un mismo
+-- reembolso/disputa llegan varias veces (created, updated, ...): se hace
+-- upsert por (provider, external_id).
+CREATE TABLE IF NOT EXISTS refunds (
+    id                  BIGSERIAL PRIMARY KEY,
+    provider            TEXT NOT NULL,
+    external_id         TEXT NOT NULL,
+    payment_external_id TEXT NOT NULL,
+    amount              NUMERIC NOT NULL,
+    currency            TEXT NOT NULL DEFAULT '',
+    status              TEXT NOT NULL,
+    reason              TEXT NOT NULL DEFAULT '',
+    -- el provider sólo informó el total reembolsado del pago, sin detalle
+    -- por reembolso (amount es acumulado, no se suma con los demás)
+    cumulative          BOOLEAN NOT NULL DEFAULT FALSE,
+    refunded_at         TIMESTAMPTZ,
+    webhook_event_id    BIGINT REFERENCES webhook_events (id),
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at          TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (provider, external_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_refunds_payment
+    ON refunds (provider, payment_external_id);
+
+-- status: needs_response, under_review, won, lost, closed
+CREATE TABLE IF NOT EXISTS disputes (
+    id                  BIGSERIAL PRIMARY KEY,
+    provider            TEXT NOT NULL,
+    external_id         TEXT NOT NULL,
+    payment_external_id TEXT NOT NULL,
+    amount              NUMERIC NOT NULL,
+    currency            TEXT NOT NULL DEFAULT '',
+    status              TEXT NOT NULL,
+    reason              TEXT NOT NULL DEFAULT '',
+    opened_at           TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    closed_at           TIMESTAMPTZ,
+    webhook_event_id    BIGINT REFERENCES webhook_events (id),
+    updated_at          TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (provider, external_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_disputes_payment
+    ON disputes (provider, payment_external_id);
+
+-- historial de estados de cada disputa (una fila por cambio)
+CREATE TABLE IF NOT EXISTS dispute_events (
+    id               BIGSERIAL PRIMARY KEY,
+    dispute_id       BIGINT NOT NULL REFERENCES disputes (id),
+    status           TEXT NOT NULL,
+    webhook_event_id BIGINT REFERENCES webhook_events (id),
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_dispute_events_dispute
+    ON dispute_events (dispute_id, id);
+
+-- Neto por pago, para finanzas:
+--   net = monto del pago - reembolsado - disputas perdidas
+-- Los reembolsos parciales se suman; si sólo hay un total acumulado se
+-- toma el mayor de los dos (cubre providers que mandan ambos).
+CREATE OR REPLACE VIEW payment_balances AS
+WITH latest AS (
+    SELECT DISTINCT ON (provider, external_id)
+           provider, external_id, amount, currency
+    FROM payments
+    -- las filas refund/dispute de payments son anteriores a estas tablas
+    WHERE kind NOT IN ('refund', 'dispute')
+    ORDER BY provider, external_id, id DESC
+),
+refunded AS (
+    SELECT provider, payment_external_id AS external_id,
+           GREATEST(
+               COALESCE(SUM(amount) FILTER (WHERE NOT cumulative), 0),
+               COALESCE(MAX(amount) FILTER (WHERE cumulative), 0)
+           ) AS amount
+    FROM refunds
+    WHERE status = 'succeeded'
+    GROUP BY provider, payment_external_id
+),
+disputed AS (
+    SELECT provider, payment_external_id AS external_id,
+           COALESCE(SUM(amount) FILTER (WHERE status = 'lost'), 0) AS lost,
+           COALESCE(SUM(amount) FILTER (WHERE closed_at IS NULL), 0) AS open
+    FROM disputes
+    GROUP BY provider, payment_external_id
+)
+SELECT l.provider,
+       l.external_id,
+       l.currency,
+       l.amount                 AS gross,
+       COALESCE(r.amount, 0)    AS refunded,
+       COALESCE(d.lost, 0)      AS disputed_lost,
+       COALESCE(d.open, 0)      AS disputed_open,
+       l.amount - COALESCE(r.amount, 0) - COALESCE(d.lost, 0) AS net
+FROM latest l
+LEFT JOIN refunded r USING (provider, external_id)
+LEFT JOIN disputed d USING (provider, external_id);
@@ -0,0 +1,71 @@
+-- Estado canónico de los pagos: status pasa a tener el mismo vocabulario
+-- para todos los providers (pending, authorized, captured, failed,
+-- canceled, refunded, partially_refunded, disputed, charged_back, unknown)
+-- y el estado original del provider queda en raw_status.
+ALTER TABLE payments
+    ADD COLUMN IF NOT EXISTS raw_status TEXT NOT NULL DEFAULT '';
+
+-- Backfill de las filas existentes con las mismas tablas que
+-- internal/payments/status.go. Sólo se tocan filas sin raw_status y un
+-- estado ya canónico se deja como está, así la migración se puede correr
+-- dos veces.
+UPDATE payments
+SET raw_status = status,
+    status = CASE
+        -- ya canónico (providers sin tabla, o valores iguales en ambos)
+        WHEN status IN ('pending', 'authorized', 'captured', 'failed', 'canceled', 'refunded',
+                        'partially_refunded', 'disputed', 'charged_back', 'unknown')
+            THEN status
+        WHEN provider = 'mercadopago' AND status = 'approved' AND status_detail = 'partially_refunded'
+            THEN 'partially_refunded'
+        WHEN provider = 'mercadopago' THEN CASE status
+            WHEN 'pending'      THEN 'pending'
+            WHEN 'in_process'   THEN 'pending'
+            WHEN 'authorized'   THEN 'authorized'
+            WHEN 'approved'     THEN 'captured'
+            WHEN 'rejected'     THEN 'failed'
+            WHEN 'cancelled'    THEN 'canceled'
+            WHEN 'refunded'     THEN 'refunded'
+            WHEN 'in_mediation' THEN 'disputed'
+            WHEN 'charged_back' THEN 'charged_back'
+            ELSE 'unknown' END
+        WHEN provider = 'stripe' THEN CASE status
+            WHEN 'requires_payment_method' THEN 'pending'
+            WHEN 'requires_confirmation'   THEN 'pending'
+            WHEN 'requires_action'         THEN 'pending'
+            WHEN 'processing'              THEN 'pending'
+            WHEN 'pending'                 THEN 'pending'
+            WHEN 'unpaid'                  THEN 'pending'
+            WHEN 'open'                    THEN 'pending'
+            WHEN 'draft'                   THEN 'pending'
+            WHEN 'requires_capture'        THEN 'authorized'
+            WHEN 'succeeded'               THEN 'captured'
+            WHEN 'paid'                    THEN 'captured'
+            WHEN 'no_payment_required'     THEN 'captured'
+            WHEN 'failed'                  THEN 'failed'
+            WHEN 'uncollectible'           THEN 'failed'
+            WHEN 'canceled'                THEN 'canceled'
+            WHEN 'void'                    THEN 'canceled'
+            ELSE 'unknown' END
+        WHEN provider = 'paypal' THEN CASE status
+            WHEN 'CREATED'               THEN 'pending'
+            WHEN 'SAVED'                 THEN 'pending'
+            WHEN 'PENDING'               THEN 'pending'
+            WHEN 'PAYER_ACTION_REQUIRED' THEN 'pending'
+            WHEN 'APPROVED'              THEN 'authorized'
+            WHEN 'CAPTURED'              THEN 'captured'
+            WHEN 'COMPLETED'             THEN 'captured'
+            WHEN 'DECLINED'              THEN 'failed'
+            WHEN 'DENIED'                THEN 'failed'
+            WHEN 'FAILED'                THEN 'failed'
+            WHEN 'VOIDED'                THEN 'canceled'
+            WHEN 'EXPIRED'               THEN 'canceled'
+            WHEN 'REFUNDED'              THEN 'refunded'
+            WHEN 'PARTIALLY_REFUNDED'    THEN 'partially_refunded'
+            ELSE 'unknown' END
+        ELSE 'unknown'
+    END
+WHERE raw_status = '';
+
+CREATE INDEX IF NOT EXISTS idx_payments_status
+    ON payments (status);
@@ -0,0 +1,21 @@
+-- Body crudo y datos de la entrega. raw_body pasa a BYTEA con los bytes
+-- tal cual llegaron (para volver a verificar firmas; los formularios de
+-- PayU ya no se guardan convertidos a JSON) y se guardan los headers
+-- (filtrados, ver webhooks.filterHeaders), la IP de origen y el query
+-- string del request.
+DO $$
+BEGIN
+    -- el chequeo de tipo hace que la migración se pueda correr dos veces:
+    -- convertir un BYTEA de nuevo lo rompería
+    IF (SELECT data_type FROM information_schema.columns
+        WHERE table_name = 'webhook_events' AND column_name = 'raw_body') <> 'bytea' THEN
+        ALTER TABLE webhook_events
+            ALTER COLUMN raw_body TYPE BYTEA USING convert_to(raw_body::text, 'UTF8');
+    END IF;
+END
+$$;
+
+ALTER TABLE webhook_events
+    ADD COLUMN IF NOT EXISTS headers      JSONB NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS source_ip    INET,
+    ADD COLUMN IF NOT EXISTS query_string TEXT NOT NULL DEFAULT '';
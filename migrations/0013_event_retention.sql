@@ -0,0 +1,35 @@
+-- Retención de webhook_events: los eventos vencidos se archivan (NDJSON
+-- comprimido) y se borran, así que nada puede depender de que la fila
+-- siga existiendo.
+--
+-- webhook_event_id en payments, refunds, disputes y dispute_events pasa a
+-- ser una referencia blanda (el evento puede estar en un archivo): se
+-- sacan las FK que apuntan a webhook_events.
+DO $$
+DECLARE
+    fk RECORD;
+BEGIN
+    FOR fk IN
+        SELECT conrelid::regclass AS tbl, conname
+        FROM pg_constraint
+        WHERE contype = 'f' AND confrelid = 'webhook_events'::regclass
+    LOOP
+        EXECUTE format('ALTER TABLE %s DROP CONSTRAINT %I', fk.tbl, fk.conname);
+    END LOOP;
+END
+$$;
+
+-- El cliente del pago se guardaba sólo en el evento; el chequeo de tenant
+-- del balance no puede depender de un evento purgado.
+ALTER TABLE payments
+    ADD COLUMN IF NOT EXISTS client_id BIGINT;
+
+UPDATE payments p
+SET client_id = w.client_id
+FROM webhook_events w
+WHERE w.id = p.webhook_event_id AND p.client_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_payments_client_id ON payments (client_id);
+
+-- el job recorre los eventos viejos por received_at
+CREATE INDEX IF NOT EXISTS idx_webhook_events_received_at ON webhook_events (received_at);
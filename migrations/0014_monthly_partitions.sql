@@ -0,0 +1,150 @@
+-- webhook_events y payments pasan a estar particionadas por mes
+-- (received_at / created_at). Las particiones nuevas las crea el worker
+-- por adelantado (internal/partitions) y las viejas se desanclan en vez de
+-- borrar filas.
+--
+-- La tabla existente no se copia: queda como partición <tabla>_legacy con
+-- todo lo anterior al mes que viene. Antes del ATTACH se valida un CHECK
+-- con el mismo rango para que el ATTACH no vuelva a recorrerla.
+--
+-- Limitación: la legacy va de MINVALUE al mes que viene, así que el
+-- worker sólo la puede desanclar cuando ese último mes también quedó
+-- fuera de *_RETAIN_MONTHS, es decir, cuando venció todo lo que tiene.
+-- Mientras tanto la retención por filas (internal/retention) la va
+-- vaciando. Partirla por mes implicaría copiar todas las filas (Postgres
+-- 16 no tiene SPLIT PARTITION) con la tabla bloqueada, que es justo lo
+-- que esta migración evita.
+--
+-- La PK pasa a ser (id, <columna de partición>): Postgres exige que los
+-- índices únicos de una tabla particionada incluyan la clave. Por eso en
+-- 0013 se sacaron las FK que apuntaban a webhook_events.
+
+ALTER TABLE payments
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+DO $$
+DECLARE
+    t      RECORD;
+    idx    RECORD;
+    legacy TEXT;
+    seq    TEXT;
+    bound  TIMESTAMPTZ := (date_trunc('month', NOW() AT TIME ZONE 'UTC') + INTERVAL '1 month') AT TIME ZONE 'UTC';
+    m      TIMESTAMPTZ;
+BEGIN
+    FOR t IN SELECT * FROM (VALUES ('webhook_events', 'received_at'), ('payments', 'created_at')) AS v (tbl, col)
+    LOOP
+        -- ya migrada
+        CONTINUE WHEN (SELECT relkind FROM pg_class WHERE oid = t.tbl::regclass) = 'p';
+
+        legacy := t.tbl || '_legacy';
+        seq := pg_get_serial_sequence(t.tbl, 'id');
+
+        EXECUTE format('ALTER TABLE %I ALTER COLUMN %I SET NOT NULL', t.tbl, t.col);
+        EXECUTE format('ALTER TABLE %I RENAME TO %I', t.tbl, legacy);
+
+        -- los nombres de índices son únicos por schema: los de la tabla
+        -- vieja se renombran para que la nueva use los de siempre
+        FOR idx IN
+            SELECT c.relname
+            FROM pg_index i
+            JOIN pg_class c ON c.oid = i.indexrelid
+            WHERE i.indrelid = legacy::regclass
+        LOOP
+            EXECUTE format('ALTER INDEX %I RENAME TO %I', idx.relname, left(idx.relname, 56) || '_legacy');
+        END LOOP;
+
+        EXECUTE format(
+            'CREATE TABLE %I (LIKE %I INCLUDING DEFAULTS INCLUDING CONSTRAINTS) PARTITION BY RANGE (%I)',
+            t.tbl, legacy, t.col);
+        EXECUTE format('ALTER TABLE %I ADD PRIMARY KEY (id, %I)', t.tbl, t.col);
+
+        -- la secuencia del id pasa a la tabla nueva: si no, se borraría
+        -- junto con la partición legacy
+        IF seq IS NOT NULL THEN
+            EXECUTE format('ALTER SEQUENCE %s OWNED BY %I.id', seq, t.tbl);
+        END IF;
+
+        EXECUTE format('ALTER TABLE %I ADD CONSTRAINT %I CHECK (%I < %L) NOT VALID',
+            legacy, legacy || '_bound', t.col, bound);
+        EXECUTE format('ALTER TABLE %I VALIDATE CONSTRAINT %I', legacy, legacy || '_bound');
+        EXECUTE format('ALTER TABLE %I ATTACH PARTITION %I FOR VALUES FROM (MINVALUE) TO (%L)',
+            t.tbl, legacy, bound);
+        EXECUTE format('ALTER TABLE %I DROP CONSTRAINT %I', legacy, legacy || '_bound');
+
+        -- los próximos meses, para no depender de que el worker ya corra
+        FOR i IN 0..2 LOOP
+            m := bound + make_interval(months => i);
+            EXECUTE format('CREATE TABLE IF NOT EXISTS %I PARTITION OF %I FOR VALUES FROM (%L) TO (%L)',
+                t.tbl || to_char(m AT TIME ZONE 'UTC', '"_p"YYYY_MM'), t.tbl, m, m + INTERVAL '1 month');
+        END LOOP;
+    END LOOP;
+END
+$$;
+
+-- El FK a clients ya existe en la partición legacy; al agregarlo en la
+-- tabla particionada se reutiliza sin volver a validarlo.
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM pg_constraint
+        WHERE conrelid = 'webhook_events'::regclass AND contype = 'f' AND confrelid = 'clients'::regclass
+    ) THEN
+        ALTER TABLE webhook_events ADD FOREIGN KEY (client_id) REFERENCES clients (id);
+    END IF;
+END
+$$;
+
+-- Índices en la tabla particionada: se crean en cada partición y en la
+-- legacy se reutiliza el equivalente que ya tenía.
+CREATE INDEX IF NOT EXISTS idx_webhook_events_client_id ON webhook_events (client_id, id);
+CREATE INDEX IF NOT EXISTS idx_webhook_events_received_at ON webhook_events (received_at);
+CREATE INDEX IF NOT EXISTS idx_payments_status ON payments (status);
+CREATE INDEX IF NOT EXISTS idx_payments_client_id ON payments (client_id);
+CREATE INDEX IF NOT EXISTS idx_payments_webhook_event_id ON payments (webhook_event_id);
+CREATE INDEX IF NOT EXISTS idx_payments_provider_external_id ON payments (provider, external_id, id);
+
+-- Cola del worker: sólo las filas pendientes, así el índice no crece con
+-- el histórico. FetchNextPending filtra processed = FALSE y ordena por id.
+CREATE INDEX IF NOT EXISTS idx_webhook_events_pending
+    ON webhook_events (id)
+    WHERE processed = FALSE;
+
+-- payment_balances apuntaba a la tabla vieja (ahora payments_legacy);
+-- misma definición que en 0010 sobre la tabla particionada.
+CREATE OR REPLACE VIEW payment_balances AS
+WITH latest AS (
+    SELECT DISTINCT ON (provider, external_id)
+           provider, external_id, amount, currency
+    FROM payments
+    -- las filas refund/dispute de payments son anteriores a estas tablas
+    WHERE kind NOT IN ('refund', 'dispute')
+    ORDER BY provider, external_id, id DESC
+),
+refunded AS (
+    SELECT provider, payment_external_id AS external_id,
+           GREATEST(
+               COALESCE(SUM(amount) FILTER (WHERE NOT cumulative), 0),
+               COALESCE(MAX(amount) FILTER (WHERE cumulative), 0)
+           ) AS amount
+    FROM refunds
+    WHERE status = 'succeeded'
+    GROUP BY provider, payment_external_id
+),
+disputed AS (
+    SELECT provider, payment_external_id AS external_id,
+           COALESCE(SUM(amount) FILTER (WHERE status = 'lost'), 0) AS lost,
+           COALESCE(SUM(amount) FILTER (WHERE closed_at IS NULL), 0) AS open
+    FROM disputes
+    GROUP BY provider, payment_external_id
+)
+SELECT l.provider,
+       l.external_id,
+       l.currency,
+       l.amount                 AS gross,
+       COALESCE(r.amount, 0)    AS refunded,
+       COALESCE(d.lost, 0)      AS disputed_lost,
+       COALESCE(d.open, 0)      AS disputed_open,
+       l.amount - COALESCE(r.amount, 0) - COALESCE(d.lost, 0) AS net
+FROM latest l
+LEFT JOIN refunded r USING (provider, external_id)
+LEFT JOIN disputed d USING (provider, external_id);
@@ -0,0 +1,6 @@
+-- El worker reclama eventos de a lotes. FOR UPDATE SKIP LOCKED sólo
+-- protege mientras dura la transacción del SELECT, así que el reclamo
+-- queda en claimed_until: hasta esa hora ningún otro worker toma el
+-- evento. Si el worker muere, el lease vence y el evento vuelve a la cola.
+ALTER TABLE webhook_events
+    ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMPTZ;
@@ -0,0 +1,14 @@
+-- Reintentos con backoff: un evento que falla vuelve a la cola recién en
+-- next_attempt_at, y cuando se agotan los intentos (o el error no se
+-- arregla reintentando, p.ej. un payload inválido) queda muerto en dead_at.
+-- ClaimPending no toma ni los muertos ni los que todavía esperan; salen de
+-- ese estado con un replay.
+ALTER TABLE webhook_events
+    ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS dead_at TIMESTAMPTZ;
+
+-- la cola del worker deja de incluir a los muertos
+DROP INDEX IF EXISTS idx_webhook_events_pending;
+CREATE INDEX IF NOT EXISTS idx_webhook_events_pending
+    ON webhook_events (id)
+    WHERE processed = FALSE AND dead_at IS NULL;
@@ -0,0 +1,49 @@
+-- Idempotencia de pagos. payments está particionada por created_at, así
+-- que no puede tener un índice único por pago (tendría que incluir
+-- created_at). El estado actual de cada pago va a payment_states, única
+-- por (client_id, provider, kind, external_id): un webhook sólo agrega una
+-- fila a payments si cambia algo de ese estado. Un replay o una
+-- redelivery del provider con lo mismo no duplica nada.
+CREATE TABLE IF NOT EXISTS payment_states (
+    id               BIGSERIAL PRIMARY KEY,
+    client_id        BIGINT,
+    provider         TEXT NOT NULL,
+    kind             TEXT NOT NULL,
+    external_id      TEXT NOT NULL,
+    status           TEXT NOT NULL,
+    raw_status       TEXT NOT NULL DEFAULT '',
+    status_detail    TEXT NOT NULL DEFAULT '',
+    amount           NUMERIC NOT NULL,
+    currency         TEXT NOT NULL DEFAULT '',
+    -- última fila de payments (la que tiene este estado)
+    payment_id       BIGINT NOT NULL,
+    webhook_event_id BIGINT,
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE NULLS NOT DISTINCT (client_id, provider, kind, external_id)
+);
+
+-- historial de estados de cada pago (una fila por cambio de status)
+CREATE TABLE IF NOT EXISTS payment_status_changes (
+    id               BIGSERIAL PRIMARY KEY,
+    payment_state_id BIGINT NOT NULL REFERENCES payment_states (id),
+    from_status      TEXT,
+    to_status        TEXT NOT NULL,
+    webhook_event_id BIGINT,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_status_changes_state
+    ON payment_status_changes (payment_state_id, id);
+
+-- Backfill con la última fila de cada pago. Las filas duplicadas que ya
+-- hay en payments se quedan (payment_balances toma la última igual).
+INSERT INTO payment_states (
+    client_id, provider, kind, external_id, status, raw_status, status_detail,
+    amount, currency, payment_id, webhook_event_id, updated_at
+)
+SELECT DISTINCT ON (client_id, provider, kind, external_id)
+       client_id, provider, kind, external_id, status, raw_status, COALESCE(status_detail, ''),
+       amount, COALESCE(currency, ''), id, webhook_event_id, created_at
+FROM payments
+ORDER BY client_id, provider, kind, external_id, id DESC
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,88 @@
+-- Reembolsos y disputas por cliente. Los ids de PayU (reference_sale) y
+-- del provider genérico los elige el comercio, así que dos clientes pueden
+-- mandar el mismo: con la clave (provider, external_id) el reembolso de
+-- uno pisaba el del otro y el neto de un pago mezclaba los de ambos.
+ALTER TABLE refunds ADD COLUMN IF NOT EXISTS client_id BIGINT;
+ALTER TABLE disputes ADD COLUMN IF NOT EXISTS client_id BIGINT;
+
+-- Backfill: el cliente del webhook que los creó o, si ese evento ya se
+-- purgó, el del último pago con ese external_id. Sólo filas sin cliente,
+-- así la migración se puede correr dos veces.
+UPDATE refunds r
+SET client_id = COALESCE(
+    (SELECT e.client_id FROM webhook_events e WHERE e.id = r.webhook_event_id LIMIT 1),
+    (SELECT p.client_id FROM payments p
+     WHERE p.provider = r.provider AND p.external_id = r.payment_external_id
+     ORDER BY p.id DESC LIMIT 1))
+WHERE r.client_id IS NULL;
+
+UPDATE disputes d
+SET client_id = COALESCE(
+    (SELECT e.client_id FROM webhook_events e WHERE e.id = d.webhook_event_id LIMIT 1),
+    (SELECT p.client_id FROM payments p
+     WHERE p.provider = d.provider AND p.external_id = d.payment_external_id
+     ORDER BY p.id DESC LIMIT 1))
+WHERE d.client_id IS NULL;
+
+-- la clave única pasa a incluir al cliente (NULL = eventos sin cliente,
+-- que cuentan como uno más)
+ALTER TABLE refunds DROP CONSTRAINT IF EXISTS refunds_provider_external_id_key;
+ALTER TABLE disputes DROP CONSTRAINT IF EXISTS disputes_provider_external_id_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_refunds_client_external_id
+    ON refunds (client_id, provider, external_id) NULLS NOT DISTINCT;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_disputes_client_external_id
+    ON disputes (client_id, provider, external_id) NULLS NOT DISTINCT;
+
+DROP INDEX IF EXISTS idx_refunds_payment;
+DROP INDEX IF EXISTS idx_disputes_payment;
+CREATE INDEX IF NOT EXISTS idx_refunds_payment
+    ON refunds (client_id, provider, payment_external_id);
+CREATE INDEX IF NOT EXISTS idx_disputes_payment
+    ON disputes (client_id, provider, payment_external_id);
+
+-- payment_balances pasa a ser por (client_id, provider, external_id). Se
+-- agrega una columna, así que no alcanza con CREATE OR REPLACE.
+DROP VIEW IF EXISTS payment_balances;
+CREATE VIEW payment_balances AS
+WITH latest AS (
+    SELECT DISTINCT ON (client_id, provider, external_id)
+           client_id, provider, external_id, amount, currency
+    FROM payments
+    -- las filas refund/dispute de payments son anteriores a estas tablas
+    WHERE kind NOT IN ('refund', 'dispute')
+    ORDER BY client_id, provider, external_id, id DESC
+),
+refunded AS (
+    SELECT client_id, provider, payment_external_id AS external_id,
+           GREATEST(
+               COALESCE(SUM(amount) FILTER (WHERE NOT cumulative), 0),
+               COALESCE(MAX(amount) FILTER (WHERE cumulative), 0)
+           ) AS amount
+    FROM refunds
+    WHERE status = 'succeeded'
+    GROUP BY client_id, provider, payment_external_id
+),
+disputed AS (
+    SELECT client_id, provider, payment_external_id AS external_id,
+           COALESCE(SUM(amount) FILTER (WHERE status = 'lost'), 0) AS lost,
+           COALESCE(SUM(amount) FILTER (WHERE closed_at IS NULL), 0) AS open
+    FROM disputes
+    GROUP BY client_id, provider, payment_external_id
+)
+SELECT l.client_id,
+       l.provider,
+       l.external_id,
+       l.currency,
+       l.amount                 AS gross,
+       COALESCE(r.amount, 0)    AS refunded,
+       COALESCE(d.lost, 0)      AS disputed_lost,
+       COALESCE(d.open, 0)      AS disputed_open,
+       l.amount - COALESCE(r.amount, 0) - COALESCE(d.lost, 0) AS net
+FROM latest l
+LEFT JOIN refunded r
+       ON r.client_id IS NOT DISTINCT FROM l.client_id
+      AND r.provider = l.provider AND r.external_id = l.external_id
+LEFT JOIN disputed d
+       ON d.client_id IS NOT DISTINCT FROM l.client_id
+      AND d.provider = l.provider AND d.external_id = l.external_id;
@@ -0,0 +1,6 @@
+-- Eventos restaurados desde un archivo (retention restore). Conservan su
+-- received_at y su estado terminal, así que sin marca la próxima pasada de
+-- la retención los volvería a archivar y borrar: se saltean durante
+-- RETENTION_RESTORE_GRACE desde restored_at.
+ALTER TABLE webhook_events
+    ADD COLUMN IF NOT EXISTS restored_at TIMESTAMPTZ;